@@ -0,0 +1,121 @@
+// Package authentication identifies the callers of the provider's system endpoints. An
+// Authenticator checks one kind of credential, the validated Principal is then made
+// available to handlers through the request context.
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// ErrNoCredentials is returned by an Authenticator when a request does not carry the kind
+// of credentials it checks, so that the next Authenticator is tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Methods of authentication recorded in a Principal
+const (
+	MethodBasic  = "basic"
+	MethodBearer = "bearer"
+	MethodJWT    = "jwt"
+	// MethodCertificate is a verified TLS client certificate
+	MethodCertificate = "certificate"
+)
+
+// IsMethod returns true for the methods of authentication a Principal may have
+func IsMethod(method string) bool {
+	switch method {
+	case MethodBasic, MethodBearer, MethodJWT, MethodCertificate:
+		return true
+	}
+
+	return false
+}
+
+// Principal is an authenticated caller
+type Principal struct {
+	// Name identifies the caller: the basic auth user, the name of a bearer token, the
+	// subject of a JWT or the common name of a client certificate
+	Name string `json:"name"`
+	// Method is how the caller authenticated: basic, bearer, jwt or certificate
+	Method string `json:"method"`
+	// Claims are the validated claims of a JWT
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// Subject qualifies the name of the principal with its method, i.e. "basic:admin" or
+// "jwt:alice", as the same name may identify different callers with different methods
+func (p *Principal) Subject() string {
+	return p.Method + ":" + p.Name
+}
+
+// Authenticator validates the credentials of a request. It returns ErrNoCredentials when
+// the request has none of the credentials it checks, or another error when they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each Authenticator in turn, returning the first Principal. Credentials which
+// are present but invalid are rejected without trying the rest.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+
+		return principal, err
+	}
+
+	return nil, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal of an authenticated request, or nil
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// unauthorizedResponse is the body of a rejected request, in the format of the ErrorResponse
+// of the handlers, which this package can not import
+var unauthorizedResponse, _ = json.Marshal(struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}{
+	Code:    "unauthorized",
+	Message: "invalid credentials",
+})
+
+// Decorate rejects requests which the authenticator does not accept with 401, and passes
+// the Principal of those it does to next in the request context
+func Decorate(next http.HandlerFunc, authenticator Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) {
+				log.Printf("Rejected credentials for %s %s from %s: %s\n", r.Method, r.URL.Path, r.RemoteAddr, err)
+			}
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			w.Header().Add("WWW-Authenticate", `Bearer realm="Restricted"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(unauthorizedResponse)
+			return
+		}
+
+		next(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	}
+}
@@ -0,0 +1,134 @@
+package authentication
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+func makeTokenFile(t *testing.T, dir string, name string, token string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(token+"\n"), 0600); err != nil {
+		t.Fatalf("unable to write token: %s", err)
+	}
+
+	return file
+}
+
+func Test_Decorate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "faas-swarm-auth")
+	defer os.RemoveAll(dir)
+
+	tokens, err := ReadBearerTokens([]string{makeTokenFile(t, dir, "ci-token", "s3cr3t")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chain := Chain{
+		BasicAuth{Credentials: &auth.BasicAuthCredentials{User: "admin", Password: "password"}},
+		tokens,
+	}
+
+	var principal *Principal
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		principal = PrincipalFrom(r.Context())
+	}, chain)
+
+	cases := []struct {
+		name       string
+		setup      func(r *http.Request)
+		wantStatus int
+		wantName   string
+		wantMethod string
+	}{
+		{
+			name:       "basic auth",
+			setup:      func(r *http.Request) { r.SetBasicAuth("admin", "password") },
+			wantStatus: http.StatusOK,
+			wantName:   "admin",
+			wantMethod: MethodBasic,
+		},
+		{
+			name:       "bearer token",
+			setup:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cr3t") },
+			wantStatus: http.StatusOK,
+			wantName:   "ci-token",
+			wantMethod: MethodBearer,
+		},
+		{
+			name:       "wrong password",
+			setup:      func(r *http.Request) { r.SetBasicAuth("admin", "guess") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown bearer token",
+			setup:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no credentials",
+			setup:      func(r *http.Request) {},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			principal = nil
+
+			r := httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+			c.setup(r)
+			w := httptest.NewRecorder()
+
+			handler(w, r)
+
+			if w.Code != c.wantStatus {
+				t.Fatalf("want status: %d, got: %d", c.wantStatus, w.Code)
+			}
+
+			if c.wantStatus != http.StatusOK {
+				res := struct {
+					Code string `json:"code"`
+				}{}
+				if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != "unauthorized" {
+					t.Errorf("want error code: unauthorized, got: %q, %v", res.Code, err)
+				}
+				return
+			}
+
+			if principal == nil || principal.Name != c.wantName || principal.Method != c.wantMethod {
+				t.Errorf("want principal %s by %s, got: %+v", c.wantName, c.wantMethod, principal)
+			}
+		})
+	}
+}
+
+func Test_ClientCertificate(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+
+	if _, err := (ClientCertificate{}).Authenticate(r); err != ErrNoCredentials {
+		t.Errorf("want ErrNoCredentials without TLS, got: %v", err)
+	}
+
+	r.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "gateway"}}}},
+	}
+
+	principal, err := ClientCertificate{}.Authenticate(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if principal.Name != "gateway" || principal.Method != MethodCertificate {
+		t.Errorf("want principal gateway by %s, got: %+v", MethodCertificate, principal)
+	}
+}
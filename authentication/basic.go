@@ -0,0 +1,30 @@
+package authentication
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/openfaas/faas-provider/auth"
+)
+
+// BasicAuth accepts the basic auth credentials read by auth.ReadBasicAuthFromDisk
+type BasicAuth struct {
+	Credentials *auth.BasicAuthCredentials
+}
+
+// Authenticate implements Authenticator
+func (b BasicAuth) Authenticate(r *http.Request) (*Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	userMatch := subtle.ConstantTimeCompare([]byte(b.Credentials.User), []byte(user))
+	passwordMatch := subtle.ConstantTimeCompare([]byte(b.Credentials.Password), []byte(password))
+	if userMatch&passwordMatch == 0 {
+		return nil, errors.New("invalid basic auth user or password")
+	}
+
+	return &Principal{Name: user, Method: MethodBasic}, nil
+}
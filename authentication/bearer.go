@@ -0,0 +1,73 @@
+package authentication
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// bearerPrefix starts the Authorization header of a request with a bearer token
+const bearerPrefix = "Bearer "
+
+// bearerToken returns the bearer token of a request, if it has one
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
+
+// BearerTokens accepts a fixed set of bearer tokens, each of which names its caller
+type BearerTokens struct {
+	// tokens maps each token to the name of its caller
+	tokens map[string]string
+}
+
+// ReadBearerTokens reads one token from each file, i.e. Swarm secrets mounted in
+// /run/secrets/. The caller using a token is named after its file.
+func ReadBearerTokens(files []string) (*BearerTokens, error) {
+	b := &BearerTokens{tokens: map[string]string{}}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read bearer token: %s", err)
+		}
+
+		token := strings.TrimSpace(string(data))
+		if len(token) == 0 {
+			return nil, fmt.Errorf("bearer token %s is empty", file)
+		}
+
+		b.tokens[token] = path.Base(file)
+	}
+
+	return b, nil
+}
+
+// Authenticate implements Authenticator
+func (b *BearerTokens) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	for candidate, name := range b.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return &Principal{Name: name, Method: MethodBearer}, nil
+		}
+	}
+
+	// a JWT is left for the JWT authenticator
+	if isJWT(token) {
+		return nil, ErrNoCredentials
+	}
+
+	return nil, errors.New("invalid bearer token")
+}
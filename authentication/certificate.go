@@ -0,0 +1,24 @@
+package authentication
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ClientCertificate accepts the client certificate of a TLS connection, once it has been
+// verified against the client CAs. The caller is named after its common name.
+type ClientCertificate struct{}
+
+// Authenticate implements Authenticator
+func (ClientCertificate) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(name) == 0 {
+		return nil, errors.New("client certificate has no common name")
+	}
+
+	return &Principal{Name: name, Method: MethodCertificate}, nil
+}
@@ -0,0 +1,332 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	// hashes used by the supported signing algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// jwtLeeway allows for clock skew between the issuer and the provider when checking the
+// exp and nbf claims
+const jwtLeeway = 30 * time.Second
+
+// ecdsaCurves are the curves each ECDSA signing algorithm must be used with
+var ecdsaCurves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+// JWT accepts JSON Web Tokens signed with RS256, RS384, RS512, ES256, ES384 or ES512 by
+// one of the keys of a JWKS file
+type JWT struct {
+	keys     map[string]signingKey
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// signingKey is a key of a JWKS, with the only algorithm it may be used with when the
+// JWKS sets one
+type signingKey struct {
+	key       crypto.PublicKey
+	algorithm string
+}
+
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+// ReadJWKS reads the signing keys of a JWKS file. Tokens must be issued by issuer and name
+// audience in their aud claim, unless these are empty.
+func ReadJWKS(file string, issuer string, audience string) (*JWT, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read JWKS: %s", err)
+	}
+
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("unable to parse JWKS %s: %s", file, err)
+	}
+
+	j := &JWT{keys: map[string]signingKey{}, issuer: issuer, audience: audience, now: time.Now}
+	for _, key := range set.Keys {
+		if len(key.Use) > 0 && key.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := key.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS %s: %s", key.KeyID, file, err)
+		}
+
+		if len(key.Algorithm) > 0 && !keyMatches(key.Algorithm, publicKey) {
+			return nil, fmt.Errorf("invalid key %q in JWKS %s: algorithm %q does not match the key", key.KeyID, file, key.Algorithm)
+		}
+		j.keys[key.KeyID] = signingKey{key: publicKey, algorithm: key.Algorithm}
+	}
+
+	if len(j.keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found in JWKS %s", file)
+	}
+
+	return j, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+// isJWT returns true for tokens in the compact JWS format, header.payload.signature
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Authenticate implements Authenticator
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || !isJWT(token) {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := j.validate(token)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if len(subject) == 0 {
+		return nil, errors.New("invalid JWT: no sub claim")
+	}
+
+	return &Principal{Name: subject, Method: MethodJWT, Claims: claims}, nil
+}
+
+// validate checks the signature, expiry, issuer and audience of a token, returning its claims
+func (j *JWT) validate(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	header := struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid JWT header: %s", err)
+	}
+
+	key, err := j.key(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid JWT signature encoding")
+	}
+
+	if len(key.algorithm) > 0 && header.Algorithm != key.algorithm {
+		return nil, fmt.Errorf("invalid JWT: algorithm %q is not the %s of the key", header.Algorithm, key.algorithm)
+	}
+
+	if err := verifySignature(header.Algorithm, key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid JWT claims: %s", err)
+	}
+
+	now := j.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("invalid JWT: no exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, errors.New("invalid JWT: token has expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("invalid JWT: token is not valid yet")
+	}
+
+	if len(j.issuer) > 0 && claims["iss"] != j.issuer {
+		return nil, fmt.Errorf("invalid JWT: issuer %v is not %s", claims["iss"], j.issuer)
+	}
+
+	if len(j.audience) > 0 && !hasAudience(claims["aud"], j.audience) {
+		return nil, fmt.Errorf("invalid JWT: audience does not include %s", j.audience)
+	}
+
+	return claims, nil
+}
+
+// key returns the key named by kid, or the only key when the token does not name one
+func (j *JWT) key(kid string) (signingKey, error) {
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+
+	if len(kid) == 0 && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+
+	return signingKey{}, fmt.Errorf("invalid JWT: unknown key %q", kid)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, item := range v {
+			if item == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// keyMatches returns true when the key can be used with the algorithm: RS algorithms with
+// RSA keys and each ES algorithm with an ECDSA key on its curve
+func keyMatches(algorithm string, key crypto.PublicKey) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return algorithm == "RS256" || algorithm == "RS384" || algorithm == "RS512"
+	case *ecdsa.PublicKey:
+		curve, ok := ecdsaCurves[algorithm]
+		return ok && k.Curve.Params().Name == curve
+	}
+
+	return false
+}
+
+// verifySignature checks a JWS signature, the algorithm must match the type and curve of
+// the key so that a token can not choose a weaker algorithm
+func verifySignature(algorithm string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch algorithm {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("invalid JWT: unsupported algorithm %q", algorithm)
+	}
+
+	if !keyMatches(algorithm, key) {
+		return fmt.Errorf("invalid JWT: algorithm %s does not match the key", algorithm)
+	}
+
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return errors.New("invalid JWT: signature does not match")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid JWT: signature does not match")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid JWT: signature does not match")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("invalid JWT: algorithm %s does not match the key", algorithm)
+}
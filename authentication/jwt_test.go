@@ -0,0 +1,188 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("unable to encode: %s", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	return signRS(t, key, "RS256", crypto.SHA256, kid, claims)
+}
+
+func signRS(t *testing.T, key *rsa.PrivateKey, algorithm string, hash crypto.Hash, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": algorithm, "kid": kid}) + "." + encodeSegment(t, claims)
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, hash, hasher.Sum(nil))
+	if err != nil {
+		t.Fatalf("unable to sign: %s", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	return signES(t, key, "ES256", crypto.SHA256, kid, claims)
+}
+
+func signES(t *testing.T, key *ecdsa.PrivateKey, algorithm string, hash crypto.Hash, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": algorithm, "kid": kid}) + "." + encodeSegment(t, claims)
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, hasher.Sum(nil))
+	if err != nil {
+		t.Fatalf("unable to sign: %s", err)
+	}
+
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func makeJWT(t *testing.T) (*JWT, *rsa.PrivateKey, *ecdsa.PrivateKey) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+		},
+	}
+
+	dir, _ := ioutil.TempDir("", "faas-swarm-jwks")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	data, _ := json.Marshal(jwks)
+	file := filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(file, data, 0600)
+
+	j, err := ReadJWKS(file, "https://issuer.example.com", "faas-swarm")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return j, rsaKey, ecKey
+}
+
+func makeClaims(modify func(claims map[string]interface{})) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub":        "alice",
+		"iss":        "https://issuer.example.com",
+		"aud":        []string{"faas-swarm", "gateway"},
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"namespaces": []string{"team-a"},
+	}
+	modify(claims)
+
+	return claims
+}
+
+func authenticateToken(j *JWT, token string) (*Principal, error) {
+	r := httptest.NewRequest(http.MethodGet, "/system/functions", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	return j.Authenticate(r)
+}
+
+func Test_JWT_Valid(t *testing.T) {
+	j, rsaKey, ecKey := makeJWT(t)
+
+	tokens := map[string]string{
+		"RS256": signRS256(t, rsaKey, "rsa-1", makeClaims(func(map[string]interface{}) {})),
+		"ES256": signES256(t, ecKey, "ec-1", makeClaims(func(map[string]interface{}) {})),
+	}
+
+	for algorithm, token := range tokens {
+		principal, err := authenticateToken(j, token)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", algorithm, err)
+		}
+
+		if principal.Name != "alice" || principal.Method != MethodJWT {
+			t.Errorf("%s: want alice by jwt, got: %+v", algorithm, principal)
+		}
+
+		if namespaces, ok := principal.Claims["namespaces"].([]interface{}); !ok || namespaces[0] != "team-a" {
+			t.Errorf("%s: want the namespaces claim, got: %v", algorithm, principal.Claims["namespaces"])
+		}
+	}
+}
+
+func Test_JWT_Invalid(t *testing.T) {
+	j, rsaKey, ecKey := makeJWT(t)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cases := map[string]string{
+		"expired":        signRS256(t, rsaKey, "rsa-1", makeClaims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() })),
+		"wrong issuer":   signRS256(t, rsaKey, "rsa-1", makeClaims(func(c map[string]interface{}) { c["iss"] = "https://other.example.com" })),
+		"wrong audience": signRS256(t, rsaKey, "rsa-1", makeClaims(func(c map[string]interface{}) { c["aud"] = "gateway" })),
+		"unknown key":    signRS256(t, rsaKey, "rsa-2", makeClaims(func(map[string]interface{}) {})),
+		"wrong key":      signRS256(t, otherKey, "rsa-1", makeClaims(func(map[string]interface{}) {})),
+		"key type":       signRS256(t, rsaKey, "ec-1", makeClaims(func(map[string]interface{}) {})),
+		"key algorithm":  signRS(t, rsaKey, "RS512", crypto.SHA512, "rsa-1", makeClaims(func(map[string]interface{}) {})),
+		"key curve":      signES(t, ecKey, "ES512", crypto.SHA512, "ec-1", makeClaims(func(map[string]interface{}) {})),
+		"unsigned": encodeSegment(t, map[string]string{"alg": "none"}) + "." +
+			encodeSegment(t, makeClaims(func(map[string]interface{}) {})) + ".",
+	}
+
+	for name, token := range cases {
+		t.Run(name, func(t *testing.T) {
+			if principal, err := authenticateToken(j, token); err == nil {
+				t.Errorf("want an error, got principal: %+v", principal)
+			}
+		})
+	}
+}
+
+func Test_ReadJWKS_AlgorithmDoesNotMatchKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "EC", "kid": "ec-1", "alg": "ES384", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+		},
+	}
+
+	dir, _ := ioutil.TempDir("", "faas-swarm-jwks")
+	defer os.RemoveAll(dir)
+
+	data, _ := json.Marshal(jwks)
+	file := filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(file, data, 0600)
+
+	if _, err := ReadJWKS(file, "", ""); err == nil {
+		t.Errorf("want an error for an ES384 key on P-256")
+	}
+}
@@ -0,0 +1,122 @@
+package authorization
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-swarm/authentication"
+	"github.com/openfaas/faas-swarm/handlers"
+)
+
+// Rule describes the actions performed by a route
+type Rule struct {
+	// Actions maps the HTTP methods of the route to the action each performs
+	Actions map[string]Action
+	// BodyNamespace is set for routes whose handler takes the namespace from the JSON body
+	// in preference to the query, i.e. deploy, update and secrets
+	BodyNamespace bool
+}
+
+// Require rejects requests with 403 unless the policy permits the principal in the request
+// context to perform the action of the rule for the request's method
+func Require(next http.HandlerFunc, policy *Policy, rule Rule) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action, ok := rule.Actions[r.Method]
+		if !ok {
+			writeError(w, http.StatusMethodNotAllowed, handlers.ErrorCodeMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		principal := authentication.PrincipalFrom(r.Context())
+
+		for _, request := range requestScopes(r, action, rule.BodyNamespace) {
+			if policy.Allowed(principal, request) {
+				continue
+			}
+
+			name := ""
+			if principal != nil {
+				name = principal.Subject()
+			}
+
+			log.Printf("Denied %s to %q for %s %s, namespace: %s, function: %q\n",
+				action, name, r.Method, r.URL.Path, request.Namespace, request.Function)
+
+			writeError(w, http.StatusForbidden, handlers.ErrorCodeForbidden,
+				fmt.Sprintf("%s is not permitted in namespace %s", action, request.Namespace))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// writeError writes the same ErrorResponse as the handlers, so that callers can handle
+// every error of the API alike
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	body, err := json.Marshal(handlers.ErrorResponse{Code: code, Message: message})
+	if err != nil {
+		log.Printf("Error marshalling error response: %s\n", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// requestScopes returns the action on the namespace of a request and every function it
+// names, in its path, query or JSON body, i.e. the service of a deployment or the
+// functionName of a delete request. Each must be permitted, so that the scope checked can
+// not differ from the one a handler acts on.
+func requestScopes(r *http.Request, action Action, bodyNamespace bool) []Request {
+	query := r.URL.Query()
+
+	namespace := query.Get("namespace")
+	functions := []string{mux.Vars(r)["name"], query.Get("name")}
+
+	if r.Body != nil && r.Method != http.MethodGet {
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		scope := struct {
+			Service      string `json:"service"`
+			FunctionName string `json:"functionName"`
+			Namespace    string `json:"namespace"`
+		}{}
+
+		if err == nil && json.Unmarshal(body, &scope) == nil {
+			functions = append(functions, scope.Service, scope.FunctionName)
+			if bodyNamespace && len(scope.Namespace) > 0 {
+				namespace = scope.Namespace
+			}
+		}
+	}
+
+	if len(namespace) == 0 {
+		namespace = handlers.DefaultNamespace
+	}
+
+	requests := []Request{}
+	seen := map[string]bool{}
+	for _, function := range functions {
+		if len(function) == 0 || seen[function] {
+			continue
+		}
+		seen[function] = true
+
+		requests = append(requests, Request{Action: action, Namespace: namespace, Function: function})
+	}
+
+	// a request which names no function, such as listing functions or secrets
+	if len(requests) == 0 {
+		requests = append(requests, Request{Action: action, Namespace: namespace})
+	}
+
+	return requests
+}
@@ -0,0 +1,265 @@
+// Package authorization checks that the authenticated caller of a system endpoint holds a
+// role which permits the action of the request, in the namespace and for the function it
+// names.
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/openfaas/faas-swarm/authentication"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Action is an operation on the provider which a role may permit
+type Action string
+
+// Actions performed by the system endpoints
+const (
+	ReadFunctions   Action = "functions:read"
+	DeployFunctions Action = "functions:deploy"
+	DeleteFunctions Action = "functions:delete"
+	ScaleFunctions  Action = "functions:scale"
+	ReadSecrets     Action = "secrets:read"
+	WriteSecrets    Action = "secrets:write"
+	DeleteSecrets   Action = "secrets:delete"
+	ReadLogs        Action = "logs:read"
+	ReadNamespaces  Action = "namespaces:read"
+	ReadInfo        Action = "info:read"
+
+	// AllActions permits every action
+	AllActions Action = "*"
+)
+
+var knownActions = map[Action]bool{
+	ReadFunctions: true, DeployFunctions: true, DeleteFunctions: true, ScaleFunctions: true,
+	ReadSecrets: true, WriteSecrets: true, DeleteSecrets: true,
+	ReadLogs: true, ReadNamespaces: true, ReadInfo: true, AllActions: true,
+}
+
+// Built-in roles, which a policy may redefine
+const (
+	RoleViewer   = "viewer"
+	RoleDeployer = "deployer"
+	RoleAdmin    = "admin"
+)
+
+// builtinRoles are the roles available to every policy
+var builtinRoles = map[string][]Action{
+	RoleViewer:   {ReadFunctions, ReadLogs, ReadNamespaces, ReadInfo},
+	RoleDeployer: {ReadFunctions, ReadLogs, ReadNamespaces, ReadInfo, DeployFunctions, ScaleFunctions, ReadSecrets, WriteSecrets},
+	RoleAdmin:    {AllActions},
+}
+
+// Binding grants a role to callers, optionally only within namespaces or for functions
+// whose names start with one of a set of prefixes
+type Binding struct {
+	Role string `yaml:"role"`
+	// Subjects are principals qualified by their method: "basic:<user>", "bearer:<token name>",
+	// "jwt:<subject>" or "certificate:<common name>"
+	Subjects []string `yaml:"subjects"`
+	// Groups match the values of the groups claim of a JWT
+	Groups []string `yaml:"groups"`
+	// Namespaces limit the binding to these namespaces, all namespaces when empty
+	Namespaces []string `yaml:"namespaces"`
+	// Functions limit the binding to requests for a function whose name starts with one of
+	// these prefixes, all requests when empty
+	Functions []string `yaml:"functions"`
+}
+
+// Policy maps callers to roles
+type Policy struct {
+	Roles    map[string][]Action `yaml:"roles"`
+	Bindings []Binding           `yaml:"bindings"`
+}
+
+// ReadPolicyFile reads a YAML or JSON policy from a file
+func ReadPolicyFile(file string) (*Policy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RBAC policy: %s", err)
+	}
+
+	return ParsePolicy(data)
+}
+
+// ConfigReader is the subset of the Docker client.ConfigAPIClient needed to read a policy
+// from a Swarm config. This interface is satisfied by *client.Client
+type ConfigReader interface {
+	ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error)
+}
+
+// ReadPolicyConfig reads a YAML or JSON policy from the Swarm config with the given name
+func ReadPolicyConfig(c ConfigReader, name string) (*Policy, error) {
+	configFilter := filters.NewArgs()
+	configFilter.Add("name", name)
+
+	configs, err := c.ConfigList(context.Background(), types.ConfigListOptions{Filters: configFilter})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RBAC policy: %s", err)
+	}
+
+	// the name filter matches on prefix, so check for the exact config name
+	for _, config := range configs {
+		if config.Spec.Name == name {
+			return ParsePolicy(config.Spec.Data)
+		}
+	}
+
+	return nil, fmt.Errorf("unable to read RBAC policy: no Swarm config named %s", name)
+}
+
+// ParsePolicy parses and validates a YAML or JSON policy
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("unable to parse RBAC policy: %s", err)
+	}
+
+	roles := map[string][]Action{}
+	for name, actions := range builtinRoles {
+		roles[name] = actions
+	}
+
+	for name, actions := range policy.Roles {
+		for _, action := range actions {
+			if !knownActions[action] {
+				return nil, fmt.Errorf("invalid RBAC policy: role %s has unknown action %q", name, action)
+			}
+		}
+		roles[name] = actions
+	}
+	policy.Roles = roles
+
+	for i, binding := range policy.Bindings {
+		if _, ok := roles[binding.Role]; !ok {
+			return nil, fmt.Errorf("invalid RBAC policy: binding %d has unknown role %q", i, binding.Role)
+		}
+
+		if len(binding.Subjects) == 0 && len(binding.Groups) == 0 {
+			return nil, fmt.Errorf("invalid RBAC policy: binding %d has no subjects or groups", i)
+		}
+
+		for _, subject := range binding.Subjects {
+			method := strings.SplitN(subject, ":", 2)
+			if len(method) != 2 || len(method[1]) == 0 || !authentication.IsMethod(method[0]) {
+				return nil, fmt.Errorf("invalid RBAC policy: binding %d has subject %q, use <method>:<name>, i.e. basic:admin", i, subject)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Request is an action on a namespace and, when the request names one, a function
+type Request struct {
+	Action    Action
+	Namespace string
+	Function  string
+}
+
+// Allowed returns true when a binding of the principal permits the request
+func (p *Policy) Allowed(principal *authentication.Principal, request Request) bool {
+	if principal == nil {
+		return false
+	}
+
+	for _, binding := range p.Bindings {
+		if binding.matches(principal) && binding.permits(request) && p.rolePermits(binding.Role, request.Action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Summary describes the roles of each binding, for the startup log
+func (p *Policy) Summary() string {
+	roles := []string{}
+	for _, binding := range p.Bindings {
+		roles = append(roles, fmt.Sprintf("%s: %s", binding.Role, strings.Join(append(binding.Subjects, binding.Groups...), ",")))
+	}
+	sort.Strings(roles)
+
+	return strings.Join(roles, "; ")
+}
+
+func (p *Policy) rolePermits(role string, action Action) bool {
+	for _, permitted := range p.Roles[role] {
+		if permitted == AllActions || permitted == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b Binding) matches(principal *authentication.Principal) bool {
+	for _, subject := range b.Subjects {
+		if subject == principal.Subject() {
+			return true
+		}
+	}
+
+	for _, group := range principalGroups(principal) {
+		for _, bound := range b.Groups {
+			if bound == group {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (b Binding) permits(request Request) bool {
+	if len(b.Namespaces) > 0 && !contains(b.Namespaces, request.Namespace) {
+		return false
+	}
+
+	if len(b.Functions) == 0 {
+		return true
+	}
+
+	for _, prefix := range b.Functions {
+		if len(request.Function) > 0 && strings.HasPrefix(request.Function, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// principalGroups returns the groups claim of a JWT
+func principalGroups(principal *authentication.Principal) []string {
+	groups := []string{}
+
+	switch claim := principal.Claims["groups"].(type) {
+	case string:
+		groups = append(groups, claim)
+	case []interface{}:
+		for _, group := range claim {
+			if name, ok := group.(string); ok {
+				groups = append(groups, name)
+			}
+		}
+	}
+
+	return groups
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
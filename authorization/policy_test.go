@@ -0,0 +1,158 @@
+package authorization
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-swarm/authentication"
+	"github.com/openfaas/faas-swarm/handlers"
+)
+
+const testPolicy = `
+roles:
+  oncall: [functions:read, logs:read]
+bindings:
+  - role: oncall
+    subjects: ["basic:pager"]
+  - role: deployer
+    subjects: ["bearer:ci-token"]
+    namespaces: [team-a]
+    functions: [team-a-]
+  - role: admin
+    groups: [platform]
+`
+
+func parseTestPolicy(t *testing.T) *Policy {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return policy
+}
+
+func Test_Policy_Allowed(t *testing.T) {
+	policy := parseTestPolicy(t)
+
+	pager := &authentication.Principal{Name: "pager", Method: authentication.MethodBasic}
+	ci := &authentication.Principal{Name: "ci-token", Method: authentication.MethodBearer}
+	impostor := &authentication.Principal{Name: "ci-token", Method: authentication.MethodJWT}
+	platform := &authentication.Principal{Name: "bob", Method: authentication.MethodJWT, Claims: map[string]interface{}{"groups": []interface{}{"platform"}}}
+
+	cases := []struct {
+		name      string
+		principal *authentication.Principal
+		request   Request
+		want      bool
+	}{
+		{"on-call reads functions", pager, Request{Action: ReadFunctions, Namespace: "openfaas-fn"}, true},
+		{"on-call can not delete", pager, Request{Action: DeleteFunctions, Namespace: "openfaas-fn", Function: "echo"}, false},
+		{"ci deploys with its prefix", ci, Request{Action: DeployFunctions, Namespace: "team-a", Function: "team-a-api"}, true},
+		{"ci can not deploy other functions", ci, Request{Action: DeployFunctions, Namespace: "team-a", Function: "billing"}, false},
+		{"ci can not deploy to other namespaces", ci, Request{Action: DeployFunctions, Namespace: "openfaas-fn", Function: "team-a-api"}, false},
+		{"ci can not delete", ci, Request{Action: DeleteFunctions, Namespace: "team-a", Function: "team-a-api"}, false},
+		{"same name with another method", impostor, Request{Action: DeployFunctions, Namespace: "team-a", Function: "team-a-api"}, false},
+		{"group admin deletes", platform, Request{Action: DeleteFunctions, Namespace: "openfaas-fn", Function: "echo"}, true},
+		{"unknown caller", &authentication.Principal{Name: "eve", Method: authentication.MethodBasic}, Request{Action: ReadFunctions}, false},
+		{"no caller", nil, Request{Action: ReadFunctions}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := policy.Allowed(c.principal, c.request); got != c.want {
+				t.Errorf("want: %v, got: %v", c.want, got)
+			}
+		})
+	}
+}
+
+func Test_ParsePolicy_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown role":   "bindings:\n  - role: owner\n    subjects: [\"jwt:alice\"]\n",
+		"unqualified":    "bindings:\n  - role: admin\n    subjects: [alice]\n",
+		"unknown method": "bindings:\n  - role: admin\n    subjects: [\"oauth:alice\"]\n",
+		"unknown action": "roles:\n  oncall: [functions:destroy]\n",
+		"no subjects":    "bindings:\n  - role: admin\n",
+		"unknown field":  "binding:\n  - role: admin\n",
+	}
+
+	for name, policy := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParsePolicy([]byte(policy)); err == nil {
+				t.Errorf("want an error")
+			}
+		})
+	}
+}
+
+func Test_Require(t *testing.T) {
+	policy := parseTestPolicy(t)
+	ci := &authentication.Principal{Name: "ci-token", Method: authentication.MethodBearer}
+
+	cases := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+	}{
+		{"deploy within scope", http.MethodPost, "/system/functions", `{"service":"team-a-api","namespace":"team-a"}`, http.StatusOK},
+		{"deploy outside the prefix", http.MethodPost, "/system/functions", `{"service":"billing","namespace":"team-a"}`, http.StatusForbidden},
+		{"update with the namespace in the query", http.MethodPut, "/system/functions?namespace=team-a", `{"service":"team-a-api"}`, http.StatusOK},
+		{"delete", http.MethodDelete, "/system/functions?namespace=team-a", `{"functionName":"team-a-api"}`, http.StatusForbidden},
+	}
+
+	rule := Rule{
+		Actions:       map[string]Action{http.MethodPost: DeployFunctions, http.MethodPut: DeployFunctions, http.MethodDelete: DeleteFunctions},
+		BodyNamespace: true,
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var body []byte
+			handler := Require(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+			}, policy, rule)
+
+			r := httptest.NewRequest(c.method, c.url, strings.NewReader(c.body))
+			r = r.WithContext(authentication.WithPrincipal(r.Context(), ci))
+			w := httptest.NewRecorder()
+
+			handler(w, r)
+
+			if w.Code != c.wantStatus {
+				t.Fatalf("want status: %d, got: %d", c.wantStatus, w.Code)
+			}
+
+			if c.wantStatus == http.StatusOK && string(body) != c.body {
+				t.Errorf("want the body passed on: %s, got: %s", c.body, body)
+			}
+		})
+	}
+}
+
+func Test_Require_FunctionPath(t *testing.T) {
+	policy := parseTestPolicy(t)
+	handler := Require(func(w http.ResponseWriter, r *http.Request) {}, policy, Rule{Actions: map[string]Action{http.MethodPost: ScaleFunctions}})
+
+	r := httptest.NewRequest(http.MethodPost, "/system/scale-function/billing?namespace=team-a", strings.NewReader(`{"replicas":2}`))
+	r = mux.SetURLVars(r, map[string]string{"name": "billing"})
+	r = r.WithContext(authentication.WithPrincipal(r.Context(), &authentication.Principal{Name: "ci-token"}))
+	w := httptest.NewRecorder()
+
+	handler(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("want status: %d, got: %d", http.StatusForbidden, w.Code)
+	}
+
+	res := handlers.ErrorResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != handlers.ErrorCodeForbidden {
+		t.Errorf("want error code: %s, got: %q, %v", handlers.ErrorCodeForbidden, res.Code, err)
+	}
+}
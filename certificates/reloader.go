@@ -0,0 +1,146 @@
+// Package certificates serves the provider's TLS certificate and client CAs from files,
+// reloading them when the files change so that rotated certificates are used without a
+// restart.
+package certificates
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+)
+
+// Reloader holds the certificate, key and optional client CA bundle read from files
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+
+	mu        sync.RWMutex
+	contents  []byte
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewReloader reads the certificate and key, and the client CA bundle when clientCAFile is
+// set. Clients must present a certificate signed by one of the CAs when clientAuth is
+// tls.RequireAndVerifyClientCert, or may when it is tls.VerifyClientCertIfGiven.
+func NewReloader(certFile string, keyFile string, clientCAFile string, clientAuth tls.ClientAuthType) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		clientAuth:   clientAuth,
+	}
+
+	if len(clientCAFile) == 0 {
+		r.clientAuth = tls.NoClientCert
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the files again and returns true when they changed. When the new files are
+// invalid an error is returned and the previous certificate stays in use.
+func (r *Reloader) Reload() (bool, error) {
+	certPEM, err := ioutil.ReadFile(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("unable to read TLS certificate: %s", err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("unable to read TLS key: %s", err)
+	}
+
+	var caPEM []byte
+	if len(r.clientCAFile) > 0 {
+		caPEM, err = ioutil.ReadFile(r.clientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("unable to read TLS client CA: %s", err)
+		}
+	}
+
+	contents := bytes.Join([][]byte{certPEM, keyPEM, caPEM}, nil)
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(contents, r.contents)
+	r.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("invalid TLS certificate or key: %s", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if len(caPEM) > 0 {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return false, fmt.Errorf("invalid TLS client CA: no certificates found in %s", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.contents = contents
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Run reloads the files every interval until the context is cancelled
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.Reload()
+			if err != nil {
+				log.Printf("Error reloading TLS certificates, keeping the previous certificates: %s\n", err)
+			} else if changed {
+				log.Printf("Reloaded TLS certificates\n")
+			}
+		}
+	}
+}
+
+// TLSConfig returns a server config which uses the current certificate and client CAs
+// for each new connection
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.configForClient,
+	}
+}
+
+func (r *Reloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+		ClientCAs:    r.clientCAs,
+		ClientAuth:   r.clientAuth,
+		NextProtos:   []string{"http/1.1"},
+	}, nil
+}
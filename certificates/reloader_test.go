@@ -0,0 +1,173 @@
+package certificates
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// makeCert creates a certificate signed by parent, or a self-signed CA when parent is nil
+func makeCert(t *testing.T, name string, parent *testCert) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("unable to write %s: %s", path, err)
+	}
+}
+
+func startServer(t *testing.T, reloader *Reloader) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = reloader.TLSConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func makeClient(ca testCert, clientCert *testCert) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	config := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		pair, _ := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+func Test_Reloader_MutualTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "faas-swarm-tls")
+	defer os.RemoveAll(dir)
+
+	ca := makeCert(t, "ca", nil)
+	server := makeCert(t, "provider", &ca)
+	client := makeCert(t, "gateway", &ca)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "cert"), filepath.Join(dir, "key"), filepath.Join(dir, "ca")
+	writeFile(t, certFile, server.certPEM)
+	writeFile(t, keyFile, server.keyPEM)
+	writeFile(t, caFile, ca.certPEM)
+
+	reloader, err := NewReloader(certFile, keyFile, caFile, tls.RequireAndVerifyClientCert)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	url := startServer(t, reloader).URL
+
+	if _, err := makeClient(ca, nil).Get(url); err == nil {
+		t.Errorf("want a request without a client certificate to fail")
+	}
+
+	res, err := makeClient(ca, &client).Get(url)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("want a request with a client certificate to succeed, got: %v", err)
+	}
+}
+
+func Test_Reloader_Rotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "faas-swarm-tls")
+	defer os.RemoveAll(dir)
+
+	oldCA := makeCert(t, "old-ca", nil)
+	oldServer := makeCert(t, "provider", &oldCA)
+
+	certFile, keyFile := filepath.Join(dir, "cert"), filepath.Join(dir, "key")
+	writeFile(t, certFile, oldServer.certPEM)
+	writeFile(t, keyFile, oldServer.keyPEM)
+
+	reloader, err := NewReloader(certFile, keyFile, "", tls.RequireAndVerifyClientCert)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	url := startServer(t, reloader).URL
+
+	if _, err := makeClient(oldCA, nil).Get(url); err != nil {
+		t.Fatalf("want the old certificate to be served, got: %s", err)
+	}
+
+	if changed, err := reloader.Reload(); changed || err != nil {
+		t.Errorf("want no change for unchanged files, got: %v, %v", changed, err)
+	}
+
+	newCA := makeCert(t, "new-ca", nil)
+	newServer := makeCert(t, "provider", &newCA)
+	writeFile(t, certFile, newServer.certPEM)
+	writeFile(t, keyFile, []byte("not a key"))
+
+	if _, err := reloader.Reload(); err == nil {
+		t.Errorf("want an error for an invalid key")
+	}
+
+	writeFile(t, keyFile, newServer.keyPEM)
+	if changed, err := reloader.Reload(); !changed || err != nil {
+		t.Fatalf("want the rotated certificate to be loaded, got: %v, %v", changed, err)
+	}
+
+	if _, err := makeClient(newCA, nil).Get(url); err != nil {
+		t.Errorf("want the rotated certificate to be served, got: %s", err)
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// ScaleTargetLabel sets the load per replica the autoscaler aims for, functions without
+// this label are not autoscaled
+const ScaleTargetLabel = "com.openfaas.scale.target"
+
+// ScaleTypeLabel selects the load the autoscaler measures, either "rps" (default) for
+// requests per second or "capacity" for in-flight requests
+const ScaleTypeLabel = "com.openfaas.scale.type"
+
+const (
+	scaleTypeRPS      = "rps"
+	scaleTypeCapacity = "capacity"
+)
+
+// AutoscalerConfig controls how often and how quickly the Autoscaler changes replicas
+type AutoscalerConfig struct {
+	// Interval is how often load is sampled and replicas are reconciled
+	Interval time.Duration
+	// ScaleUpCooldown is the minimum time after scaling a function before it is scaled up again
+	ScaleUpCooldown time.Duration
+	// ScaleDownStabilisation is the window over which recommendations are remembered,
+	// a function is only scaled down to the highest recommendation in the window
+	ScaleDownStabilisation time.Duration
+	// MaxReplicas is the maximum replicas of functions which do not set MaxScaleLabel,
+	// DefaultMaxReplicas when it is not set
+	MaxReplicas int
+}
+
+// Autoscaler is a background controller that sets the replicas of a function from the
+// load measured at the function proxy. The target replica count is the load divided by the
+// com.openfaas.scale.target label, clamped to com.openfaas.scale.min and com.openfaas.scale.max.
+type Autoscaler struct {
+	lister  ServiceLister
+	query   ServiceQuery
+	tracker *InvocationTracker
+	config  AutoscalerConfig
+
+	functions map[string]*autoscalerState
+	now       func() time.Time
+}
+
+type autoscalerState struct {
+	lastCount       uint64
+	lastSample      time.Time
+	lastScaled      time.Time
+	recommendations []recommendation
+}
+
+type recommendation struct {
+	at       time.Time
+	replicas uint64
+}
+
+// NewAutoscaler creates an Autoscaler which reads load from the tracker and scales functions
+// through the ServiceQuery
+func NewAutoscaler(lister ServiceLister, query ServiceQuery, tracker *InvocationTracker, config AutoscalerConfig) *Autoscaler {
+	if config.MaxReplicas <= 0 {
+		config.MaxReplicas = DefaultMaxReplicas
+	}
+
+	return &Autoscaler{
+		lister:    lister,
+		query:     query,
+		tracker:   tracker,
+		config:    config,
+		functions: map[string]*autoscalerState{},
+		now:       time.Now,
+	}
+}
+
+// Run reconciles replicas every Interval until the context is cancelled
+func (a *Autoscaler) Run(ctx context.Context) {
+	log.Printf("Autoscaler: interval: %s, scale up cooldown: %s, scale down stabilisation: %s\n",
+		a.config.Interval, a.config.ScaleUpCooldown, a.config.ScaleDownStabilisation)
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.reconcile(ctx)
+		}
+	}
+}
+
+func (a *Autoscaler) reconcile(ctx context.Context) {
+	services, err := a.lister.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		log.Printf("Autoscaler: error listing services: %s\n", err)
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, service := range services {
+		target, ok := scaleTarget(service)
+		if !ok {
+			continue
+		}
+
+		name := service.Spec.Name
+		seen[name] = true
+
+		state, ok := a.functions[name]
+		if !ok {
+			state = &autoscalerState{}
+			a.functions[name] = state
+		}
+
+		a.scale(service, target, state)
+	}
+
+	// forget functions which were removed or are no longer autoscaled
+	for name := range a.functions {
+		if !seen[name] {
+			delete(a.functions, name)
+		}
+	}
+}
+
+func (a *Autoscaler) scale(service swarm.Service, target float64, state *autoscalerState) {
+	name := service.Spec.Name
+	now := a.now()
+
+	load, ok := a.load(name, service.Spec.Labels[ScaleTypeLabel], state, now)
+	if !ok {
+		return
+	}
+
+	current := *service.Spec.Mode.Replicated.Replicas
+	// functions at zero replicas are left to scale from zero
+	if current == 0 {
+		return
+	}
+
+	minReplicas, maxReplicas := getScaleBounds(service.Spec.Labels, a.config.MaxReplicas)
+	desired := clampReplicas(uint64(math.Ceil(load/target)), minReplicas, maxReplicas)
+
+	state.recommendations = append(state.recommendations, recommendation{at: now, replicas: desired})
+	state.recommendations = trimRecommendations(state.recommendations, now.Add(-a.config.ScaleDownStabilisation))
+
+	if desired < current {
+		// only scale down as far as the highest recommendation in the window
+		for _, r := range state.recommendations {
+			if r.replicas > desired {
+				desired = r.replicas
+			}
+		}
+	}
+
+	if desired == current {
+		return
+	}
+
+	if desired > current && now.Sub(state.lastScaled) < a.config.ScaleUpCooldown {
+		return
+	}
+
+	log.Printf("Autoscaler: scaling %s from %d to %d replicas, load: %.2f, target: %.2f\n",
+		name, current, desired, load, target)
+
+	if err := a.query.SetReplicas(name, desired); err != nil {
+		log.Printf("Autoscaler: error scaling %s: %s\n", name, err)
+		return
+	}
+
+	state.lastScaled = now
+}
+
+// load returns the current load of a function for the scale type, the second value is false
+// until enough samples have been taken to measure the load.
+func (a *Autoscaler) load(service string, scaleType string, state *autoscalerState, now time.Time) (float64, bool) {
+	if scaleType == scaleTypeCapacity {
+		return float64(a.tracker.InFlight(service)), true
+	}
+
+	count := a.tracker.Invoked(service)
+	defer func() {
+		state.lastCount = count
+		state.lastSample = now
+	}()
+
+	if state.lastSample.IsZero() {
+		return 0, false
+	}
+
+	// the count starts again from zero when the function has been pruned from the tracker
+	if count < state.lastCount {
+		return 0, false
+	}
+
+	elapsed := now.Sub(state.lastSample).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	return float64(count-state.lastCount) / elapsed, true
+}
+
+// scaleTarget returns the target load per replica of an autoscaled function service
+func scaleTarget(service swarm.Service) (float64, bool) {
+	if service.Spec.TaskTemplate.ContainerSpec == nil ||
+		len(service.Spec.TaskTemplate.ContainerSpec.Labels["function"]) == 0 {
+		return 0, false
+	}
+
+	replicated := service.Spec.Mode.Replicated
+	if replicated == nil || replicated.Replicas == nil {
+		return 0, false
+	}
+
+	value, ok := service.Spec.Labels[ScaleTargetLabel]
+	if !ok {
+		return 0, false
+	}
+
+	target, err := strconv.ParseFloat(value, 64)
+	if err != nil || target <= 0 {
+		log.Printf("Autoscaler: invalid %s value for %s: %q\n", ScaleTargetLabel, service.Spec.Name, value)
+		return 0, false
+	}
+
+	return target, true
+}
+
+func clampReplicas(replicas, minReplicas, maxReplicas uint64) uint64 {
+	if minReplicas < 1 {
+		minReplicas = 1
+	}
+
+	if replicas < minReplicas {
+		return minReplicas
+	}
+
+	if maxReplicas >= minReplicas && replicas > maxReplicas {
+		return maxReplicas
+	}
+
+	return replicas
+}
+
+// trimRecommendations drops recommendations made before the start of the window
+func trimRecommendations(recommendations []recommendation, start time.Time) []recommendation {
+	trimmed := recommendations[:0]
+	for _, r := range recommendations {
+		if !r.at.Before(start) {
+			trimmed = append(trimmed, r)
+		}
+	}
+
+	return trimmed
+}
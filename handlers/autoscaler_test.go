@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func makeAutoscaledService(name string, replicas uint64, labels map[string]string) swarm.Service {
+	return makeIdlerService(name, replicas, labels, time.Time{})
+}
+
+func Test_Autoscaler_ScalesOnRequestRate(t *testing.T) {
+	now := time.Now()
+	labels := map[string]string{ScaleTargetLabel: "10", MinScaleLabel: "1", MaxScaleLabel: "5"}
+	services := []swarm.Service{makeAutoscaledService("echo", 1, labels)}
+
+	query := &fakeServiceQuery{replicas: map[string]uint64{"echo": 1}}
+	tracker := NewInvocationTracker()
+
+	autoscaler := NewAutoscaler(fakeIdlerLister{services}, query, tracker, AutoscalerConfig{
+		Interval:               10 * time.Second,
+		ScaleUpCooldown:        30 * time.Second,
+		ScaleDownStabilisation: 5 * time.Minute,
+	})
+	autoscaler.now = func() time.Time { return now }
+
+	// the first sample sets the baseline
+	autoscaler.reconcile(context.Background())
+	if got := query.replicas["echo"]; got != 1 {
+		t.Fatalf("want replicas after first sample: %d, got: %d", 1, got)
+	}
+
+	// 350 requests over 10s is 35 rps, which needs 4 replicas at 10 rps each
+	for i := 0; i < 350; i++ {
+		tracker.start("echo", now)
+		tracker.done("echo")
+	}
+	now = now.Add(10 * time.Second)
+	autoscaler.reconcile(context.Background())
+
+	if got := query.replicas["echo"]; got != 4 {
+		t.Fatalf("want replicas: %d, got: %d", 4, got)
+	}
+}
+
+func Test_Autoscaler_ClampsToMaxReplicas(t *testing.T) {
+	now := time.Now()
+	labels := map[string]string{ScaleTargetLabel: "1", ScaleTypeLabel: "capacity", MaxScaleLabel: "3"}
+	services := []swarm.Service{makeAutoscaledService("echo", 1, labels)}
+
+	query := &fakeServiceQuery{replicas: map[string]uint64{"echo": 1}}
+	tracker := NewInvocationTracker()
+	for i := 0; i < 10; i++ {
+		tracker.start("echo", now)
+	}
+
+	autoscaler := NewAutoscaler(fakeIdlerLister{services}, query, tracker, AutoscalerConfig{
+		Interval:               10 * time.Second,
+		ScaleDownStabilisation: 5 * time.Minute,
+	})
+	autoscaler.now = func() time.Time { return now }
+	autoscaler.reconcile(context.Background())
+
+	if got := query.replicas["echo"]; got != 3 {
+		t.Fatalf("want replicas: %d, got: %d", 3, got)
+	}
+}
+
+func Test_Autoscaler_StabilisesScaleDown(t *testing.T) {
+	now := time.Now()
+	labels := map[string]string{ScaleTargetLabel: "1", ScaleTypeLabel: "capacity"}
+	service := makeAutoscaledService("echo", 4, labels)
+
+	query := &fakeServiceQuery{replicas: map[string]uint64{"echo": 4}}
+	tracker := NewInvocationTracker()
+	for i := 0; i < 4; i++ {
+		tracker.start("echo", now)
+	}
+
+	autoscaler := NewAutoscaler(fakeIdlerLister{[]swarm.Service{service}}, query, tracker, AutoscalerConfig{
+		Interval:               10 * time.Second,
+		ScaleDownStabilisation: time.Minute,
+	})
+	autoscaler.now = func() time.Time { return now }
+	autoscaler.reconcile(context.Background())
+
+	// load drops to a single in-flight request
+	for i := 0; i < 3; i++ {
+		tracker.done("echo")
+	}
+
+	now = now.Add(30 * time.Second)
+	autoscaler.reconcile(context.Background())
+	if got := query.replicas["echo"]; got != 4 {
+		t.Fatalf("want replicas within the stabilisation window: %d, got: %d", 4, got)
+	}
+
+	now = now.Add(time.Minute)
+	autoscaler.reconcile(context.Background())
+	if got := query.replicas["echo"]; got != 1 {
+		t.Fatalf("want replicas after the stabilisation window: %d, got: %d", 1, got)
+	}
+}
+
+func Test_Autoscaler_IgnoresFunctionsWithoutTarget(t *testing.T) {
+	services := []swarm.Service{makeAutoscaledService("echo", 1, nil)}
+	query := &fakeServiceQuery{replicas: map[string]uint64{"echo": 1}}
+	tracker := NewInvocationTracker()
+	for i := 0; i < 10; i++ {
+		tracker.start("echo", time.Now())
+	}
+
+	autoscaler := NewAutoscaler(fakeIdlerLister{services}, query, tracker, AutoscalerConfig{})
+	autoscaler.reconcile(context.Background())
+
+	if len(autoscaler.functions) != 0 {
+		t.Errorf("want no autoscaled functions, got: %d", len(autoscaler.functions))
+	}
+
+	if got := query.replicas["echo"]; got != 1 {
+		t.Errorf("want replicas: %d, got: %d", 1, got)
+	}
+}
+
+func Test_Autoscaler_IgnoresRestoredCounts(t *testing.T) {
+	now := time.Now()
+	labels := map[string]string{ScaleTargetLabel: "10", MinScaleLabel: "1", MaxScaleLabel: "5"}
+	services := []swarm.Service{makeAutoscaledService("echo", 1, labels)}
+
+	query := &fakeServiceQuery{replicas: map[string]uint64{"echo": 1}}
+	tracker := NewInvocationTracker()
+
+	autoscaler := NewAutoscaler(fakeIdlerLister{services}, query, tracker, AutoscalerConfig{
+		Interval:               10 * time.Second,
+		ScaleUpCooldown:        30 * time.Second,
+		ScaleDownStabilisation: 5 * time.Minute,
+	})
+	autoscaler.now = func() time.Time { return now }
+
+	autoscaler.reconcile(context.Background())
+
+	// counts persisted before a restart are restored after the first sample
+	tracker.Restore(map[string]uint64{"echo": 100000})
+	now = now.Add(10 * time.Second)
+	autoscaler.reconcile(context.Background())
+
+	if got := query.replicas["echo"]; got != 1 {
+		t.Errorf("want replicas: %d, got: %d", 1, got)
+	}
+}
+
+func Test_Autoscaler_IgnoresPrunedCounts(t *testing.T) {
+	now := time.Now()
+	labels := map[string]string{ScaleTargetLabel: "10", MinScaleLabel: "1", MaxScaleLabel: "5"}
+	services := []swarm.Service{makeAutoscaledService("echo", 1, labels)}
+
+	query := &fakeServiceQuery{replicas: map[string]uint64{"echo": 1}}
+	tracker := NewInvocationTracker()
+
+	autoscaler := NewAutoscaler(fakeIdlerLister{services}, query, tracker, AutoscalerConfig{
+		Interval:               10 * time.Second,
+		ScaleUpCooldown:        30 * time.Second,
+		ScaleDownStabilisation: 5 * time.Minute,
+	})
+	autoscaler.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		tracker.start("echo", now)
+		tracker.done("echo")
+	}
+	autoscaler.reconcile(context.Background())
+
+	// the count starts again from zero once the function is pruned from the tracker
+	if err := tracker.Prune(context.Background(), fakeIdlerLister{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	now = now.Add(10 * time.Second)
+	autoscaler.reconcile(context.Background())
+
+	if got := query.replicas["echo"]; got != 1 {
+		t.Errorf("want replicas: %d, got: %d", 1, got)
+	}
+}
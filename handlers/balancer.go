@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// LoadBalancerLabel selects the load balancing strategy for a function, overriding the
+// provider's default
+const LoadBalancerLabel = "com.openfaas.load-balancer"
+
+// Load balancing strategies, which pick one of the running tasks of a function
+const (
+	// RoundRobin picks each task in turn
+	RoundRobin = "round-robin"
+	// LeastConnections picks the task with the fewest requests in flight
+	LeastConnections = "least-connections"
+	// PowerOfTwoChoices picks two tasks at random and uses the one with fewer requests in flight
+	PowerOfTwoChoices = "p2c"
+)
+
+// namespaceNetworkTTL is how long the network of a namespace is cached for, so that it is
+// not looked up on every request
+const namespaceNetworkTTL = time.Minute
+
+// IsLoadBalancerStrategy returns true when strategy names a supported load balancing strategy
+func IsLoadBalancerStrategy(strategy string) bool {
+	switch strategy {
+	case RoundRobin, LeastConnections, PowerOfTwoChoices:
+		return true
+	}
+
+	return false
+}
+
+// Balancer picks the task of a function that a request is proxied to. Endpoints are the IPs
+// of the tasks Swarm reports as running. Swarm holds a task with a healthcheck in the
+// starting state until it passes, and fails the task when it turns unhealthy, so failing
+// tasks are excluded too.
+type Balancer struct {
+	tasks    TaskLister
+	networks NetworkLister
+	// networkLabel marks the network of the default namespace
+	networkLabel string
+	strategy     string
+
+	mu                sync.Mutex
+	next              map[string]uint64
+	inFlight          map[string]int64
+	rand              *rand.Rand
+	namespaceNetworks map[string]cachedNetwork
+}
+
+// cachedNetwork is the name of the network of a namespace, until it expires
+type cachedNetwork struct {
+	name    string
+	expires time.Time
+}
+
+// NewBalancer creates a Balancer, strategy is the default for functions without the
+// com.openfaas.load-balancer label. When it is empty only labelled functions are balanced
+// and other functions are resolved by VIP or DNSRR as before.
+// Tasks are reached on the network of the function's namespace.
+func NewBalancer(tasks TaskLister, networks NetworkLister, settings ProviderSettings, strategy string) *Balancer {
+	return &Balancer{
+		tasks:             tasks,
+		networks:          networks,
+		networkLabel:      settings.NetworkLabel,
+		strategy:          strategy,
+		next:              map[string]uint64{},
+		inFlight:          map[string]int64{},
+		rand:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		namespaceNetworks: map[string]cachedNetwork{},
+	}
+}
+
+// strategyFor returns the strategy used for the service, or an empty string when the
+// service is not balanced by the provider
+func (b *Balancer) strategyFor(service swarm.Service) string {
+	strategy, ok := service.Spec.Labels[LoadBalancerLabel]
+	if !ok {
+		return b.strategy
+	}
+
+	if !IsLoadBalancerStrategy(strategy) {
+		log.Printf("Unknown %s value %q for %s, using %q\n", LoadBalancerLabel, strategy, service.Spec.Name, b.strategy)
+		return b.strategy
+	}
+
+	return strategy
+}
+
+// namespaceNetwork returns the name of the network of the namespace, or an empty name when
+// the default namespace has no labelled network
+func (b *Balancer) namespaceNetwork(namespace string) (string, error) {
+	b.mu.Lock()
+	cached, ok := b.namespaceNetworks[namespace]
+	b.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.name, nil
+	}
+
+	network, err := lookupNamespaceNetwork(b.networks, namespace, b.networkLabel)
+	if err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	b.namespaceNetworks[namespace] = cachedNetwork{name: network, expires: time.Now().Add(namespaceNetworkTTL)}
+	b.mu.Unlock()
+
+	return network, nil
+}
+
+// serviceNetworks returns the names or IDs of the networks the tasks of the service are
+// attached to, falling back to the network of its namespace when its spec names none
+func (b *Balancer) serviceNetworks(service swarm.Service) ([]string, error) {
+	networks := []string{}
+	for _, attachment := range service.Spec.TaskTemplate.Networks {
+		networks = append(networks, attachment.Target)
+	}
+
+	if len(networks) > 0 {
+		return networks, nil
+	}
+
+	network, err := b.namespaceNetwork(namespaceFromLabels(service.Spec.Labels))
+	if err != nil || len(network) == 0 {
+		return nil, err
+	}
+
+	return []string{network}, nil
+}
+
+// endpoints returns the IPs of the running tasks of the service on the networks of its
+// spec, in a stable order
+func (b *Balancer) endpoints(ctx context.Context, service swarm.Service) ([]string, error) {
+	networks, err := b.serviceNetworks(service)
+	if err != nil {
+		return nil, err
+	}
+
+	taskFilter := filters.NewArgs()
+	taskFilter.Add("service", service.Spec.Name)
+	taskFilter.Add("desired-state", "running")
+
+	tasks, err := b.tasks.TaskList(ctx, types.TaskListOptions{Filters: taskFilter})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []string{}
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning || len(task.Status.Err) > 0 {
+			continue
+		}
+
+		if ip := taskIP(task, networks); len(ip) > 0 {
+			endpoints = append(endpoints, ip)
+		}
+	}
+
+	sort.Strings(endpoints)
+	return endpoints, nil
+}
+
+// pick returns the endpoint of the service chosen by the strategy
+func (b *Balancer) pick(ctx context.Context, service swarm.Service, strategy string) (string, error) {
+	endpoints, err := b.endpoints(ctx, service)
+	if err != nil {
+		return "", err
+	}
+
+	name := service.Spec.Name
+	if len(endpoints) == 0 {
+		return "", fmt.Errorf("could not resolve: %s, no running tasks", name)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch strategy {
+	case LeastConnections:
+		// start from the round-robin position so that ties are spread across tasks
+		offset := b.next[name]
+		b.next[name]++
+
+		chosen := endpoints[offset%uint64(len(endpoints))]
+		for i := range endpoints {
+			endpoint := endpoints[(offset+uint64(i))%uint64(len(endpoints))]
+			if b.inFlight[endpoint] < b.inFlight[chosen] {
+				chosen = endpoint
+			}
+		}
+
+		return chosen, nil
+
+	case PowerOfTwoChoices:
+		if len(endpoints) == 1 {
+			return endpoints[0], nil
+		}
+
+		first := b.rand.Intn(len(endpoints))
+		second := b.rand.Intn(len(endpoints) - 1)
+		if second >= first {
+			second++
+		}
+
+		if b.inFlight[endpoints[second]] < b.inFlight[endpoints[first]] {
+			return endpoints[second], nil
+		}
+		return endpoints[first], nil
+
+	default:
+		offset := b.next[name]
+		b.next[name]++
+
+		return endpoints[offset%uint64(len(endpoints))], nil
+	}
+}
+
+// acquire records a request in flight to the endpoint, the returned func must be called
+// when the request completes
+func (b *Balancer) acquire(endpoint string) func() {
+	b.mu.Lock()
+	b.inFlight[endpoint]++
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.inFlight[endpoint]--
+		if b.inFlight[endpoint] <= 0 {
+			delete(b.inFlight, endpoint)
+		}
+	}
+}
+
+// attachedTo reports whether the attachment is to one of the networks, named by ID or name
+func attachedTo(attachment swarm.NetworkAttachment, networks []string) bool {
+	for _, network := range networks {
+		if network == attachment.Network.ID || network == attachment.Network.Spec.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// taskIP returns the address of the task on the first of its networks named by ID or name in
+// networks, or on its first network other than the ingress network when networks is empty
+func taskIP(task swarm.Task, networks []string) string {
+	for _, attachment := range task.NetworksAttachments {
+		if attachment.Network.Spec.Ingress {
+			continue
+		}
+
+		if len(networks) > 0 && !attachedTo(attachment, networks) {
+			continue
+		}
+
+		for _, address := range attachment.Addresses {
+			if ip, _, err := net.ParseCIDR(address); err == nil {
+				return ip.String()
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/mux"
+)
+
+func makeBalancerTask(ip string, state swarm.TaskState) swarm.Task {
+	return swarm.Task{
+		Status: swarm.TaskStatus{State: state},
+		NetworksAttachments: []swarm.NetworkAttachment{
+			{
+				Network:   swarm.Network{Spec: swarm.NetworkSpec{Ingress: true}},
+				Addresses: []string{"10.255.0.9/16"},
+			},
+			{Addresses: []string{ip + "/24"}},
+		},
+	}
+}
+
+func makeBalancerLookup(strategy string, labels map[string]string, tasks ...swarm.Task) *FunctionLookup {
+	c := &fakeInventoryClient{
+		services: []swarm.Service{makeInventoryService("1", "echo", labels)},
+		tasks:    tasks,
+	}
+
+	return NewFunctionLookup(c, false).WithBalancer(NewBalancer(c, fakeNetworkLister{}, testSettings, strategy))
+}
+
+func Test_Balancer_EndpointsExcludeTasksNotRunning(t *testing.T) {
+	balancer := NewBalancer(&fakeInventoryClient{tasks: []swarm.Task{
+		makeBalancerTask("10.0.1.3", swarm.TaskStateRunning),
+		makeBalancerTask("10.0.1.4", swarm.TaskStateStarting),
+		makeBalancerTask("10.0.1.2", swarm.TaskStateRunning),
+	}}, fakeNetworkLister{}, testSettings, RoundRobin)
+
+	endpoints, err := balancer.endpoints(context.Background(), makeInventoryService("1", "echo", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"10.0.1.2", "10.0.1.3"}
+	if len(endpoints) != len(want) || endpoints[0] != want[0] || endpoints[1] != want[1] {
+		t.Errorf("want endpoints: %v, got: %v", want, endpoints)
+	}
+}
+
+func Test_Balancer_EndpointsOnNamespaceNetwork(t *testing.T) {
+	task := swarm.Task{
+		Status: swarm.TaskStatus{State: swarm.TaskStateRunning},
+		NetworksAttachments: []swarm.NetworkAttachment{
+			{
+				Network:   swarm.Network{Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "monitoring"}}},
+				Addresses: []string{"10.0.9.2/24"},
+			},
+			{
+				Network:   swarm.Network{Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "team-a-functions"}}},
+				Addresses: []string{"10.0.1.2/24"},
+			},
+		},
+	}
+	networks := fakeNetworkLister{networks: []types.NetworkResource{
+		{Name: "team-a-functions", Labels: map[string]string{namespaceNetworkLabel: "team-a"}},
+	}}
+
+	balancer := NewBalancer(&fakeInventoryClient{tasks: []swarm.Task{task}}, networks, testSettings, RoundRobin)
+	service := makeInventoryService("1", "team-a_echo", map[string]string{namespaceLabel: "team-a"})
+
+	endpoints, err := balancer.endpoints(context.Background(), service)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(endpoints) != 1 || endpoints[0] != "10.0.1.2" {
+		t.Errorf("want the endpoint on the namespace network, got: %v", endpoints)
+	}
+}
+
+func Test_Balancer_EndpointsOnServiceNetwork(t *testing.T) {
+	task := swarm.Task{
+		Status: swarm.TaskStatus{State: swarm.TaskStateRunning},
+		NetworksAttachments: []swarm.NetworkAttachment{
+			{
+				Network:   swarm.Network{ID: "n1", Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "monitoring"}}},
+				Addresses: []string{"10.0.9.2/24"},
+			},
+			{
+				Network:   swarm.Network{ID: "n2", Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "backend"}}},
+				Addresses: []string{"10.0.2.2/24"},
+			},
+		},
+	}
+	networks := fakeNetworkLister{networks: []types.NetworkResource{
+		{Name: "team-a-functions", Labels: map[string]string{namespaceNetworkLabel: "team-a"}},
+	}}
+
+	balancer := NewBalancer(&fakeInventoryClient{tasks: []swarm.Task{task}}, networks, testSettings, RoundRobin)
+	service := makeInventoryService("1", "team-a_echo", map[string]string{namespaceLabel: "team-a"})
+
+	for _, target := range []string{"backend", "n2"} {
+		service.Spec.TaskTemplate.Networks = []swarm.NetworkAttachmentConfig{{Target: target}}
+
+		endpoints, err := balancer.endpoints(context.Background(), service)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(endpoints) != 1 || endpoints[0] != "10.0.2.2" {
+			t.Errorf("want the endpoint on the network %s of the service, got: %v", target, endpoints)
+		}
+	}
+}
+
+func Test_Balancer_Strategies(t *testing.T) {
+	echo := makeInventoryService("1", "echo", nil)
+	tasks := []swarm.Task{
+		makeBalancerTask("10.0.1.2", swarm.TaskStateRunning),
+		makeBalancerTask("10.0.1.3", swarm.TaskStateRunning),
+	}
+
+	t.Run("round-robin picks each task in turn", func(t *testing.T) {
+		balancer := NewBalancer(&fakeInventoryClient{tasks: tasks}, fakeNetworkLister{}, testSettings, RoundRobin)
+
+		for _, want := range []string{"10.0.1.2", "10.0.1.3", "10.0.1.2"} {
+			got, _ := balancer.pick(context.Background(), echo, RoundRobin)
+			if got != want {
+				t.Errorf("want endpoint: %s, got: %s", want, got)
+			}
+		}
+	})
+
+	t.Run("least-connections picks the task with fewest requests in flight", func(t *testing.T) {
+		balancer := NewBalancer(&fakeInventoryClient{tasks: tasks}, fakeNetworkLister{}, testSettings, LeastConnections)
+		balancer.acquire("10.0.1.2")
+
+		for i := 0; i < 3; i++ {
+			if got, _ := balancer.pick(context.Background(), echo, LeastConnections); got != "10.0.1.3" {
+				t.Errorf("want endpoint: 10.0.1.3, got: %s", got)
+			}
+		}
+	})
+
+	t.Run("p2c picks the less loaded of two tasks", func(t *testing.T) {
+		balancer := NewBalancer(&fakeInventoryClient{tasks: tasks}, fakeNetworkLister{}, testSettings, PowerOfTwoChoices)
+		release := balancer.acquire("10.0.1.3")
+
+		for i := 0; i < 5; i++ {
+			if got, _ := balancer.pick(context.Background(), echo, PowerOfTwoChoices); got != "10.0.1.2" {
+				t.Errorf("want endpoint: 10.0.1.2, got: %s", got)
+			}
+		}
+
+		release()
+		if len(balancer.inFlight) != 0 {
+			t.Errorf("want no requests in flight after release, got: %v", balancer.inFlight)
+		}
+	})
+}
+
+func Test_FunctionLookup_BalancerStrategyFromLabel(t *testing.T) {
+	task := makeBalancerTask("10.0.1.2", swarm.TaskStateRunning)
+
+	u, err := makeBalancerLookup("", nil, task).Resolve("echo")
+	if err != nil || u.Host != "echo" {
+		t.Errorf("want VIP resolution without a strategy, got: %s, %v", u.Host, err)
+	}
+
+	u, err = makeBalancerLookup("", map[string]string{LoadBalancerLabel: RoundRobin}, task).Resolve("echo")
+	if err != nil || u.Host != "10.0.1.2" {
+		t.Errorf("want task IP from the label's strategy, got: %s, %v", u.Host, err)
+	}
+}
+
+func Test_FunctionLookup_DecorateProxyPinsEndpoint(t *testing.T) {
+	lookup := makeBalancerLookup(LeastConnections, nil, makeBalancerTask("10.0.1.2", swarm.TaskStateRunning))
+
+	var host string
+	var inFlight int64
+	handler := lookup.DecorateProxy(func(w http.ResponseWriter, r *http.Request) {
+		u, err := lookup.Resolve(mux.Vars(r)["name"])
+		if err != nil {
+			t.Fatalf("unexpected resolver error: %s", err)
+		}
+
+		host = u.Host
+		inFlight = lookup.balancer.inFlight[u.Host]
+	})
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/function/echo", nil), map[string]string{"name": "echo"})
+	handler(httptest.NewRecorder(), r)
+
+	if host != "10.0.1.2" {
+		t.Errorf("want request proxied to 10.0.1.2, got: %s", host)
+	}
+
+	if inFlight != 1 {
+		t.Errorf("want 1 request in flight while proxying, got: %d", inFlight)
+	}
+
+	if len(lookup.balancer.inFlight) != 0 {
+		t.Errorf("want no requests in flight after the request, got: %v", lookup.balancer.inFlight)
+	}
+}
+
+func Test_FunctionLookup_RejectsEndpointThatIsNotATask(t *testing.T) {
+	lookup := makeBalancerLookup(RoundRobin, nil, makeBalancerTask("10.0.1.2", swarm.TaskStateRunning))
+
+	if _, err := lookup.Resolve("echo@169.254.169.254"); err == nil {
+		t.Errorf("want an error resolving an endpoint that is not a running task")
+	}
+}
@@ -36,11 +36,17 @@ func DeleteHandler(c ServiceDeleter) http.HandlerFunc {
 
 		if (len(req.FunctionName) == 0) || unmarshalErr != nil {
 			log.Printf("Error parsing request to remove service: %s\n", unmarshalErr)
-			w.WriteHeader(http.StatusBadRequest)
+			if unmarshalErr == nil {
+				unmarshalErr = fmt.Errorf("functionName is required")
+			}
+			writeError(w, ErrorCodeInvalidRequest, req.FunctionName, unmarshalErr)
 			return
 		}
 
-		log.Printf("Attempting to remove service %s\n", req.FunctionName)
+		namespace := getRequestNamespace(r)
+		serviceName := namespacedName(req.FunctionName, namespace)
+
+		log.Printf("Attempting to remove service %s\n", serviceName)
 
 		serviceFilter := filters.NewArgs()
 		options := types.ServiceListOptions{
@@ -50,21 +56,23 @@ func DeleteHandler(c ServiceDeleter) http.HandlerFunc {
 		services, err := c.ServiceList(context.Background(), options)
 		if err != nil {
 			log.Printf("Error listing services: %s\n", err)
+			writeError(w, dockerErrorCode(err, ErrorCodeInternal), req.FunctionName, err)
+			return
 		}
 
 		// TODO: Filter only "faas" functions (via metadata?)
 		var serviceIDs []string
 		for _, service := range services {
 			isFunction := len(service.Spec.TaskTemplate.ContainerSpec.Labels["function"]) > 0
+			inNamespace := namespaceFromLabels(service.Spec.Labels) == namespace
 
-			if isFunction && req.FunctionName == service.Spec.Name {
+			if isFunction && inNamespace && serviceName == service.Spec.Name {
 				serviceIDs = append(serviceIDs, service.ID)
 			}
 		}
 
 		if len(serviceIDs) == 0 {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(fmt.Sprintf("No such service found: %s.", req.FunctionName)))
+			writeError(w, ErrorCodeNotFound, req.FunctionName, fmt.Errorf("no such service found: %s", req.FunctionName))
 			return
 		}
 
@@ -79,7 +87,7 @@ func DeleteHandler(c ServiceDeleter) http.HandlerFunc {
 		if len(serviceRemoveErrors) > 0 {
 			log.Printf("Error(s) removing service: %s\n", req.FunctionName)
 			log.Println(serviceRemoveErrors)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeDockerError(w, req.FunctionName, serviceRemoveErrors[0])
 		} else {
 			w.WriteHeader(http.StatusAccepted)
 		}
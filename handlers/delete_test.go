@@ -32,6 +32,7 @@ func Test_DeleteHandler(t *testing.T) {
 	cases := []struct {
 		name         string
 		funcName     string
+		namespace    string
 		services     []swarm.Service
 		listErr      error
 		removeErr    error
@@ -42,10 +43,10 @@ func Test_DeleteHandler(t *testing.T) {
 			expectedCode: http.StatusBadRequest,
 		},
 		{
-			name:         "listing error returns StatusNotFound",
+			name:         "listing error returns StatusInternalServerError",
 			funcName:     "test-func",
 			listErr:      errors.New("failed to list functions"),
-			expectedCode: http.StatusNotFound,
+			expectedCode: http.StatusInternalServerError,
 		},
 		{
 			name:     "remove error returns StatusInternalServerError",
@@ -84,6 +85,47 @@ func Test_DeleteHandler(t *testing.T) {
 			},
 			expectedCode: http.StatusAccepted,
 		},
+		{
+			name:      "returns StatusNotFound when function is in another namespace",
+			funcName:  "test-func",
+			namespace: "team-a",
+			services: []swarm.Service{
+				{
+					ID: "test-func-id",
+					Spec: swarm.ServiceSpec{
+						Annotations: swarm.Annotations{Name: "test-func"},
+						TaskTemplate: swarm.TaskSpec{
+							ContainerSpec: &swarm.ContainerSpec{
+								Labels: map[string]string{"function": "true"},
+							},
+						},
+					},
+				},
+			},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:      "returns Accepted when function is in the requested namespace",
+			funcName:  "test-func",
+			namespace: "team-a",
+			services: []swarm.Service{
+				{
+					ID: "team-a-test-func-id",
+					Spec: swarm.ServiceSpec{
+						Annotations: swarm.Annotations{
+							Name:   "team-a_test-func",
+							Labels: map[string]string{namespaceLabel: "team-a"},
+						},
+						TaskTemplate: swarm.TaskSpec{
+							ContainerSpec: &swarm.ContainerSpec{
+								Labels: map[string]string{"function": "true"},
+							},
+						},
+					},
+				},
+			},
+			expectedCode: http.StatusAccepted,
+		},
 	}
 
 	for _, tc := range cases {
@@ -98,7 +140,7 @@ func Test_DeleteHandler(t *testing.T) {
 			payload := fmt.Sprintf(`{"functionName": %q}`, tc.funcName)
 
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest("POST", "/", strings.NewReader(payload))
+			r := httptest.NewRequest("POST", "/?namespace="+tc.namespace, strings.NewReader(payload))
 			handler(w, r)
 
 			if w.Code != tc.expectedCode {
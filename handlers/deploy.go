@@ -11,13 +11,11 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/docker/docker/api/types/mount"
 
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/registry"
@@ -27,10 +25,9 @@ import (
 
 const annotationLabelPrefix = "com.openfaas.annotations."
 
-var linuxOnlyConstraints = []string{"node.platform.os == linux"}
-
-// DeployHandler creates a new function (service) inside the swarm network.
-func DeployHandler(c *client.Client, maxRestarts uint64, restartDelay time.Duration) http.HandlerFunc {
+// DeployHandler creates a new function (service) inside the swarm network. The spec of
+// the function is recorded in history when it is not nil.
+func DeployHandler(c *client.Client, settings ProviderSettings, restartPolicy RestartPolicyDefaults, history *RevisionHistory) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 		body, _ := ioutil.ReadAll(r.Body)
@@ -39,57 +36,53 @@ func DeployHandler(c *client.Client, maxRestarts uint64, restartDelay time.Durat
 		err := json.Unmarshal(body, &request)
 		if err != nil {
 			log.Println("Error parsing request:", err)
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(w, ErrorCodeInvalidRequest, "", fmt.Errorf("unable to parse request: %w", err))
 			return
 		}
 
-		options := types.ServiceCreateOptions{}
-		if len(request.RegistryAuth) > 0 {
-			auth, err := BuildEncodedAuthConfig(request.RegistryAuth, request.Image)
-			if err != nil {
-				log.Println("Error building registry auth configuration:", err)
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("Invalid registry auth"))
-				return
-			}
-			options.EncodedRegistryAuth = auth
+		if len(request.Namespace) == 0 {
+			request.Namespace = getRequestNamespace(r)
 		}
 
-		secrets, err := makeSecretsArray(c, request.Secrets)
+		dryRun, err := isDryRun(r)
 		if err != nil {
-			log.Printf("Deployment error: %s\n", err)
-
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Deployment error: " + err.Error()))
+			writeError(w, ErrorCodeInvalidRequest, request.Service, err)
 			return
 		}
 
-		if len(request.Network) == 0 {
-			networkValue, networkErr := lookupNetwork(c)
-			if networkErr != nil {
-				log.Printf("Error querying networks: %s\n", networkErr)
-			} else {
-				request.Network = networkValue
-			}
+		wait, waitTimeout, err := waitOptions(r)
+		if err != nil {
+			writeError(w, ErrorCodeInvalidRequest, request.Service, err)
+			return
 		}
 
-		spec, err := makeSpec(&request, maxRestarts, restartDelay, secrets)
+		prepared, err := prepareDeployment(c, &request, true, settings)
 		if err != nil {
+			log.Printf("Deployment error: %s\n", err)
+			writeError(w, dockerErrorCode(err, ErrorCodeInvalidSpec), request.Service, err)
+			return
+		}
 
+		spec, err := makeSpec(&request, settings, restartPolicy, prepared.secrets)
+		if err != nil {
 			log.Printf("Error creating specification: %s\n", err)
+			writeError(w, ErrorCodeInvalidSpec, request.Service, err)
+			return
+		}
 
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Deployment error: " + err.Error()))
+		if dryRun {
+			writeDryRun(w, spec, prepared.warnings)
 			return
 		}
 
+		options := types.ServiceCreateOptions{
+			EncodedRegistryAuth: prepared.registryAuth,
+		}
+
 		response, err := c.ServiceCreate(context.Background(), spec, options)
 		if err != nil {
-
 			log.Printf("Error creating service: %s\n", err)
-
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Deployment error: " + err.Error()))
+			writeDockerError(w, request.Service, err)
 			return
 		}
 
@@ -97,36 +90,24 @@ func DeployHandler(c *client.Client, maxRestarts uint64, restartDelay time.Durat
 			log.Println(response.Warnings)
 		}
 
-		w.WriteHeader(http.StatusAccepted)
-	}
-}
-
-func lookupNetwork(c *client.Client) (string, error) {
-	networkFilters := filters.NewArgs()
-	networkFilters.Add("label", "openfaas=true")
-	networkListOptions := types.NetworkListOptions{
-		Filters: networkFilters,
-	}
+		history.Record(r, RevisionDeploy, 0, spec)
 
-	networks, networkErr := c.NetworkList(context.Background(), networkListOptions)
-	if networkErr != nil {
-		return "", nil
-	}
+		if wait {
+			writeWaitResult(w, r, c, request.Service, request.Namespace, waitTimeout)
+			return
+		}
 
-	if len(networks) > 0 {
-		return networks[0].Name, nil
+		w.WriteHeader(http.StatusAccepted)
 	}
-
-	return "", nil
 }
 
-func makeSpec(request *typesv1.FunctionDeployment, maxRestarts uint64, restartDelay time.Duration, secrets []*swarm.SecretReference) (swarm.ServiceSpec, error) {
+func makeSpec(request *typesv1.FunctionDeployment, settings ProviderSettings, restartPolicy RestartPolicyDefaults, secrets []*swarm.SecretReference) (swarm.ServiceSpec, error) {
 	constraints := []string{}
 
 	if request.Constraints != nil && len(request.Constraints) > 0 {
 		constraints = request.Constraints
 	} else {
-		constraints = linuxOnlyConstraints
+		constraints = settings.Constraints
 	}
 
 	labels, err := buildLabels(request)
@@ -137,6 +118,16 @@ func makeSpec(request *typesv1.FunctionDeployment, maxRestarts uint64, restartDe
 
 	resources := buildResources(request)
 
+	restart, err := buildRestartPolicy(requestAnnotations(request.Annotations), restartPolicy)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+
+	updateConfig, rollbackConfig, err := buildUpdateConfig(requestAnnotations(request.Annotations))
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+
 	nets := []swarm.NetworkAttachmentConfig{
 		{
 			Target: request.Network,
@@ -145,15 +136,11 @@ func makeSpec(request *typesv1.FunctionDeployment, maxRestarts uint64, restartDe
 
 	spec := swarm.ServiceSpec{
 		Annotations: swarm.Annotations{
-			Name:   request.Service,
+			Name:   namespacedName(request.Service, request.Namespace),
 			Labels: labels,
 		},
 		TaskTemplate: swarm.TaskSpec{
-			RestartPolicy: &swarm.RestartPolicy{
-				MaxAttempts: &maxRestarts,
-				Condition:   swarm.RestartPolicyConditionAny,
-				Delay:       &restartDelay,
-			},
+			RestartPolicy: restart,
 			ContainerSpec: &swarm.ContainerSpec{
 				Image:    request.Image,
 				Labels:   labels,
@@ -171,6 +158,8 @@ func makeSpec(request *typesv1.FunctionDeployment, maxRestarts uint64, restartDe
 				Replicas: getMinReplicas(request),
 			},
 		},
+		UpdateConfig:   updateConfig,
+		RollbackConfig: rollbackConfig,
 	}
 
 	if request.ReadOnlyRootFilesystem {
@@ -351,10 +340,7 @@ func getMinReplicas(request *typesv1.FunctionDeployment) *uint64 {
 }
 
 func buildLabels(request *typesv1.FunctionDeployment) (map[string]string, error) {
-	labels := map[string]string{
-		"com.openfaas.function": request.Service,
-		"function":              "true", // backwards-compatible
-	}
+	labels := map[string]string{}
 
 	if request.Labels != nil {
 		for k, v := range *request.Labels {
@@ -362,6 +348,16 @@ func buildLabels(request *typesv1.FunctionDeployment) (map[string]string, error)
 		}
 	}
 
+	// set after the request labels, so that they can not be overridden, as the name and
+	// namespace of a function are read back from them
+	labels["com.openfaas.function"] = request.Service
+	labels["function"] = "true" // backwards-compatible
+
+	delete(labels, namespaceLabel)
+	if !isDefaultNamespace(request.Namespace) {
+		labels[namespaceLabel] = request.Namespace
+	}
+
 	if request.Annotations != nil {
 		for k, v := range *request.Annotations {
 			key := fmt.Sprintf("%s%s", annotationLabelPrefix, k)
@@ -85,3 +85,27 @@ func Test_BuildLabels_KeyClash(t *testing.T) {
 		t.Fatal("want: an error got: nil")
 	}
 }
+
+func Test_BuildLabels_ReservedLabels(t *testing.T) {
+	request := &typesv1.FunctionDeployment{
+		Service: "api",
+		Labels: &map[string]string{
+			"com.openfaas.function": "other",
+			"function":              "false",
+			namespaceLabel:          "prod",
+		},
+	}
+
+	val, err := buildLabels(request)
+	if err != nil {
+		t.Fatalf("want: no error got: %v", err)
+	}
+
+	if val["com.openfaas.function"] != "api" || val["function"] != "true" {
+		t.Errorf("want: labels set by the provider got: %v", val)
+	}
+
+	if namespace, ok := val[namespaceLabel]; ok {
+		t.Errorf("want: no namespace label in the default namespace got: %q", namespace)
+	}
+}
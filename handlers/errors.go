@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// Error codes returned in the ErrorResponse of every handler
+const (
+	// ErrorCodeInvalidRequest is returned when the request body or parameters cannot be parsed
+	ErrorCodeInvalidRequest = "invalid_request"
+	// ErrorCodeUnauthorized is returned when the request carries no credentials or invalid
+	// ones
+	ErrorCodeUnauthorized = "unauthorized"
+	// ErrorCodeForbidden is returned when the RBAC policy does not permit the caller to
+	// perform the request
+	ErrorCodeForbidden = "forbidden"
+	// ErrorCodeNotFound is returned when the function or secret does not exist
+	ErrorCodeNotFound = "not_found"
+	// ErrorCodeMethodNotAllowed is returned for HTTP methods a handler does not support
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	// ErrorCodeConflict is returned when an object with the same name already exists
+	ErrorCodeConflict = "conflict"
+	// ErrorCodeInvalidSpec is returned when the function or secret specification is invalid,
+	// either when it is built or when it is rejected by Docker
+	ErrorCodeInvalidSpec = "invalid_spec"
+	// ErrorCodeInternal is returned for any other failure
+	ErrorCodeInternal = "internal_error"
+	// ErrorCodeDockerUnavailable is returned when the Docker API cannot be reached
+	ErrorCodeDockerUnavailable = "docker_unavailable"
+	// ErrorCodeTimeout is returned when a function does not become ready in time
+	ErrorCodeTimeout = "timeout"
+	// ErrorCodeDeploymentFailed is returned when Swarm pauses or rolls back the update of
+	// a function that was waited for
+	ErrorCodeDeploymentFailed = "deployment_failed"
+)
+
+// errorStatus is the HTTP status of each error code
+var errorStatus = map[string]int{
+	ErrorCodeInvalidRequest:    http.StatusBadRequest,
+	ErrorCodeUnauthorized:      http.StatusUnauthorized,
+	ErrorCodeForbidden:         http.StatusForbidden,
+	ErrorCodeNotFound:          http.StatusNotFound,
+	ErrorCodeMethodNotAllowed:  http.StatusMethodNotAllowed,
+	ErrorCodeConflict:          http.StatusConflict,
+	ErrorCodeInvalidSpec:       http.StatusUnprocessableEntity,
+	ErrorCodeInternal:          http.StatusInternalServerError,
+	ErrorCodeDockerUnavailable: http.StatusServiceUnavailable,
+	ErrorCodeTimeout:           http.StatusGatewayTimeout,
+	ErrorCodeDeploymentFailed:  http.StatusBadGateway,
+}
+
+// ErrorResponse is the JSON body written by the handlers for every error
+type ErrorResponse struct {
+	// Code is a machine-readable error code, i.e. "not_found"
+	Code string `json:"code"`
+	// Message describes the error
+	Message string `json:"message"`
+	// Function is the name of the function the request was for, when there is one
+	Function string `json:"function,omitempty"`
+	// DockerError is the class of the Docker API error that caused the error, one of
+	// not_found, conflict, invalid_request, unavailable or server_error
+	DockerError string `json:"dockerError,omitempty"`
+	// Errors lists the fields of a function deployment that failed validation
+	Errors []FieldError `json:"errors,omitempty"`
+	// Status is the last status of a function which was waited for
+	Status *DeploymentStatus `json:"status,omitempty"`
+	// Functions lists the functions which use a secret that could not be deleted
+	Functions []string `json:"functions,omitempty"`
+}
+
+// writeError writes an ErrorResponse with the HTTP status of the code
+func writeError(w http.ResponseWriter, code string, function string, err error) {
+	status, ok := errorStatus[code]
+	if !ok {
+		code, status = ErrorCodeInternal, http.StatusInternalServerError
+	}
+
+	res := ErrorResponse{
+		Code:        code,
+		Message:     err.Error(),
+		Function:    function,
+		DockerError: dockerErrorClass(err),
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		res.Errors = validationErr.Errors
+	}
+
+	var deploymentErr *DeploymentError
+	if errors.As(err, &deploymentErr) {
+		res.Status = &deploymentErr.Status
+	}
+
+	var inUseErr *SecretInUseError
+	if errors.As(err, &inUseErr) {
+		res.Functions = inUseErr.Functions
+	}
+
+	body, marshalErr := json.Marshal(res)
+	if marshalErr != nil {
+		log.Printf("Error marshalling error response: %s\n", marshalErr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeDockerError writes an ErrorResponse for an error returned by the Docker API, the
+// code is chosen from the class of the Docker error
+func writeDockerError(w http.ResponseWriter, function string, err error) {
+	writeError(w, dockerErrorCode(err, ErrorCodeInternal), function, err)
+}
+
+// dockerErrorCode returns the error code for the class of a Docker API error, or fallback
+// when err was not returned by the Docker API
+func dockerErrorCode(err error, fallback string) string {
+	switch dockerErrorClass(err) {
+	case "not_found":
+		return ErrorCodeNotFound
+	case "conflict":
+		return ErrorCodeConflict
+	case "invalid_request":
+		return ErrorCodeInvalidSpec
+	case "unavailable":
+		return ErrorCodeDockerUnavailable
+	case "server_error":
+		return ErrorCodeInternal
+	}
+
+	return fallback
+}
+
+// errorCode returns the error code for an HTTP status
+func errorCode(status int) string {
+	for code, s := range errorStatus {
+		if s == status {
+			return code
+		}
+	}
+
+	return ErrorCodeInternal
+}
+
+// dockerErrorClass classifies an error returned by the Docker API, matching the classes
+// recorded in the Docker API metrics. An empty string is returned for other errors.
+func dockerErrorClass(err error) string {
+	var (
+		notFound     errdefs.ErrNotFound
+		conflict     errdefs.ErrConflict
+		invalid      errdefs.ErrInvalidParameter
+		unavailable  errdefs.ErrUnavailable
+		system       errdefs.ErrSystem
+		networkError net.Error
+	)
+
+	switch {
+	case errors.As(err, &notFound):
+		return "not_found"
+	case errors.As(err, &conflict):
+		return "conflict"
+	case errors.As(err, &invalid):
+		return "invalid_request"
+	case errors.As(err, &unavailable), errors.As(err, &networkError), isConnectionFailed(err):
+		return "unavailable"
+	case errors.As(err, &system):
+		return "server_error"
+	}
+
+	return ""
+}
+
+// isConnectionFailed returns true when err, or an error it wraps, is the Docker client's
+// connection failed error
+func isConnectionFailed(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if client.IsErrConnectionFailed(err) {
+			return true
+		}
+	}
+
+	return false
+}
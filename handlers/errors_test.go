@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+func Test_DockerErrorCode(t *testing.T) {
+	cause := errors.New("cause")
+
+	scenarios := []struct {
+		name       string
+		err        error
+		wantCode   string
+		wantStatus int
+	}{
+		{"not found", errdefs.NotFound(cause), ErrorCodeNotFound, http.StatusNotFound},
+		{"name conflict", errdefs.Conflict(cause), ErrorCodeConflict, http.StatusConflict},
+		{"invalid spec", errdefs.InvalidParameter(cause), ErrorCodeInvalidSpec, http.StatusUnprocessableEntity},
+		{"docker unavailable", errdefs.Unavailable(cause), ErrorCodeDockerUnavailable, http.StatusServiceUnavailable},
+		{"connection failed", client.ErrorConnectionFailed("unix:///var/run/docker.sock"), ErrorCodeDockerUnavailable, http.StatusServiceUnavailable},
+		{"wrapped error", fmt.Errorf("error creating service: %w", errdefs.Conflict(cause)), ErrorCodeConflict, http.StatusConflict},
+		{"error not from docker", cause, ErrorCodeInternal, http.StatusInternalServerError},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if got := dockerErrorCode(s.err, ErrorCodeInternal); got != s.wantCode {
+				t.Errorf("want code: %s, got: %s", s.wantCode, got)
+			}
+
+			if got := errorStatus[s.wantCode]; got != s.wantStatus {
+				t.Errorf("want status: %d, got: %d", s.wantStatus, got)
+			}
+		})
+	}
+}
+
+func Test_WriteDockerError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeDockerError(w, "echo", errdefs.Conflict(errors.New("service echo already exists")))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("want status: %d, got: %d", http.StatusConflict, w.Code)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("want Content-Type: application/json, got: %s", got)
+	}
+
+	res := ErrorResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unable to parse error response: %s", err)
+	}
+
+	want := ErrorResponse{
+		Code:        ErrorCodeConflict,
+		Message:     "service echo already exists",
+		Function:    "echo",
+		DockerError: "conflict",
+	}
+
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("want response: %+v, got: %+v", want, res)
+	}
+}
@@ -2,10 +2,33 @@ package handlers
 
 import (
 	"net/http"
+	"sync/atomic"
 )
 
-func Health() http.HandlerFunc {
+// Drainer records that the provider is shutting down, so that health checks fail and
+// no new work is routed to it while in-flight requests complete
+type Drainer struct {
+	draining int32
+}
+
+// Drain marks the provider as draining
+func (d *Drainer) Drain() {
+	atomic.StoreInt32(&d.draining, 1)
+}
+
+// Draining returns true once Drain has been called
+func (d *Drainer) Draining() bool {
+	return d != nil && atomic.LoadInt32(&d.draining) == 1
+}
+
+// Health returns 200 until the provider starts draining, then 503
+func Health(drainer *Drainer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if drainer.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 	}
 }
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Health_Draining(t *testing.T) {
+	drainer := &Drainer{}
+	handler := Health(drainer)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("want status: %d before draining, got: %d", http.StatusOK, w.Code)
+	}
+
+	drainer.Drain()
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want status: %d while draining, got: %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// ScaleToZeroLabel opts a function in to being scaled to zero replicas when it is idle
+const ScaleToZeroLabel = "com.openfaas.scale.zero"
+
+// ScaleToZeroDurationLabel overrides the inactivity window of a function, i.e. "30m"
+const ScaleToZeroDurationLabel = "com.openfaas.scale.zero-duration"
+
+// IdlerConfig controls how the Idler decides when to scale a function to zero
+type IdlerConfig struct {
+	// InactivityDuration is the default time without invocations after which a function
+	// is scaled to zero
+	InactivityDuration time.Duration
+	// ReconcileInterval is how often functions are checked for inactivity
+	ReconcileInterval time.Duration
+	// DryRun logs scale down decisions without changing the replica count
+	DryRun bool
+}
+
+// Idler is a background controller that scales functions to zero replicas once they have
+// not been invoked through the function proxy for their inactivity window. Only functions
+// labelled with com.openfaas.scale.zero=true are considered.
+type Idler struct {
+	lister  ServiceLister
+	query   ServiceQuery
+	tracker *InvocationTracker
+	config  IdlerConfig
+
+	// started is used as the last activity for functions that have not been invoked
+	// since the provider started, so that a restart does not scale everything down
+	started time.Time
+	now     func() time.Time
+}
+
+// NewIdler creates an Idler which reads invocations from the tracker and scales functions
+// through the ServiceQuery
+func NewIdler(lister ServiceLister, query ServiceQuery, tracker *InvocationTracker, config IdlerConfig) *Idler {
+	return &Idler{
+		lister:  lister,
+		query:   query,
+		tracker: tracker,
+		config:  config,
+		started: time.Now(),
+		now:     time.Now,
+	}
+}
+
+// Run checks for idle functions every ReconcileInterval until the context is cancelled
+func (i *Idler) Run(ctx context.Context) {
+	log.Printf("Idler: inactivity duration: %s, reconcile interval: %s, dry-run: %v\n",
+		i.config.InactivityDuration, i.config.ReconcileInterval, i.config.DryRun)
+
+	ticker := time.NewTicker(i.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.reconcile(ctx)
+		}
+	}
+}
+
+func (i *Idler) reconcile(ctx context.Context) {
+	services, err := i.lister.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		log.Printf("Idler: error listing services: %s\n", err)
+		return
+	}
+
+	for _, service := range services {
+		if !isIdleCandidate(service) {
+			continue
+		}
+
+		window := i.inactivityDuration(service.Spec.Labels)
+		idle := i.idleFor(service)
+		if idle < window {
+			continue
+		}
+
+		if i.config.DryRun {
+			log.Printf("Idler: [dry-run] would scale %s to zero, idle for %s (window: %s)\n",
+				service.Spec.Name, idle.Round(time.Second), window)
+			continue
+		}
+
+		log.Printf("Idler: scaling %s to zero, idle for %s (window: %s)\n",
+			service.Spec.Name, idle.Round(time.Second), window)
+
+		if err := i.query.SetReplicas(service.Spec.Name, 0); err != nil {
+			log.Printf("Idler: error scaling %s to zero: %s\n", service.Spec.Name, err)
+		}
+	}
+}
+
+// isIdleCandidate returns true for function services which have opted in to scale to
+// zero and still have replicas
+func isIdleCandidate(service swarm.Service) bool {
+	if service.Spec.TaskTemplate.ContainerSpec == nil ||
+		len(service.Spec.TaskTemplate.ContainerSpec.Labels["function"]) == 0 {
+		return false
+	}
+
+	if enabled, _ := strconv.ParseBool(service.Spec.Labels[ScaleToZeroLabel]); !enabled {
+		return false
+	}
+
+	replicated := service.Spec.Mode.Replicated
+	return replicated != nil && replicated.Replicas != nil && *replicated.Replicas > 0
+}
+
+func (i *Idler) inactivityDuration(labels map[string]string) time.Duration {
+	value, ok := labels[ScaleToZeroDurationLabel]
+	if !ok {
+		return i.config.InactivityDuration
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Idler: invalid %s value: %q, using %s\n", ScaleToZeroDurationLabel, value, i.config.InactivityDuration)
+		return i.config.InactivityDuration
+	}
+
+	return duration
+}
+
+// idleFor returns how long the function has been inactive. Deploying, updating or scaling
+// the service counts as activity.
+func (i *Idler) idleFor(service swarm.Service) time.Duration {
+	last := i.started
+	if service.UpdatedAt.After(last) {
+		last = service.UpdatedAt
+	}
+
+	if invoked, ok := i.tracker.LastInvoked(service.Spec.Name); ok && invoked.After(last) {
+		last = invoked
+	}
+
+	return i.now().Sub(last)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+type fakeServiceQuery struct {
+	replicas map[string]uint64
+	max      uint64
+	min      uint64
+	err      error
+}
+
+func (q *fakeServiceQuery) GetReplicas(service string) (uint64, uint64, uint64, error) {
+	return q.replicas[service], q.max, q.min, q.err
+}
+
+func (q *fakeServiceQuery) SetReplicas(service string, count uint64) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	q.replicas[service] = count
+	return nil
+}
+
+type fakeIdlerLister struct {
+	services []swarm.Service
+}
+
+func (l fakeIdlerLister) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	return l.services, nil
+}
+
+func makeIdlerService(name string, replicas uint64, labels map[string]string, updatedAt time.Time) swarm.Service {
+	service := swarm.Service{
+		ID: name,
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: name, Labels: labels},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{
+					Labels: map[string]string{"function": "true"},
+				},
+			},
+			Mode: swarm.ServiceMode{
+				Replicated: &swarm.ReplicatedService{Replicas: &replicas},
+			},
+		},
+	}
+	service.UpdatedAt = updatedAt
+
+	return service
+}
+
+func Test_Idler_Reconcile(t *testing.T) {
+	now := time.Now()
+	started := now.Add(-time.Hour)
+
+	services := []swarm.Service{
+		makeIdlerService("idle", 1, map[string]string{ScaleToZeroLabel: "true"}, started),
+		makeIdlerService("not-labelled", 1, nil, started),
+		makeIdlerService("idle-bool", 1, map[string]string{ScaleToZeroLabel: "1"}, started),
+		makeIdlerService("opted-out", 1, map[string]string{ScaleToZeroLabel: "false"}, started),
+		makeIdlerService("recently-invoked", 1, map[string]string{ScaleToZeroLabel: "true"}, started),
+		makeIdlerService("recently-updated", 1, map[string]string{ScaleToZeroLabel: "true"}, now.Add(-time.Minute)),
+		makeIdlerService("long-window", 1, map[string]string{ScaleToZeroLabel: "true", ScaleToZeroDurationLabel: "2h"}, started),
+	}
+
+	scenarios := []struct {
+		name   string
+		dryRun bool
+		want   map[string]uint64
+	}{
+		{
+			name: "scales idle functions to zero",
+			want: map[string]uint64{
+				"idle":             0,
+				"not-labelled":     1,
+				"idle-bool":        0,
+				"opted-out":        1,
+				"recently-invoked": 1,
+				"recently-updated": 1,
+				"long-window":      1,
+			},
+		},
+		{
+			name:   "dry-run does not scale",
+			dryRun: true,
+			want: map[string]uint64{
+				"idle":             1,
+				"not-labelled":     1,
+				"idle-bool":        1,
+				"opted-out":        1,
+				"recently-invoked": 1,
+				"recently-updated": 1,
+				"long-window":      1,
+			},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			query := &fakeServiceQuery{replicas: map[string]uint64{}}
+			for _, service := range services {
+				query.replicas[service.Spec.Name] = *service.Spec.Mode.Replicated.Replicas
+			}
+
+			tracker := NewInvocationTracker()
+			tracker.start("recently-invoked", now.Add(-time.Minute))
+			tracker.done("recently-invoked")
+
+			idler := NewIdler(fakeIdlerLister{services}, query, tracker, IdlerConfig{
+				InactivityDuration: 15 * time.Minute,
+				ReconcileInterval:  time.Minute,
+				DryRun:             s.dryRun,
+			})
+			idler.started = started
+			idler.now = func() time.Time { return now }
+
+			idler.reconcile(context.Background())
+
+			for name, want := range s.want {
+				if got := query.replicas[name]; got != want {
+					t.Errorf("%s: want replicas: %d, got: %d", name, want, got)
+				}
+			}
+		})
+	}
+}
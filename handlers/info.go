@@ -14,25 +14,36 @@ const (
 	ProviderName = "faas-swarm"
 )
 
+// InfoResponse is the provider information returned by /system/info, with the
+// configuration the provider is running with
+type InfoResponse struct {
+	typesv1.InfoResponse
+	// Config is the effective configuration, keyed by environment variable name
+	Config map[string]string `json:"config,omitempty"`
+}
+
 //MakeInfoHandler creates handler for /system/info endpoint
-func MakeInfoHandler(version, sha string) http.HandlerFunc {
+func MakeInfoHandler(version, sha string, config map[string]string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Body != nil {
 			defer r.Body.Close()
 		}
 
-		infoResponse := typesv1.InfoResponse{
-			Orchestration: OrchestrationIdentifier,
-			Provider:      ProviderName,
-			Version: typesv1.ProviderVersion{
-				Release: version,
-				SHA:     sha,
+		infoResponse := InfoResponse{
+			InfoResponse: typesv1.InfoResponse{
+				Orchestration: OrchestrationIdentifier,
+				Provider:      ProviderName,
+				Version: typesv1.ProviderVersion{
+					Release: version,
+					SHA:     sha,
+				},
 			},
+			Config: config,
 		}
 
 		jsonOut, marshalErr := json.Marshal(infoResponse)
 		if marshalErr != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, ErrorCodeInternal, "", marshalErr)
 			return
 		}
 
@@ -10,7 +10,8 @@ import (
 func Test_InfoHandler(t *testing.T) {
 	sha := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
 	version := "0.0.1"
-	handler := MakeInfoHandler(version, sha)
+	config := map[string]string{"max_replicas": "20"}
+	handler := MakeInfoHandler(version, sha, config)
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/", nil)
 	handler(w, r)
@@ -36,4 +37,13 @@ func Test_InfoHandler(t *testing.T) {
 	if resp.Version.Release != version {
 		t.Fatalf("expected release %q, got %q", version, resp.Version.Release)
 	}
+
+	info := InfoResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("unexpected error unmarshalling the response")
+	}
+
+	if info.Config["max_replicas"] != "20" {
+		t.Fatalf("expected config max_replicas %q, got %q", "20", info.Config["max_replicas"])
+	}
 }
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+)
+
+// inventoryRetryDelay is the time waited before re-subscribing to the Docker event stream
+// after it fails
+const inventoryRetryDelay = time.Second * 5
+
+// inventoryServiceFilters and inventorySecretFilters are the list filters the Inventory can
+// answer from its cache, lists using any other filter are passed to Docker
+var (
+	inventoryServiceFilters = map[string]bool{"id": true, "name": true, "label": true}
+	inventorySecretFilters  = map[string]bool{"id": true, "name": true, "names": true, "label": true}
+)
+
+// InventoryClient is the subset of the Docker client needed to keep an Inventory current.
+// This interface is satisfied by *client.Client
+type InventoryClient interface {
+	client.SecretAPIClient
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error)
+	ServiceRemove(ctx context.Context, serviceID string) error
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error)
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
+}
+
+// InventoryConfig controls how the Inventory is kept current
+type InventoryConfig struct {
+	// ResyncInterval is how often the whole inventory is re-read from Docker, to correct
+	// for any events that were missed
+	ResyncInterval time.Duration
+	// TaskTTL is how long a task list is served from the cache
+	TaskTTL time.Duration
+}
+
+// Inventory is a shared in-memory copy of the function services and secrets in the swarm,
+// so that reads by the handlers and the resolver do not each call the Docker API.
+//
+// The inventory is seeded by Run and kept current from the Docker event stream for service
+// and secret events, with a periodic resync. Docker does not publish events for tasks, so
+// task lists are cached for TaskTTL and dropped whenever the service changes. Until the
+// inventory has synced, and whenever the event stream is down, reads are passed to Docker.
+//
+// Inventory implements the ServiceLister, ServiceDeleter, TaskLister, SecretsClient and
+// client.SecretAPIClient interfaces, so it can be used in place of the Docker client.
+type Inventory struct {
+	client InventoryClient
+	config InventoryConfig
+
+	mu       sync.RWMutex
+	synced   bool
+	services map[string]swarm.Service
+	secrets  map[string]swarm.Secret
+	tasks    map[string]cachedTasks
+
+	now func() time.Time
+}
+
+type cachedTasks struct {
+	tasks   []swarm.Task
+	fetched time.Time
+}
+
+// NewInventory creates an Inventory, which reads from Docker until Run has synced it
+func NewInventory(c InventoryClient, config InventoryConfig) *Inventory {
+	return &Inventory{
+		client:   c,
+		config:   config,
+		services: map[string]swarm.Service{},
+		secrets:  map[string]swarm.Secret{},
+		tasks:    map[string]cachedTasks{},
+		now:      time.Now,
+	}
+}
+
+// Run keeps the inventory current until the context is cancelled, re-subscribing to the
+// event stream and resyncing whenever the stream fails
+func (i *Inventory) Run(ctx context.Context) {
+	for {
+		err := i.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		i.setSynced(false)
+		log.Printf("Inventory event stream failed: %s, retrying in %s\n", err, inventoryRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(inventoryRetryDelay):
+		}
+	}
+}
+
+// watch subscribes to the event stream, syncs the inventory and then applies events until
+// the stream fails
+func (i *Inventory) watch(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := filters.NewArgs()
+	args.Add("type", events.ServiceEventType)
+	args.Add("type", events.SecretEventType)
+
+	// subscribe before syncing, so that no change is missed between the two
+	messages, errs := i.client.Events(ctx, types.EventsOptions{Filters: args})
+
+	if err := i.Sync(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(i.config.ResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			if err == nil {
+				err = fmt.Errorf("event stream closed")
+			}
+			return err
+		case message := <-messages:
+			i.apply(ctx, message)
+		case <-ticker.C:
+			if err := i.Sync(ctx); err != nil {
+				log.Printf("Error resyncing inventory: %s\n", err)
+			}
+		}
+	}
+}
+
+// Sync replaces the inventory with the services and secrets currently in the swarm
+func (i *Inventory) Sync(ctx context.Context) error {
+	services, err := i.client.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing services: %s", err)
+	}
+
+	secrets, err := i.client.SecretList(ctx, types.SecretListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing secrets: %s", err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.services = map[string]swarm.Service{}
+	for _, service := range services {
+		if isFunctionService(service) {
+			i.services[service.ID] = service
+		}
+	}
+
+	i.setSecretsLocked(secrets)
+	i.tasks = map[string]cachedTasks{}
+	i.synced = true
+
+	return nil
+}
+
+// apply updates the inventory from a service or secret event
+func (i *Inventory) apply(ctx context.Context, message events.Message) {
+	switch message.Type {
+	case events.ServiceEventType:
+		if message.Action == "remove" {
+			i.removeService(message.Actor.ID)
+			return
+		}
+
+		i.refreshService(ctx, message.Actor.ID)
+
+	case events.SecretEventType:
+		if err := i.refreshSecrets(ctx); err != nil {
+			log.Printf("Error refreshing secrets: %s\n", err)
+		}
+	}
+}
+
+// ServiceList returns the function services matching the name, id and label filters
+// from the cache
+func (i *Inventory) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	i.mu.RLock()
+	if !i.synced || options.Filters.Validate(inventoryServiceFilters) != nil {
+		i.mu.RUnlock()
+		return i.client.ServiceList(ctx, options)
+	}
+
+	services := []swarm.Service{}
+	for _, service := range i.services {
+		if options.Filters.FuzzyMatch("id", service.ID) &&
+			options.Filters.FuzzyMatch("name", service.Spec.Name) &&
+			options.Filters.MatchKVList("label", service.Spec.Labels) {
+			services = append(services, service)
+		}
+	}
+	i.mu.RUnlock()
+
+	sort.Slice(services, func(a, b int) bool {
+		return services[a].Spec.Name < services[b].Spec.Name
+	})
+
+	return services, nil
+}
+
+// ServiceRemove removes the service from Docker and from the cache
+func (i *Inventory) ServiceRemove(ctx context.Context, serviceID string) error {
+	if err := i.client.ServiceRemove(ctx, serviceID); err != nil {
+		return err
+	}
+
+	i.removeService(serviceID)
+	return nil
+}
+
+// ServiceInspectWithRaw reads the service from Docker
+func (i *Inventory) ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	return i.client.ServiceInspectWithRaw(ctx, serviceID, options)
+}
+
+// ServiceUpdate updates the service in Docker and refreshes it in the cache, so that the
+// update is visible to the next read without waiting for its event
+func (i *Inventory) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error) {
+	res, err := i.client.ServiceUpdate(ctx, serviceID, version, service, options)
+	if err == nil {
+		i.refreshService(ctx, serviceID)
+	}
+
+	return res, err
+}
+
+// TaskList returns the tasks matching the filters, a list is read from Docker at most once
+// per TaskTTL
+func (i *Inventory) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	key, err := filters.ToJSON(options.Filters)
+	if err != nil {
+		return i.client.TaskList(ctx, options)
+	}
+
+	i.mu.RLock()
+	cached, ok := i.tasks[key]
+	synced := i.synced
+	i.mu.RUnlock()
+
+	if ok && i.now().Sub(cached.fetched) < i.config.TaskTTL {
+		return append([]swarm.Task{}, cached.tasks...), nil
+	}
+
+	tasks, err := i.client.TaskList(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if synced {
+		i.mu.Lock()
+		i.tasks[key] = cachedTasks{tasks: tasks, fetched: i.now()}
+		i.mu.Unlock()
+	}
+
+	return append([]swarm.Task{}, tasks...), nil
+}
+
+// SecretList returns the secrets matching the id, name and label filters from the cache
+func (i *Inventory) SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error) {
+	i.mu.RLock()
+	if !i.synced || options.Filters.Validate(inventorySecretFilters) != nil {
+		i.mu.RUnlock()
+		return i.client.SecretList(ctx, options)
+	}
+
+	secrets := []swarm.Secret{}
+	for _, secret := range i.secrets {
+		if options.Filters.FuzzyMatch("id", secret.ID) &&
+			options.Filters.FuzzyMatch("name", secret.Spec.Name) &&
+			options.Filters.ExactMatch("names", secret.Spec.Name) &&
+			options.Filters.MatchKVList("label", secret.Spec.Labels) {
+			secrets = append(secrets, secret)
+		}
+	}
+	i.mu.RUnlock()
+
+	sort.Slice(secrets, func(a, b int) bool {
+		return secrets[a].Spec.Name < secrets[b].Spec.Name
+	})
+
+	return secrets, nil
+}
+
+// SecretCreate creates the secret in Docker and refreshes the cached secrets
+func (i *Inventory) SecretCreate(ctx context.Context, secret swarm.SecretSpec) (types.SecretCreateResponse, error) {
+	res, err := i.client.SecretCreate(ctx, secret)
+	if err == nil {
+		i.refreshSecretsAfterWrite(ctx)
+	}
+
+	return res, err
+}
+
+// SecretRemove removes the secret from Docker and refreshes the cached secrets
+func (i *Inventory) SecretRemove(ctx context.Context, id string) error {
+	err := i.client.SecretRemove(ctx, id)
+	if err == nil {
+		i.refreshSecretsAfterWrite(ctx)
+	}
+
+	return err
+}
+
+// SecretUpdate updates the secret in Docker and refreshes the cached secrets
+func (i *Inventory) SecretUpdate(ctx context.Context, id string, version swarm.Version, secret swarm.SecretSpec) error {
+	err := i.client.SecretUpdate(ctx, id, version, secret)
+	if err == nil {
+		i.refreshSecretsAfterWrite(ctx)
+	}
+
+	return err
+}
+
+// SecretInspectWithRaw reads the secret from Docker
+func (i *Inventory) SecretInspectWithRaw(ctx context.Context, name string) (swarm.Secret, []byte, error) {
+	return i.client.SecretInspectWithRaw(ctx, name)
+}
+
+// refreshSecretsAfterWrite refreshes the cached secrets so that a write is visible to
+// the next read, without waiting for its event
+func (i *Inventory) refreshSecretsAfterWrite(ctx context.Context) {
+	if err := i.refreshSecrets(ctx); err != nil {
+		log.Printf("Error refreshing secrets: %s\n", err)
+		i.setSynced(false)
+	}
+}
+
+func (i *Inventory) refreshSecrets(ctx context.Context) error {
+	secrets, err := i.client.SecretList(ctx, types.SecretListOptions{})
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.setSecretsLocked(secrets)
+	i.mu.Unlock()
+
+	return nil
+}
+
+func (i *Inventory) setSecretsLocked(secrets []swarm.Secret) {
+	i.secrets = make(map[string]swarm.Secret, len(secrets))
+	for _, secret := range secrets {
+		i.secrets[secret.ID] = secret
+	}
+}
+
+// refreshService reads a service from Docker into the cache, or removes it when it is gone
+// or is not a function
+func (i *Inventory) refreshService(ctx context.Context, serviceID string) {
+	service, _, err := i.client.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+	if client.IsErrNotFound(err) {
+		i.removeService(serviceID)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error inspecting service %s: %s\n", serviceID, err)
+		return
+	}
+
+	i.mu.Lock()
+	if isFunctionService(service) {
+		i.services[service.ID] = service
+	} else {
+		delete(i.services, service.ID)
+	}
+	i.tasks = map[string]cachedTasks{}
+	i.mu.Unlock()
+}
+
+func (i *Inventory) removeService(serviceID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.services, serviceID)
+	i.tasks = map[string]cachedTasks{}
+}
+
+func (i *Inventory) setSynced(synced bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.synced = synced
+}
+
+// isFunctionService returns true when the service was deployed as an OpenFaaS function
+func isFunctionService(service swarm.Service) bool {
+	return service.Spec.TaskTemplate.ContainerSpec != nil &&
+		len(service.Spec.TaskTemplate.ContainerSpec.Labels["function"]) > 0
+}
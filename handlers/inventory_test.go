@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+type fakeInventoryClient struct {
+	services     []swarm.Service
+	secrets      []swarm.Secret
+	tasks        []swarm.Task
+	serviceLists int
+	taskLists    int
+}
+
+func (c *fakeInventoryClient) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	c.serviceLists++
+	return append([]swarm.Service{}, c.services...), nil
+}
+
+func (c *fakeInventoryClient) ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	for _, service := range c.services {
+		if service.ID == serviceID {
+			return service, nil, nil
+		}
+	}
+
+	return swarm.Service{}, nil, errors.New("service not found")
+}
+
+func (c *fakeInventoryClient) ServiceRemove(ctx context.Context, serviceID string) error {
+	for i, service := range c.services {
+		if service.ID == serviceID {
+			c.services = append(c.services[:i], c.services[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (c *fakeInventoryClient) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, spec swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error) {
+	for i, service := range c.services {
+		if service.ID == serviceID {
+			c.services[i].Spec = spec
+			return types.ServiceUpdateResponse{}, nil
+		}
+	}
+
+	return types.ServiceUpdateResponse{}, errors.New("service not found")
+}
+
+func (c *fakeInventoryClient) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	c.taskLists++
+	return append([]swarm.Task{}, c.tasks...), nil
+}
+
+func (c *fakeInventoryClient) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	return make(chan events.Message), make(chan error)
+}
+
+func (c *fakeInventoryClient) SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error) {
+	return append([]swarm.Secret{}, c.secrets...), nil
+}
+
+func (c *fakeInventoryClient) SecretCreate(ctx context.Context, spec swarm.SecretSpec) (types.SecretCreateResponse, error) {
+	c.secrets = append(c.secrets, swarm.Secret{ID: spec.Name, Spec: spec})
+	return types.SecretCreateResponse{ID: spec.Name}, nil
+}
+
+func (c *fakeInventoryClient) SecretRemove(ctx context.Context, id string) error {
+	return nil
+}
+
+func (c *fakeInventoryClient) SecretInspectWithRaw(ctx context.Context, name string) (swarm.Secret, []byte, error) {
+	return swarm.Secret{}, nil, nil
+}
+
+func (c *fakeInventoryClient) SecretUpdate(ctx context.Context, id string, version swarm.Version, spec swarm.SecretSpec) error {
+	return nil
+}
+
+func makeInventoryService(id, name string, labels map[string]string) swarm.Service {
+	return swarm.Service{
+		ID: id,
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: name, Labels: labels},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{Labels: map[string]string{"function": "true"}},
+			},
+		},
+	}
+}
+
+func Test_Inventory_ReadsFromDockerUntilSynced(t *testing.T) {
+	c := &fakeInventoryClient{services: []swarm.Service{makeInventoryService("1", "echo", nil)}}
+	inventory := NewInventory(c, InventoryConfig{TaskTTL: time.Minute})
+
+	inventory.ServiceList(context.Background(), types.ServiceListOptions{})
+	if c.serviceLists != 1 {
+		t.Fatalf("want the list passed to Docker before the inventory syncs, got %d lists", c.serviceLists)
+	}
+
+	if err := inventory.Sync(context.Background()); err != nil {
+		t.Fatalf("unexpected sync error: %s", err)
+	}
+
+	inventory.ServiceList(context.Background(), types.ServiceListOptions{})
+	if c.serviceLists != 2 {
+		t.Errorf("want the list served from the cache once synced, got %d lists", c.serviceLists)
+	}
+}
+
+func Test_Inventory_ServiceListFilters(t *testing.T) {
+	c := &fakeInventoryClient{services: []swarm.Service{
+		makeInventoryService("1", "echo", nil),
+		makeInventoryService("2", "team-a_echo", map[string]string{namespaceLabel: "team-a"}),
+		{ID: "3", Spec: swarm.ServiceSpec{
+			Annotations:  swarm.Annotations{Name: "gateway"},
+			TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{}},
+		}},
+	}}
+
+	inventory := NewInventory(c, InventoryConfig{})
+	if err := inventory.Sync(context.Background()); err != nil {
+		t.Fatalf("unexpected sync error: %s", err)
+	}
+
+	scenarios := []struct {
+		name    string
+		filters filters.Args
+		want    []string
+	}{
+		{"no filter returns only functions", filters.NewArgs(), []string{"echo", "team-a_echo"}},
+		{"name filter matches on prefix", filters.NewArgs(filters.Arg("name", "team-a")), []string{"team-a_echo"}},
+		{"label filter", filters.NewArgs(filters.Arg("label", namespaceLabel+"=team-a")), []string{"team-a_echo"}},
+		{"id filter", filters.NewArgs(filters.Arg("id", "1")), []string{"echo"}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			services, err := inventory.ServiceList(context.Background(), types.ServiceListOptions{Filters: s.filters})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(services) != len(s.want) {
+				t.Fatalf("want %d services, got %d", len(s.want), len(services))
+			}
+
+			for i, name := range s.want {
+				if services[i].Spec.Name != name {
+					t.Errorf("want service %s, got %s", name, services[i].Spec.Name)
+				}
+			}
+		})
+	}
+}
+
+func Test_Inventory_AppliesServiceEvents(t *testing.T) {
+	c := &fakeInventoryClient{services: []swarm.Service{makeInventoryService("1", "echo", nil)}}
+	inventory := NewInventory(c, InventoryConfig{})
+	if err := inventory.Sync(context.Background()); err != nil {
+		t.Fatalf("unexpected sync error: %s", err)
+	}
+
+	c.services = append(c.services, makeInventoryService("2", "figlet", nil))
+	inventory.apply(context.Background(), events.Message{
+		Type:   events.ServiceEventType,
+		Action: "create",
+		Actor:  events.Actor{ID: "2"},
+	})
+
+	services, _ := inventory.ServiceList(context.Background(), types.ServiceListOptions{})
+	if len(services) != 2 {
+		t.Fatalf("want the created service in the inventory, got %d services", len(services))
+	}
+
+	inventory.apply(context.Background(), events.Message{
+		Type:   events.ServiceEventType,
+		Action: "remove",
+		Actor:  events.Actor{ID: "1"},
+	})
+
+	services, _ = inventory.ServiceList(context.Background(), types.ServiceListOptions{})
+	if len(services) != 1 || services[0].Spec.Name != "figlet" {
+		t.Errorf("want only figlet in the inventory, got %v", services)
+	}
+}
+
+func Test_Inventory_CachesTasksForTTL(t *testing.T) {
+	c := &fakeInventoryClient{tasks: []swarm.Task{{ID: "task"}}}
+	inventory := NewInventory(c, InventoryConfig{TaskTTL: time.Second})
+	if err := inventory.Sync(context.Background()); err != nil {
+		t.Fatalf("unexpected sync error: %s", err)
+	}
+
+	now := time.Now()
+	inventory.now = func() time.Time { return now }
+
+	options := types.TaskListOptions{Filters: filters.NewArgs(filters.Arg("service", "echo"))}
+	inventory.TaskList(context.Background(), options)
+	inventory.TaskList(context.Background(), options)
+	if c.taskLists != 1 {
+		t.Errorf("want tasks read once within the TTL, got %d lists", c.taskLists)
+	}
+
+	inventory.apply(context.Background(), events.Message{
+		Type:   events.ServiceEventType,
+		Action: "remove",
+		Actor:  events.Actor{ID: "1"},
+	})
+
+	inventory.TaskList(context.Background(), options)
+	if c.taskLists != 2 {
+		t.Errorf("want tasks re-read after a service event, got %d lists", c.taskLists)
+	}
+
+	now = now.Add(time.Second)
+	inventory.TaskList(context.Background(), options)
+	if c.taskLists != 3 {
+		t.Errorf("want tasks re-read once the TTL expires, got %d lists", c.taskLists)
+	}
+}
+
+func Test_Inventory_SecretCreateIsVisibleToNextList(t *testing.T) {
+	c := &fakeInventoryClient{}
+	inventory := NewInventory(c, InventoryConfig{})
+	if err := inventory.Sync(context.Background()); err != nil {
+		t.Fatalf("unexpected sync error: %s", err)
+	}
+
+	inventory.SecretCreate(context.Background(), swarm.SecretSpec{Annotations: swarm.Annotations{Name: "api-key"}})
+
+	secrets, _ := inventory.SecretList(context.Background(), types.SecretListOptions{})
+	if len(secrets) != 1 || secrets[0].Spec.Name != "api-key" {
+		t.Errorf("want the created secret listed, got %v", secrets)
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// invocationsConfigLabel marks the Swarm config objects that hold invocation counts
+const invocationsConfigLabel = "com.openfaas.invocations"
+
+// InvocationStore persists the invocation counts of an InvocationTracker across
+// provider restarts
+type InvocationStore interface {
+	Load() (map[string]uint64, error)
+	Save(counts map[string]uint64) error
+}
+
+// PersistInvocations restores the counts held in the store, then saves the tracker's counts
+// to the store every interval and once more when the context is cancelled.
+func PersistInvocations(ctx context.Context, tracker *InvocationTracker, store InvocationStore, interval time.Duration) {
+	counts, err := store.Load()
+	if err != nil {
+		log.Printf("Error loading invocation counts: %s\n", err)
+	} else {
+		tracker.Restore(counts)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := store.Save(tracker.Snapshot()); err != nil {
+				log.Printf("Error saving invocation counts: %s\n", err)
+			}
+			return
+		case <-ticker.C:
+			if err := store.Save(tracker.Snapshot()); err != nil {
+				log.Printf("Error saving invocation counts: %s\n", err)
+			}
+		}
+	}
+}
+
+// FileInvocationStore persists invocation counts as JSON in a local file
+type FileInvocationStore struct {
+	Path string
+}
+
+// Load reads the counts from the file, a missing file is treated as no counts
+func (s FileInvocationStore) Load() (map[string]uint64, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return map[string]uint64{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]uint64{}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", s.Path, err)
+	}
+
+	return counts, nil
+}
+
+// Save writes the counts to a temporary file which then replaces the file, so that a
+// crash part way through does not leave a truncated file behind
+func (s FileInvocationStore) Save(counts map[string]uint64) error {
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// ConfigLister is the subset of the Docker client.ConfigAPIClient needed to persist invocation
+// counts in Swarm config objects. This interface is satisfied by *client.Client
+type ConfigLister interface {
+	ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error)
+	ConfigCreate(ctx context.Context, config swarm.ConfigSpec) (types.ConfigCreateResponse, error)
+	ConfigRemove(ctx context.Context, id string) error
+}
+
+// SwarmConfigInvocationStore persists invocation counts in Swarm config objects. Configs are
+// immutable, so each save creates a new config named <Name>-<unix time> and removes the older ones.
+type SwarmConfigInvocationStore struct {
+	Client ConfigLister
+	Name   string
+	// Settings provide the owner label the configs are marked with
+	Settings ProviderSettings
+}
+
+// Load reads the counts from the most recent config
+func (s SwarmConfigInvocationStore) Load() (map[string]uint64, error) {
+	configs, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]uint64{}
+	if len(configs) == 0 {
+		return counts, nil
+	}
+
+	latest := configs[len(configs)-1]
+	if err := json.Unmarshal(latest.Spec.Data, &counts); err != nil {
+		return nil, fmt.Errorf("unable to parse config %s: %s", latest.Spec.Name, err)
+	}
+
+	return counts, nil
+}
+
+// Save creates a config holding the counts, then removes the configs it replaces. Nothing is
+// written when the most recent config already holds the same counts.
+func (s SwarmConfigInvocationStore) Save(counts map[string]uint64) error {
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	if len(previous) > 0 && bytes.Equal(previous[len(previous)-1].Spec.Data, data) {
+		return nil
+	}
+
+	_, err = s.Client.ConfigCreate(context.Background(), swarm.ConfigSpec{
+		Annotations: swarm.Annotations{
+			Name: fmt.Sprintf("%s-%d", s.Name, time.Now().UnixNano()),
+			Labels: map[string]string{
+				invocationsConfigLabel: s.Name,
+				s.Settings.OwnerLabel:  s.Settings.OwnerLabelValue,
+			},
+		},
+		Data: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, config := range previous {
+		if err := s.Client.ConfigRemove(context.Background(), config.ID); err != nil {
+			log.Printf("Error removing invocation counts config %s: %s\n", config.Spec.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// list returns the configs written by the store, oldest first
+func (s SwarmConfigInvocationStore) list() ([]swarm.Config, error) {
+	args := filters.NewArgs()
+	args.Add("label", fmt.Sprintf("%s=%s", invocationsConfigLabel, s.Name))
+
+	configs, err := s.Client.ConfigList(context.Background(), types.ConfigListOptions{Filters: args})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].CreatedAt.Before(configs[j].CreatedAt)
+	})
+
+	return configs, nil
+}
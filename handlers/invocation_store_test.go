@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/mux"
+)
+
+func Test_FileInvocationStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "invocations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := FileInvocationStore{Path: filepath.Join(dir, "invocations.json")}
+
+	counts, err := store.Load()
+	if err != nil {
+		t.Fatalf("want no error loading a missing file, got: %s", err)
+	}
+
+	if len(counts) != 0 {
+		t.Fatalf("want no counts from a missing file, got: %v", counts)
+	}
+
+	want := map[string]uint64{"echo": 10, "team-a_echo": 2}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("unexpected error saving counts: %s", err)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading counts: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want counts: %v, got: %v", want, got)
+	}
+}
+
+type fakeConfigLister struct {
+	configs []swarm.Config
+}
+
+func (c *fakeConfigLister) ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error) {
+	return append([]swarm.Config{}, c.configs...), nil
+}
+
+func (c *fakeConfigLister) ConfigCreate(ctx context.Context, spec swarm.ConfigSpec) (types.ConfigCreateResponse, error) {
+	config := swarm.Config{ID: spec.Name, Spec: spec}
+	config.CreatedAt = time.Now()
+	c.configs = append(c.configs, config)
+
+	return types.ConfigCreateResponse{ID: spec.Name}, nil
+}
+
+func (c *fakeConfigLister) ConfigRemove(ctx context.Context, id string) error {
+	for i, config := range c.configs {
+		if config.ID == id {
+			c.configs = append(c.configs[:i], c.configs[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func Test_SwarmConfigInvocationStore(t *testing.T) {
+	client := &fakeConfigLister{}
+	store := SwarmConfigInvocationStore{Client: client, Name: "faas-swarm-invocations", Settings: testSettings}
+
+	if err := store.Save(map[string]uint64{"echo": 1}); err != nil {
+		t.Fatalf("unexpected error saving counts: %s", err)
+	}
+
+	want := map[string]uint64{"echo": 5}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("unexpected error saving counts: %s", err)
+	}
+
+	if len(client.configs) != 1 {
+		t.Fatalf("want the previous config to be removed, got %d configs", len(client.configs))
+	}
+
+	saved := client.configs[0].ID
+	if err := store.Save(want); err != nil {
+		t.Fatalf("unexpected error saving counts: %s", err)
+	}
+
+	if len(client.configs) != 1 || client.configs[0].ID != saved {
+		t.Errorf("want no new config when the counts are unchanged, got: %v", client.configs)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading counts: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want counts: %v, got: %v", want, got)
+	}
+}
+
+func Test_InvocationTracker_RestoreAndSnapshot(t *testing.T) {
+	tracker := NewInvocationTracker()
+	tracker.start("echo", time.Now())
+	tracker.done("echo")
+
+	tracker.Restore(map[string]uint64{"echo": 10, "figlet": 3})
+
+	want := map[string]uint64{"echo": 11, "figlet": 3}
+	if got := tracker.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want counts: %v, got: %v", want, got)
+	}
+
+	if _, ok := tracker.LastInvoked("figlet"); ok {
+		t.Errorf("want restored function to have no last invocation time")
+	}
+}
+
+func Test_InvocationTracker_Prune(t *testing.T) {
+	tracker := NewInvocationTracker()
+	tracker.Restore(map[string]uint64{"echo": 10, "removed": 3})
+	tracker.start("in-flight", time.Now())
+
+	lister := fakeIdlerLister{services: []swarm.Service{{Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "echo"}}}}}
+	if err := tracker.Prune(context.Background(), lister); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]uint64{"echo": 10, "in-flight": 1}
+	if got := tracker.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want counts: %v, got: %v", want, got)
+	}
+}
+
+func Test_InvocationTracker_DecorateProxy(t *testing.T) {
+	tracker := NewInvocationTracker()
+	exists := func(ctx context.Context, name string) bool { return name == "echo.team-a" }
+
+	handler := tracker.DecorateProxy(func(w http.ResponseWriter, r *http.Request) {}, exists)
+
+	for _, name := range []string{"echo.team-a", "missing"} {
+		r := httptest.NewRequest(http.MethodPost, "/function/"+name, nil)
+		handler(httptest.NewRecorder(), mux.SetURLVars(r, map[string]string{"name": name}))
+	}
+
+	want := map[string]uint64{"team-a_echo": 1}
+	if got := tracker.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want counts: %v, got: %v", want, got)
+	}
+}
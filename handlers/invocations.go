@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/gorilla/mux"
+)
+
+// InvocationTracker records the invocations made to each function through the function
+// proxy. Functions are keyed by their Swarm service name.
+type InvocationTracker struct {
+	mu        sync.RWMutex
+	functions map[string]*functionInvocations
+}
+
+type functionInvocations struct {
+	lastInvoked time.Time
+	// count is the invocations proxied since the provider started
+	count uint64
+	// restored is the count persisted before the provider started, kept apart from count so
+	// that rates are not calculated from it
+	restored uint64
+	inFlight int64
+}
+
+// NewInvocationTracker creates an empty InvocationTracker
+func NewInvocationTracker() *InvocationTracker {
+	return &InvocationTracker{
+		functions: map[string]*functionInvocations{},
+	}
+}
+
+// DecorateProxy wraps the function proxy so that every invocation is recorded against
+// the function named in the request path. Only functions for which exists returns true are
+// recorded, so that requests for arbitrary names are not tracked.
+func (t *InvocationTracker) DecorateProxy(next http.HandlerFunc, exists func(ctx context.Context, name string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if len(name) == 0 || !exists(r.Context(), name) {
+			next(w, r)
+			return
+		}
+
+		service := namespacedName(splitFunctionName(name))
+		t.start(service, time.Now())
+		defer t.done(service)
+
+		next(w, r)
+	}
+}
+
+func (t *InvocationTracker) start(service string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.functions[service]
+	if !ok {
+		f = &functionInvocations{}
+		t.functions[service] = f
+	}
+
+	f.lastInvoked = at
+	f.count++
+	f.inFlight++
+}
+
+func (t *InvocationTracker) done(service string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if f, ok := t.functions[service]; ok {
+		f.inFlight--
+	}
+}
+
+// LastInvoked returns the time the service was last invoked through the proxy, the second
+// value is false when there have been no invocations since the provider started.
+func (t *InvocationTracker) LastInvoked(service string) (time.Time, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if f, ok := t.functions[service]; ok && !f.lastInvoked.IsZero() {
+		return f.lastInvoked, true
+	}
+
+	return time.Time{}, false
+}
+
+// Count returns the number of invocations of the service, including any counts restored
+// from an InvocationStore
+func (t *InvocationTracker) Count(service string) uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if f, ok := t.functions[service]; ok {
+		return f.restored + f.count
+	}
+
+	return 0
+}
+
+// Invoked returns the number of invocations of the service proxied since the provider
+// started, without restored counts, for calculating the rate of invocations
+func (t *InvocationTracker) Invoked(service string) uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if f, ok := t.functions[service]; ok {
+		return f.count
+	}
+
+	return 0
+}
+
+// InFlight returns the number of invocations of the service currently being proxied
+func (t *InvocationTracker) InFlight(service string) int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if f, ok := t.functions[service]; ok {
+		return f.inFlight
+	}
+
+	return 0
+}
+
+// Prune removes the functions which are no longer deployed, so that their counts are
+// neither kept nor persisted. Functions with invocations in flight are kept.
+func (t *InvocationTracker) Prune(ctx context.Context, lister ServiceLister) error {
+	services, err := lister.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return err
+	}
+
+	deployed := make(map[string]bool, len(services))
+	for _, service := range services {
+		deployed[service.Spec.Name] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, f := range t.functions {
+		if !deployed[service] && f.inFlight == 0 {
+			delete(t.functions, service)
+		}
+	}
+
+	return nil
+}
+
+// PruneInvocations prunes the tracker every interval until the context is cancelled
+func PruneInvocations(ctx context.Context, tracker *InvocationTracker, lister ServiceLister, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := tracker.Prune(ctx, lister); err != nil {
+				log.Printf("Error pruning invocation counts: %s\n", err)
+			}
+		}
+	}
+}
+
+// Restore adds previously persisted invocation counts to the tracker
+func (t *InvocationTracker) Restore(counts map[string]uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, count := range counts {
+		f, ok := t.functions[service]
+		if !ok {
+			f = &functionInvocations{}
+			t.functions[service] = f
+		}
+
+		f.restored += count
+	}
+}
+
+// Snapshot returns the invocation count of every function that has been invoked
+func (t *InvocationTracker) Snapshot() map[string]uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	counts := make(map[string]uint64, len(t.functions))
+	for service, f := range t.functions {
+		counts[service] = f.restored + f.count
+	}
+
+	return counts
+}
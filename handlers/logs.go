@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"strconv"
@@ -12,6 +13,8 @@ import (
 
 	dockerlogs "github.com/docker/cli/service/logs"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
 
 	"github.com/openfaas/faas-provider/logs"
 )
@@ -29,6 +32,7 @@ type LogRequester struct {
 // ServiceLogger is the subset of Docker Client methods required for querying function logs
 type ServiceLogger interface {
 	ServiceLogs(ctx context.Context, serviceID string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error)
 }
 
 // NewLogRequester returns a Requestor instance that can be used in the function logs endpoint
@@ -55,14 +59,27 @@ func (l LogRequester) Query(ctx context.Context, r logs.Request) (<-chan logs.Me
 		options.Tail = strconv.Itoa(r.Tail)
 	}
 
-	logStream, err := l.client.ServiceLogs(ctx, r.Name, options)
+	serviceName := namespacedName(r.Name, r.Namespace)
+
+	// the service name may be that of a function in another namespace
+	service, _, err := l.client.ServiceInspectWithRaw(ctx, serviceName, types.ServiceInspectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if !isFunctionService(service) || namespaceFromLabels(service.Spec.Labels) != normalizeNamespace(r.Namespace) {
+		log.Printf("Service %s is not a function in namespace %s\n", serviceName, r.Namespace)
+		return nil, errdefs.NotFound(fmt.Errorf("no such service found: %s", r.Name))
+	}
+
+	logStream, err := l.client.ServiceLogs(ctx, serviceName, options)
 	if err != nil {
 		return nil, err
 	}
 
 	msgStream := make(chan logs.Message)
 
-	go parseLogStream(ctx, r.Name, msgStream, logStream)
+	go parseLogStream(ctx, r.Name, normalizeNamespace(r.Namespace), msgStream, logStream)
 
 	return msgStream, nil
 }
@@ -71,7 +88,7 @@ func (l LogRequester) Query(ctx context.Context, r logs.Request) (<-chan logs.Me
 // them on the msgStream channel.  Raw log lines look like 'timestamp serviceDetails rawMessage`, e.g.
 // 2019-02-09T02:34:38.914788800Z com.docker.swarm.node.id=lfplf8vfa6j2fp4xkygcze8i4,com.docker.swarm.service.id=wy8sr6u3lqx11a34t96qlbyff,com.docker.swarm.task.id=zzvbv53tdyebuhh9rquadwuud 2019/02/09 02:34:38 Error reading stdout: EOF
 // we may want to pull some inspiration from here https://github.com/docker/cli/blob/master/cli/command/service/logs.go
-func parseLogStream(ctx context.Context, name string, msgStream chan logs.Message, logStream io.ReadCloser) {
+func parseLogStream(ctx context.Context, name string, namespace string, msgStream chan logs.Message, logStream io.ReadCloser) {
 	defer close(msgStream)
 	defer logStream.Close()
 
@@ -108,6 +125,7 @@ func parseLogStream(ctx context.Context, name string, msgStream chan logs.Messag
 		}
 		msg := logs.Message{
 			Name:      name, // details["com.docker.swarm.service.id"],
+			Namespace: namespace,
 			Instance:  details["com.docker.swarm.task.id"],
 			Timestamp: ts,
 			Text:      strings.TrimSpace(logParts[2]),
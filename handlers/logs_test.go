@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/openfaas/faas-provider/logs"
+)
+
+type fakeServiceLogger struct {
+	service swarm.Service
+	queried string
+}
+
+func (f *fakeServiceLogger) ServiceLogs(ctx context.Context, serviceID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	f.queried = serviceID
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (f *fakeServiceLogger) ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	return f.service, nil, nil
+}
+
+func Test_LogRequester_OtherNamespace(t *testing.T) {
+	client := &fakeServiceLogger{
+		service: makeInventoryService("1", "team-a_echo", map[string]string{namespaceLabel: "team-a"}),
+	}
+
+	if _, err := NewLogRequester(client).Query(context.Background(), logs.Request{Name: "team-a_echo"}); err == nil || len(client.queried) > 0 {
+		t.Errorf("want the logs of another namespace to be refused, got: %v, queried: %q", err, client.queried)
+	}
+
+	if _, err := NewLogRequester(client).Query(context.Background(), logs.Request{Name: "echo", Namespace: "team-a"}); err != nil || client.queried != "team-a_echo" {
+		t.Errorf("want the logs of team-a_echo, got: %v, queried: %q", err, client.queried)
+	}
+}
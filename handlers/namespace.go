@@ -1,25 +1,162 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 )
 
-// Swarm does not use namespaces, so we return an empty list. see https://github.com/openfaas-incubator/connector-sdk/pull/46
-func NamespaceLister() http.HandlerFunc {
+const (
+	// DefaultNamespace is the namespace used when a request does not specify one. Functions
+	// and secrets in the default namespace keep their plain Swarm names.
+	DefaultNamespace = "openfaas-fn"
+
+	// namespaceLabel records the namespace of a function service or secret
+	namespaceLabel = "com.openfaas.namespace"
+
+	// namespaceNetworkLabel marks an overlay network as the network for a namespace,
+	// i.e. openfaas.namespace=team-a
+	namespaceNetworkLabel = "openfaas.namespace"
+
+	// namespaceSeparator joins the namespace and the function or secret name to build
+	// a Swarm object name that is unique across namespaces.
+	namespaceSeparator = "_"
+)
+
+// NetworkLister is the subset of the Docker client.NetworkAPIClient needed to resolve
+// namespaces. This interface is satisfied by *client.Client
+type NetworkLister interface {
+	NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
+}
+
+// NamespaceLister lists the namespaces known to the provider. Each namespace is backed by an
+// overlay network labelled with openfaas.namespace=<name>, the default namespace is always present.
+func NamespaceLister(c NetworkLister) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		namespaces := []string{}
-		nsJSON, err := json.Marshal(namespaces)
+		namespaces, err := listNamespaces(c)
+		if err != nil {
+			log.Printf("Unable to list namespaces: %s\n", err)
+			writeDockerError(w, "", fmt.Errorf("unable to return namespaces: %w", err))
+			return
+		}
 
+		nsJSON, err := json.Marshal(namespaces)
 		if err != nil {
 			log.Printf("Unable to marshal namespaces into JSON %q", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("\"error\": \"unable to return namespaces\""))
+			writeError(w, ErrorCodeInternal, "", fmt.Errorf("unable to return namespaces: %w", err))
+			return
 		}
 
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		w.Write(nsJSON)
 	}
 }
+
+func listNamespaces(c NetworkLister) ([]string, error) {
+	networkFilters := filters.NewArgs()
+	networkFilters.Add("label", namespaceNetworkLabel)
+
+	networks, err := c.NetworkList(context.Background(), types.NetworkListOptions{Filters: networkFilters})
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{DefaultNamespace: true}
+	for _, network := range networks {
+		if ns := network.Labels[namespaceNetworkLabel]; len(ns) > 0 {
+			found[ns] = true
+		}
+	}
+
+	namespaces := []string{}
+	for ns := range found {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// lookupNamespaceNetwork returns the name of the overlay network that backs the namespace.
+// The default namespace uses the network with networkLabel, i.e. openfaas=true, when no such
+// network exists an empty name is returned so that the caller can fall back to the Swarm
+// default.
+func lookupNamespaceNetwork(c NetworkLister, namespace string, networkLabel string) (string, error) {
+	networkFilters := filters.NewArgs()
+	if isDefaultNamespace(namespace) {
+		networkFilters.Add("label", networkLabel)
+	} else {
+		networkFilters.Add("label", fmt.Sprintf("%s=%s", namespaceNetworkLabel, namespace))
+	}
+
+	networks, err := c.NetworkList(context.Background(), types.NetworkListOptions{Filters: networkFilters})
+	if err != nil {
+		return "", err
+	}
+
+	if len(networks) > 0 {
+		return networks[0].Name, nil
+	}
+
+	if isDefaultNamespace(namespace) {
+		return "", nil
+	}
+
+	return "", fmt.Errorf("namespace not found: %s", namespace)
+}
+
+// getRequestNamespace reads the namespace from the ?namespace= query parameter, falling back
+// to the default namespace.
+func getRequestNamespace(r *http.Request) string {
+	if r.URL == nil {
+		return DefaultNamespace
+	}
+
+	return normalizeNamespace(r.URL.Query().Get("namespace"))
+}
+
+// normalizeNamespace maps an empty namespace to the default namespace.
+func normalizeNamespace(namespace string) string {
+	if len(namespace) == 0 {
+		return DefaultNamespace
+	}
+
+	return namespace
+}
+
+func isDefaultNamespace(namespace string) bool {
+	return len(namespace) == 0 || namespace == DefaultNamespace
+}
+
+// namespacedName returns the Swarm object name for a function or secret in a namespace,
+// objects in the default namespace are not prefixed so that existing deployments keep working.
+func namespacedName(name, namespace string) string {
+	if isDefaultNamespace(namespace) {
+		return name
+	}
+
+	return namespace + namespaceSeparator + name
+}
+
+// namespaceFromLabels returns the namespace recorded in the labels of a Swarm object.
+func namespaceFromLabels(labels map[string]string) string {
+	return normalizeNamespace(labels[namespaceLabel])
+}
+
+// splitFunctionName splits a name in the form "function.namespace", as used by the gateway
+// when invoking a function in a namespace, into its parts.
+func splitFunctionName(name string) (string, string) {
+	if index := strings.LastIndex(name, "."); index > 0 && index < len(name)-1 {
+		return name[:index], name[index+1:]
+	}
+
+	return name, DefaultNamespace
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+type fakeNetworkLister struct {
+	networks []types.NetworkResource
+	err      error
+}
+
+func (l fakeNetworkLister) NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	return l.networks, l.err
+}
+
+func Test_NamespaceLister(t *testing.T) {
+	client := fakeNetworkLister{
+		networks: []types.NetworkResource{
+			{Name: "team-b-functions", Labels: map[string]string{namespaceNetworkLabel: "team-b"}},
+			{Name: "team-a-functions", Labels: map[string]string{namespaceNetworkLabel: "team-a"}},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/system/namespaces", nil)
+	NamespaceLister(client)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status code: %d, got: %d", http.StatusOK, w.Code)
+	}
+
+	got := []string{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error unmarshalling the response: %s", err)
+	}
+
+	want := []string{DefaultNamespace, "team-a", "team-b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want namespaces: %v, got: %v", want, got)
+	}
+}
+
+func Test_NamespaceLister_ListError(t *testing.T) {
+	client := fakeNetworkLister{err: errors.New("docker unavailable")}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/system/namespaces", nil)
+	NamespaceLister(client)(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("want status code: %d, got: %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func Test_LookupNamespaceNetwork(t *testing.T) {
+	scenarios := []struct {
+		name      string
+		namespace string
+		networks  []types.NetworkResource
+		want      string
+		wantErr   bool
+	}{
+		{"default namespace uses labelled network", "", []types.NetworkResource{{Name: "func_functions"}}, "func_functions", false},
+		{"default namespace without network is not an error", DefaultNamespace, nil, "", false},
+		{"namespace uses labelled network", "team-a", []types.NetworkResource{{Name: "team-a-functions"}}, "team-a-functions", false},
+		{"unknown namespace returns error", "team-c", nil, "", true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			got, err := lookupNamespaceNetwork(fakeNetworkLister{networks: s.networks}, s.namespace, testSettings.NetworkLabel)
+			if (err != nil) != s.wantErr {
+				t.Fatalf("want error: %v, got: %v", s.wantErr, err)
+			}
+
+			if got != s.want {
+				t.Errorf("want network: %q, got: %q", s.want, got)
+			}
+		})
+	}
+}
+
+func Test_NamespacedName(t *testing.T) {
+	scenarios := []struct {
+		name      string
+		namespace string
+		want      string
+	}{
+		{"echo", "", "echo"},
+		{"echo", DefaultNamespace, "echo"},
+		{"echo", "team-a", "team-a_echo"},
+	}
+
+	for _, s := range scenarios {
+		if got := namespacedName(s.name, s.namespace); got != s.want {
+			t.Errorf("namespacedName(%q, %q) want: %q, got: %q", s.name, s.namespace, s.want, got)
+		}
+	}
+}
+
+func Test_SplitFunctionName(t *testing.T) {
+	scenarios := []struct {
+		value         string
+		wantName      string
+		wantNamespace string
+	}{
+		{"echo", "echo", DefaultNamespace},
+		{"echo.team-a", "echo", "team-a"},
+		{"echo.", "echo.", DefaultNamespace},
+		{".team-a", ".team-a", DefaultNamespace},
+	}
+
+	for _, s := range scenarios {
+		name, namespace := splitFunctionName(s.value)
+		if name != s.wantName || namespace != s.wantNamespace {
+			t.Errorf("splitFunctionName(%q) want: (%q, %q), got: (%q, %q)", s.value, s.wantName, s.wantNamespace, name, namespace)
+		}
+	}
+}
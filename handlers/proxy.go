@@ -5,17 +5,31 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/mux"
 )
 
-const watchdogPort = 8080
 const urlScheme = "http"
 
+// endpointSeparator joins a function name and the endpoint chosen for it by the
+// Balancer, i.e. "echo@10.0.1.5", so that the resolver proxies to that endpoint
+const endpointSeparator = "@"
+
+// lookupRand is seeded once, rather than on every DNSRR lookup
+var lookupRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
 // ServiceLister is the subset of the Docker client.ServiceAPIClient needed to enable the
 // function lookup
 type ServiceLister interface {
@@ -34,6 +48,11 @@ type FunctionLookup struct {
 	// dnsrrLookup method used to resolve the function IP address, defaults to the internal lookupIP
 	// method, which is an implementation of net.LookupIP
 	dnsrrLookup func(context.Context, string) ([]net.IP, error)
+	// balancer picks the task to proxy to for functions balanced by the provider, when nil
+	// all functions are resolved by VIP or DNSRR
+	balancer *Balancer
+	// port is the watchdog port of functions, when 0 the proxy uses its default of 8080
+	port int
 }
 
 // NewFunctionLookup creates a new FunctionLookup resolver
@@ -46,10 +65,61 @@ func NewFunctionLookup(client ServiceLister, dnsRoundRobin bool) *FunctionLookup
 	}
 }
 
+// WithBalancer balances requests across the tasks of functions using the balancer's
+// strategies. Use DecorateProxy so that requests in flight are counted per task.
+func (l *FunctionLookup) WithBalancer(balancer *Balancer) *FunctionLookup {
+	l.balancer = balancer
+	return l
+}
+
+// WithPort resolves functions to the given watchdog port rather than the proxy's default
+func (l *FunctionLookup) WithPort(port int) *FunctionLookup {
+	l.port = port
+	return l
+}
+
+// DecorateProxy wraps the function proxy so that the Balancer chooses the task of each
+// request and counts it as in flight to that task until the request completes.
+func (l *FunctionLookup) DecorateProxy(next http.HandlerFunc) http.HandlerFunc {
+	if l.balancer == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		name := vars["name"]
+
+		endpoint, err := l.balance(r.Context(), namespacedName(splitFunctionName(name)))
+		if err != nil || len(endpoint) == 0 {
+			// the resolver reports the error, or resolves the function by VIP or DNSRR
+			next(w, r)
+			return
+		}
+
+		release := l.balancer.acquire(endpoint)
+		defer release()
+
+		pinned := map[string]string{}
+		for k, v := range vars {
+			pinned[k] = v
+		}
+		pinned["name"] = name + endpointSeparator + endpoint
+
+		next(w, mux.SetURLVars(r, pinned))
+	}
+}
+
+// Exists returns true when the function named in the path of a proxy request, as "function"
+// or "function.namespace", is deployed
+func (l *FunctionLookup) Exists(ctx context.Context, name string) bool {
+	_, err := l.findService(ctx, namespacedName(splitFunctionName(name)))
+	return err == nil
+}
+
 // Resolve implements the openfaas-provider proxy.BaseURLResolver interface. In
 // short it verifies that a function with the given name is resolvable by Docker
 // Swarm.  It can be configured to do this via DNS or by querying the Docker Service
-// list.
+// list. Functions in a namespace other than the default are named "function.namespace".
 func (l *FunctionLookup) Resolve(name string) (u url.URL, err error) {
 	return l.ResolveContext(context.Background(), name)
 }
@@ -57,10 +127,22 @@ func (l *FunctionLookup) Resolve(name string) (u url.URL, err error) {
 // ResolveContext provides an implementation of openfaas-provider proxy.BaseURLResolver with
 // context support. See `Resolve`
 func (l *FunctionLookup) ResolveContext(ctx context.Context, name string) (u url.URL, err error) {
+	var pinned string
+	if i := strings.LastIndex(name, endpointSeparator); i >= 0 {
+		name, pinned = name[:i], name[i+len(endpointSeparator):]
+	}
 
-	if l.dnsRoundRobin {
+	// the gateway addresses functions outside of the default namespace as "function.namespace"
+	name = namespacedName(splitFunctionName(name))
+
+	switch {
+	case len(pinned) > 0:
+		u.Host, err = l.byEndpoint(ctx, name, pinned)
+	case l.balancer != nil:
+		u.Host, err = l.byBalancer(ctx, name)
+	case l.dnsRoundRobin:
 		u.Host, err = l.byDNSRoundRobin(ctx, name)
-	} else {
+	default:
 		u.Host, err = l.byName(ctx, name)
 	}
 
@@ -68,25 +150,102 @@ func (l *FunctionLookup) ResolveContext(ctx context.Context, name string) (u url
 		return u, err
 	}
 
+	if l.port > 0 {
+		u.Host = net.JoinHostPort(u.Host, strconv.Itoa(l.port))
+	}
+
 	u.Scheme = l.scheme
 	return u, nil
 }
 
 // resolve the function by checking the available docker VIP based resolution
 func (l *FunctionLookup) byName(ctx context.Context, name string) (string, error) {
+	if _, err := l.findService(ctx, name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// resolve the function to a task chosen by the balancer, falling back to VIP or DNSRR for
+// functions that are not balanced by the provider
+func (l *FunctionLookup) byBalancer(ctx context.Context, name string) (string, error) {
+	endpoint, err := l.balance(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(endpoint) > 0 {
+		return endpoint, nil
+	}
+
+	if l.dnsRoundRobin {
+		return l.byDNSRoundRobin(ctx, name)
+	}
+
+	return name, nil
+}
+
+// resolve the function to the endpoint chosen by DecorateProxy, which must still be one of
+// its running tasks, since the name comes from the request path
+func (l *FunctionLookup) byEndpoint(ctx context.Context, name string, endpoint string) (string, error) {
+	if l.balancer == nil {
+		return "", fmt.Errorf("could not resolve: %s", name)
+	}
+
+	service, err := l.findService(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	endpoints, err := l.balancer.endpoints(ctx, service)
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range endpoints {
+		if e == endpoint {
+			return endpoint, nil
+		}
+	}
+
+	return "", fmt.Errorf("could not resolve: %s, %s is not a running task", name, endpoint)
+}
+
+// balance returns the endpoint chosen by the balancer for the function, or an empty string
+// when the function is not balanced by the provider
+func (l *FunctionLookup) balance(ctx context.Context, name string) (string, error) {
+	service, err := l.findService(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	strategy := l.balancer.strategyFor(service)
+	if len(strategy) == 0 {
+		return "", nil
+	}
+
+	return l.balancer.pick(ctx, service, strategy)
+}
+
+// findService returns the Swarm service with the given name
+func (l *FunctionLookup) findService(ctx context.Context, name string) (swarm.Service, error) {
 	serviceFilter := filters.NewArgs()
 	serviceFilter.Add("name", name)
 	services, err := l.lister.ServiceList(ctx, types.ServiceListOptions{Filters: serviceFilter})
 
 	if err != nil {
-		return "", err
+		return swarm.Service{}, err
 	}
 
-	if len(services) > 0 {
-		return name, nil
+	// the name filter matches on prefix, so check for the exact service name
+	for _, service := range services {
+		if service.Spec.Name == name {
+			return service, nil
+		}
 	}
 
-	return "", fmt.Errorf("could not resolve: %s", name)
+	return swarm.Service{}, fmt.Errorf("could not resolve: %s", name)
 }
 
 // resolve the function by checking the available docker DNSRR resolution
@@ -106,8 +265,10 @@ func (l *FunctionLookup) byDNSRoundRobin(ctx context.Context, name string) (stri
 }
 
 func randomInt(min, max int) int {
-	rand.Seed(time.Now().Unix())
-	return rand.Intn(max-min) + min
+	lookupRand.Lock()
+	defer lookupRand.Unlock()
+
+	return lookupRand.Intn(max-min) + min
 }
 
 // lookupIP implements the net.LookupIP method with context support. It returns a slice of that\
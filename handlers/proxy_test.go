@@ -25,7 +25,12 @@ func (l testServiceLister) ServiceList(ctx context.Context, options types.Servic
 		return nil, nil
 	}
 
-	return []swarm.Service{{ID: l.serviceName}}, nil
+	return []swarm.Service{
+		{
+			ID:   l.serviceName,
+			Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: l.serviceName}},
+		},
+	}, nil
 }
 
 func Test_ProxyURLResolver_ByName(t *testing.T) {
@@ -99,3 +104,28 @@ func testDNSRRLookup(ctx context.Context, name string) ([]net.IP, error) {
 
 	return []net.IP{}, nil
 }
+
+func Test_ProxyURLResolver_WithPort(t *testing.T) {
+	docker := testServiceLister{serviceName: "testFnc"}
+
+	u, err := NewFunctionLookup(docker, false).WithPort(8081).Resolve("testFnc")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if u.Host != "testFnc:8081" {
+		t.Errorf("expected url host `testFnc:8081`, got `%s`", u.Host)
+	}
+}
+
+func Test_FunctionLookup_Exists(t *testing.T) {
+	lookup := NewFunctionLookup(testServiceLister{serviceName: "team-a_echo"}, false)
+
+	if !lookup.Exists(context.Background(), "echo.team-a") {
+		t.Errorf("want echo.team-a to exist")
+	}
+
+	if lookup.Exists(context.Background(), "missing") {
+		t.Errorf("want missing not to exist")
+	}
+}
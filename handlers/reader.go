@@ -10,21 +10,25 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/api/types/swarm"
 	typesv1 "github.com/openfaas/faas-provider/types"
 )
 
-// FunctionReader reads functions from Swarm metadata
-func FunctionReader(wildcard bool, c client.ServiceAPIClient) http.HandlerFunc {
+// InvocationCounter provides the number of invocations of a function service
+type InvocationCounter interface {
+	Count(service string) uint64
+}
+
+// FunctionReader reads functions from Swarm metadata, the invocation count of each
+// function is read from counter when it is not nil
+func FunctionReader(wildcard bool, c ServiceLister, counter InvocationCounter) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		functions, err := readServices(c)
+		functions, err := readServices(c, getRequestNamespace(r), counter)
 		if err != nil {
 			log.Printf("Error getting service list: %s\n", err.Error())
-
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+			writeDockerError(w, "", err)
 			return
 		}
 
@@ -35,7 +39,8 @@ func FunctionReader(wildcard bool, c client.ServiceAPIClient) http.HandlerFunc {
 	}
 }
 
-func readServices(c client.ServiceAPIClient) ([]typesv1.FunctionStatus, error) {
+// readServices returns the functions deployed to the given namespace
+func readServices(c ServiceLister, namespace string, counter InvocationCounter) ([]typesv1.FunctionStatus, error) {
 	functions := []typesv1.FunctionStatus{}
 	serviceFilter := filters.NewArgs()
 
@@ -45,32 +50,68 @@ func readServices(c client.ServiceAPIClient) ([]typesv1.FunctionStatus, error) {
 
 	services, err := c.ServiceList(context.Background(), options)
 	if err != nil {
-		return functions, fmt.Errorf("error getting service list: %s", err.Error())
+		return functions, fmt.Errorf("error getting service list: %w", err)
 	}
 
 	for _, service := range services {
 
-		if len(service.Spec.TaskTemplate.ContainerSpec.Labels["function"]) > 0 {
-			envProcess := getEnvProcess(service.Spec.TaskTemplate.ContainerSpec.Env)
+		if len(service.Spec.TaskTemplate.ContainerSpec.Labels["function"]) > 0 &&
+			namespaceFromLabels(service.Spec.Labels) == namespace {
+			functions = append(functions, functionStatus(service, namespace, counter))
+		}
+	}
+
+	return functions, err
+}
 
-			// Required (copy by value)
-			labels, annotations := buildLabelsAndAnnotations(service.Spec.Labels)
+// functionStatus returns the status of a function from its service
+func functionStatus(service swarm.Service, namespace string, counter InvocationCounter) typesv1.FunctionStatus {
+	envProcess := getEnvProcess(service.Spec.TaskTemplate.ContainerSpec.Env)
 
-			f := typesv1.FunctionStatus{
-				Name:            service.Spec.Name,
-				Image:           service.Spec.TaskTemplate.ContainerSpec.Image,
-				InvocationCount: 0,
-				Replicas:        *service.Spec.Mode.Replicated.Replicas,
-				EnvProcess:      envProcess,
-				Labels:          &labels,
-				Annotations:     &annotations,
+	// Required (copy by value)
+	labels, annotations := buildLabelsAndAnnotations(service.Spec.Labels)
+
+	// show the update strategy and restart policy in effect, including defaults
+	for _, effective := range []map[string]string{
+		updateConfigAnnotations(service.Spec.UpdateConfig),
+		restartPolicyAnnotations(service.Spec.TaskTemplate.RestartPolicy),
+	} {
+		for key, value := range effective {
+			if annotations == nil {
+				annotations = map[string]string{}
 			}
 
-			functions = append(functions, f)
+			if _, ok := annotations[key]; !ok {
+				annotations[key] = value
+			}
 		}
 	}
 
-	return functions, err
+	var invocations float64
+	if counter != nil {
+		invocations = float64(counter.Count(service.Spec.Name))
+	}
+
+	return typesv1.FunctionStatus{
+		Name:            functionName(service.Spec),
+		Image:           service.Spec.TaskTemplate.ContainerSpec.Image,
+		InvocationCount: invocations,
+		Replicas:        *service.Spec.Mode.Replicated.Replicas,
+		EnvProcess:      envProcess,
+		Labels:          &labels,
+		Annotations:     &annotations,
+		Namespace:       namespace,
+	}
+}
+
+// functionName returns the name of the function as it was deployed, without the namespace
+// prefix applied to the Swarm service name.
+func functionName(spec swarm.ServiceSpec) string {
+	if name := spec.Labels["com.openfaas.function"]; len(name) > 0 {
+		return name
+	}
+
+	return spec.Name
 }
 
 func getEnvProcess(envVars []string) string {
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// readinessCheckTimeout bounds the Docker API calls made by one readiness check
+const readinessCheckTimeout = 5 * time.Second
+
+// Names of the checks reported by the readiness endpoint
+const (
+	ReadinessCheckDocker  = "docker"
+	ReadinessCheckManager = "swarm_manager"
+	ReadinessCheckQuorum  = "swarm_quorum"
+	ReadinessCheckNetwork = "functions_network"
+	ReadinessCheckDrain   = "draining"
+)
+
+// ReadinessClient is the subset of the Docker client needed to check that the provider
+// can manage functions. This interface is satisfied by *client.Client
+type ReadinessClient interface {
+	Ping(ctx context.Context) (types.Ping, error)
+	Info(ctx context.Context) (types.Info, error)
+	NodeList(ctx context.Context, options types.NodeListOptions) ([]swarm.Node, error)
+	NetworkLister
+}
+
+// Readiness is the result of a readiness check
+type Readiness struct {
+	Ready     bool             `json:"ready"`
+	CheckedAt time.Time        `json:"checkedAt"`
+	Checks    []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessCheck is the result of one of the checks which make up Readiness
+type ReadinessCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// ReadinessChecker checks that Docker is reachable, that the node is an active Swarm
+// manager of a swarm with quorum, and that the functions network exists. Results are
+// cached for the TTL, so that frequent probes do not each call the Docker API.
+type ReadinessChecker struct {
+	client       ReadinessClient
+	networkLabel string
+	ttl          time.Duration
+	now          func() time.Time
+
+	mu   sync.Mutex
+	last *Readiness
+}
+
+// NewReadinessChecker creates a ReadinessChecker which caches results for ttl, the network
+// of the default namespace is the one with the NetworkLabel of settings
+func NewReadinessChecker(c ReadinessClient, settings ProviderSettings, ttl time.Duration) *ReadinessChecker {
+	return &ReadinessChecker{
+		client:       c,
+		networkLabel: settings.NetworkLabel,
+		ttl:          ttl,
+		now:          time.Now,
+	}
+}
+
+// Check returns the cached readiness, or checks again when it is older than the TTL.
+// Concurrent callers wait for a single check. The check is not bound to any request, so
+// that a cancelled probe is not cached as a failure.
+func (c *ReadinessChecker) Check() Readiness {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last != nil && c.now().Sub(c.last.CheckedAt) < c.ttl {
+		return *c.last
+	}
+
+	readiness := c.check()
+	c.last = &readiness
+
+	return readiness
+}
+
+func (c *ReadinessChecker) check() Readiness {
+	ctx, cancel := context.WithTimeout(context.Background(), readinessCheckTimeout)
+	defer cancel()
+
+	readiness := Readiness{CheckedAt: c.now()}
+
+	if _, err := c.client.Ping(ctx); err != nil {
+		readiness.Checks = append(readiness.Checks, ReadinessCheck{Name: ReadinessCheckDocker, Message: err.Error()})
+		return readiness
+	}
+	readiness.Checks = append(readiness.Checks, ReadinessCheck{Name: ReadinessCheckDocker, OK: true})
+
+	readiness.Checks = append(readiness.Checks,
+		c.checkManager(ctx),
+		c.checkQuorum(ctx),
+		c.checkNetwork(ctx),
+	)
+
+	readiness.Ready = true
+	for _, check := range readiness.Checks {
+		readiness.Ready = readiness.Ready && check.OK
+	}
+
+	return readiness
+}
+
+// checkManager checks that the node is an active Swarm manager
+func (c *ReadinessChecker) checkManager(ctx context.Context) ReadinessCheck {
+	check := ReadinessCheck{Name: ReadinessCheckManager}
+
+	info, err := c.client.Info(ctx)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	switch {
+	case info.Swarm.LocalNodeState != swarm.LocalNodeStateActive:
+		check.Message = fmt.Sprintf("swarm state is %q", info.Swarm.LocalNodeState)
+	case !info.Swarm.ControlAvailable:
+		check.Message = "node is not a swarm manager"
+	default:
+		check.OK = true
+	}
+
+	return check
+}
+
+// checkQuorum checks that a majority of the managers are reachable, without quorum the
+// swarm has no leader and services can not be changed
+func (c *ReadinessChecker) checkQuorum(ctx context.Context) ReadinessCheck {
+	check := ReadinessCheck{Name: ReadinessCheckQuorum}
+
+	managerFilter := filters.NewArgs()
+	managerFilter.Add("role", string(swarm.NodeRoleManager))
+
+	managers, err := c.client.NodeList(ctx, types.NodeListOptions{Filters: managerFilter})
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	reachable := 0
+	for _, manager := range managers {
+		if manager.ManagerStatus != nil && manager.ManagerStatus.Reachability == swarm.ReachabilityReachable {
+			reachable++
+		}
+	}
+
+	if reachable <= len(managers)/2 {
+		check.Message = fmt.Sprintf("%d of %d managers reachable", reachable, len(managers))
+		return check
+	}
+
+	check.OK = true
+	return check
+}
+
+// checkNetwork checks that the overlay network of the default namespace exists
+func (c *ReadinessChecker) checkNetwork(ctx context.Context) ReadinessCheck {
+	check := ReadinessCheck{Name: ReadinessCheckNetwork}
+
+	networkFilter := filters.NewArgs()
+	networkFilter.Add("label", c.networkLabel)
+
+	networks, err := c.client.NetworkList(ctx, types.NetworkListOptions{Filters: networkFilter})
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	if len(networks) == 0 {
+		check.Message = fmt.Sprintf("no network labelled %s", c.networkLabel)
+		return check
+	}
+
+	check.OK = true
+	return check
+}
+
+// ReadinessHandler writes the readiness of the provider, with 200 when it is ready and
+// 503 when any check fails or the provider is draining
+func ReadinessHandler(checker *ReadinessChecker, drainer *Drainer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness := checker.Check()
+
+		if drainer.Draining() {
+			readiness.Ready = false
+			// copied, so that the cached checks are left unchanged
+			readiness.Checks = append(append([]ReadinessCheck{}, readiness.Checks...), ReadinessCheck{Name: ReadinessCheckDrain, Message: "provider is shutting down"})
+		}
+
+		body, err := json.Marshal(readiness)
+		if err != nil {
+			writeError(w, ErrorCodeInternal, "", err)
+			return
+		}
+
+		status := http.StatusOK
+		if !readiness.Ready {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
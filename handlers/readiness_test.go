@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+type fakeReadinessClient struct {
+	pingErr  error
+	info     types.Info
+	managers []swarm.Node
+	networks []types.NetworkResource
+
+	pings int
+}
+
+func (f *fakeReadinessClient) Ping(ctx context.Context) (types.Ping, error) {
+	f.pings++
+	return types.Ping{}, f.pingErr
+}
+
+func (f *fakeReadinessClient) Info(ctx context.Context) (types.Info, error) {
+	return f.info, nil
+}
+
+func (f *fakeReadinessClient) NodeList(ctx context.Context, options types.NodeListOptions) ([]swarm.Node, error) {
+	return f.managers, nil
+}
+
+func (f *fakeReadinessClient) NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	return f.networks, nil
+}
+
+func makeManager(reachability swarm.Reachability) swarm.Node {
+	return swarm.Node{ManagerStatus: &swarm.ManagerStatus{Reachability: reachability}}
+}
+
+func makeReadyClient() *fakeReadinessClient {
+	return &fakeReadinessClient{
+		info: types.Info{Swarm: swarm.Info{LocalNodeState: swarm.LocalNodeStateActive, ControlAvailable: true}},
+		managers: []swarm.Node{
+			makeManager(swarm.ReachabilityReachable),
+			makeManager(swarm.ReachabilityReachable),
+			makeManager(swarm.ReachabilityUnreachable),
+		},
+		networks: []types.NetworkResource{{Name: "func_functions"}},
+	}
+}
+
+func readReadiness(t *testing.T, handler http.HandlerFunc) (int, Readiness) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	readiness := Readiness{}
+	if err := json.Unmarshal(w.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("unable to parse response: %s", err)
+	}
+
+	return w.Code, readiness
+}
+
+func failedChecks(readiness Readiness) []string {
+	failed := []string{}
+	for _, check := range readiness.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name)
+		}
+	}
+
+	return failed
+}
+
+func Test_Readiness(t *testing.T) {
+	cases := []struct {
+		name       string
+		modify     func(c *fakeReadinessClient)
+		wantFailed []string
+	}{
+		{
+			name:       "ready",
+			modify:     func(c *fakeReadinessClient) {},
+			wantFailed: []string{},
+		},
+		{
+			name:       "docker unreachable",
+			modify:     func(c *fakeReadinessClient) { c.pingErr = errors.New("connection refused") },
+			wantFailed: []string{ReadinessCheckDocker},
+		},
+		{
+			name:       "worker node",
+			modify:     func(c *fakeReadinessClient) { c.info.Swarm.ControlAvailable = false },
+			wantFailed: []string{ReadinessCheckManager},
+		},
+		{
+			name: "no quorum",
+			modify: func(c *fakeReadinessClient) {
+				c.managers[1] = makeManager(swarm.ReachabilityUnreachable)
+			},
+			wantFailed: []string{ReadinessCheckQuorum},
+		},
+		{
+			name:       "no functions network",
+			modify:     func(c *fakeReadinessClient) { c.networks = nil },
+			wantFailed: []string{ReadinessCheckNetwork},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := makeReadyClient()
+			c.modify(client)
+
+			code, readiness := readReadiness(t, ReadinessHandler(NewReadinessChecker(client, testSettings, time.Second), nil))
+
+			wantCode := http.StatusOK
+			if len(c.wantFailed) > 0 {
+				wantCode = http.StatusServiceUnavailable
+			}
+
+			if code != wantCode || readiness.Ready != (len(c.wantFailed) == 0) {
+				t.Errorf("want status: %d, got: %d, ready: %v", wantCode, code, readiness.Ready)
+			}
+
+			if failed := failedChecks(readiness); len(failed) != len(c.wantFailed) || (len(failed) > 0 && failed[0] != c.wantFailed[0]) {
+				t.Errorf("want failed checks: %v, got: %v", c.wantFailed, failed)
+			}
+		})
+	}
+}
+
+func Test_Readiness_Cached(t *testing.T) {
+	client := makeReadyClient()
+	checker := NewReadinessChecker(client, testSettings, time.Minute)
+
+	now := time.Now()
+	checker.now = func() time.Time { return now }
+
+	checker.Check()
+	checker.Check()
+	if client.pings != 1 {
+		t.Errorf("want 1 check within the TTL, got: %d", client.pings)
+	}
+
+	now = now.Add(time.Minute)
+	checker.Check()
+	if client.pings != 2 {
+		t.Errorf("want a new check after the TTL, got: %d", client.pings)
+	}
+}
+
+func Test_Readiness_Draining(t *testing.T) {
+	drainer := &Drainer{}
+	drainer.Drain()
+
+	code, readiness := readReadiness(t, ReadinessHandler(NewReadinessChecker(makeReadyClient(), testSettings, time.Second), drainer))
+
+	if code != http.StatusServiceUnavailable || readiness.Ready {
+		t.Errorf("want not ready while draining, got: %d, ready: %v", code, readiness.Ready)
+	}
+}
@@ -10,58 +10,139 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
-	"github.com/docker/docker/client"
 	"github.com/gorilla/mux"
 
 	typesv1 "github.com/openfaas/faas-provider/types"
 )
 
+// ServiceTaskLister is the subset of the Docker client.ServiceAPIClient needed to read the
+// replicas of a function. This interface is satisfied by *client.Client and *Inventory
+type ServiceTaskLister interface {
+	ServiceLister
+	TaskLister
+}
+
+// FunctionReplicaStatus is the status of a function returned by the ReplicaReader, with
+// its recent tasks to explain why replicas are not available
+type FunctionReplicaStatus struct {
+	typesv1.FunctionStatus
+
+	// Tasks are the most recent tasks of the function, newest first
+	Tasks []TaskStatus `json:"tasks"`
+	// MaxRestarts is the number of times a failed task is restarted, when it is limited
+	MaxRestarts *uint64 `json:"maxRestarts,omitempty"`
+	// RestartsExhausted is true when a replica has failed more times than MaxRestarts, and
+	// will not be restarted until the function is updated or scaled
+	RestartsExhausted bool `json:"restartsExhausted"`
+}
+
 // ReplicaReader reads replica and image status data from a function
-func ReplicaReader(c *client.Client) http.HandlerFunc {
+func ReplicaReader(c ServiceTaskLister, counter InvocationCounter) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		functionName := vars["name"]
+		namespace := getRequestNamespace(r)
+		serviceName := namespacedName(functionName, namespace)
 
-		log.Printf("ReplicaReader - reading function: %s\n", functionName)
+		log.Printf("ReplicaReader - reading function: %s, namespace: %s\n", functionName, namespace)
 
-		functions, err := readServices(c)
+		serviceFilter := filters.NewArgs()
+		serviceFilter.Add("name", serviceName)
+
+		services, err := c.ServiceList(context.Background(), types.ServiceListOptions{Filters: serviceFilter})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+			writeDockerError(w, functionName, fmt.Errorf("error getting service list: %w", err))
 			return
 		}
 
-		var found *typesv1.FunctionStatus
-		for _, function := range functions {
-			if function.Name == functionName {
-				found = &function
+		// the name filter matches on prefix, so check for the exact service name
+		var found *swarm.Service
+		for i, service := range services {
+			if service.Spec.Name == serviceName && isFunctionService(service) &&
+				namespaceFromLabels(service.Spec.Labels) == namespace {
+				found = &services[i]
 				break
 			}
 		}
 
 		if found == nil {
-			w.WriteHeader(404)
+			writeError(w, ErrorCodeNotFound, functionName, fmt.Errorf("no such service found: %s", functionName))
 			return
 		}
 
-		replicas, replicaErr := getAvailableReplicas(c, found.Name)
+		status := FunctionReplicaStatus{
+			FunctionStatus: functionStatus(*found, namespace, counter),
+			Tasks:          []TaskStatus{},
+		}
+
+		replicas, replicaErr := getAvailableReplicas(c, serviceName)
 		if replicaErr != nil {
 			log.Printf("%s\n", replicaErr.Error())
 
 			// Fail-over as 0
 		}
 
-		found.AvailableReplicas = replicas
+		status.AvailableReplicas = replicas
+
+		taskFilter := filters.NewArgs()
+		taskFilter.Add("service", serviceName)
+
+		tasks, err := c.TaskList(context.Background(), types.TaskListOptions{Filters: taskFilter})
+		if err != nil {
+			log.Printf("Error listing tasks of %s: %s\n", serviceName, err)
+		}
+
+		for _, task := range recentTasks(tasks) {
+			status.Tasks = append(status.Tasks, taskStatus(task))
+		}
+
+		if policy := found.Spec.TaskTemplate.RestartPolicy; policy != nil && policy.MaxAttempts != nil && *policy.MaxAttempts > 0 {
+			status.MaxRestarts = policy.MaxAttempts
+			status.RestartsExhausted = restartsExhausted(tasks, status.Replicas)
+		}
 
-		functionBytes, _ := json.Marshal(found)
+		functionBytes, _ := json.Marshal(status)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(200)
 		w.Write(functionBytes)
 	}
 }
 
-func getAvailableReplicas(c *client.Client, service string) (uint64, error) {
+// TaskLister is the subset of the Docker client.ServiceAPIClient needed to count the
+// running tasks of a service. This interface is satisfied by *client.Client
+type TaskLister interface {
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+}
+
+// restartsExhausted returns true when a replica of a service is no longer restarted. Swarm
+// leaves the last task of a slot which has used all of its restart attempts failed, without
+// creating a task to replace it.
+func restartsExhausted(tasks []swarm.Task, replicas uint64) bool {
+	latest := map[int]swarm.Task{}
+	for _, task := range tasks {
+		if current, ok := latest[task.Slot]; !ok || task.Status.Timestamp.After(current.Status.Timestamp) {
+			latest[task.Slot] = task
+		}
+	}
+
+	for slot, task := range latest {
+		if slot < 1 || uint64(slot) > replicas {
+			continue
+		}
+
+		switch task.Status.State {
+		case swarm.TaskStateFailed, swarm.TaskStateRejected:
+			if task.DesiredState != swarm.TaskStateRunning && task.DesiredState != swarm.TaskStateReady {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func getAvailableReplicas(c TaskLister, service string) (uint64, error) {
 
 	taskFilter := filters.NewArgs()
 	taskFilter.Add("_up-to-date", "true")
@@ -70,7 +151,7 @@ func getAvailableReplicas(c *client.Client, service string) (uint64, error) {
 
 	tasks, err := c.TaskList(context.Background(), types.TaskListOptions{Filters: taskFilter})
 	if err != nil {
-		return 0, fmt.Errorf("getAvailableReplicas for: %s failed %s", service, err.Error())
+		return 0, fmt.Errorf("getAvailableReplicas for: %s failed %w", service, err)
 	}
 
 	replicas := uint64(0)
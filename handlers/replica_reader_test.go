@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/mux"
+)
+
+func makeReplicaService(replicas uint64, maxAttempts uint64) swarm.Service {
+	service := makeInventoryService("1", "echo", nil)
+	service.Spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+	service.Spec.TaskTemplate.RestartPolicy = &swarm.RestartPolicy{MaxAttempts: &maxAttempts}
+
+	return service
+}
+
+func makeReplicaTask(id string, slot int, state swarm.TaskState, desired swarm.TaskState, exitCode int, age time.Duration) swarm.Task {
+	task := makeStatusTask(id, state, "", age)
+	task.Slot = slot
+	task.DesiredState = desired
+	task.Status.ContainerStatus = &swarm.ContainerStatus{ExitCode: exitCode}
+
+	return task
+}
+
+func Test_ReplicaReader_TaskFailures(t *testing.T) {
+	c := &fakeInventoryClient{
+		services: []swarm.Service{makeReplicaService(2, 5)},
+		tasks: []swarm.Task{
+			makeReplicaTask("a", 1, swarm.TaskStateRunning, swarm.TaskStateRunning, 0, time.Minute),
+			makeReplicaTask("b", 2, swarm.TaskStateFailed, swarm.TaskStateShutdown, 137, time.Second),
+			makeReplicaTask("c", 2, swarm.TaskStateFailed, swarm.TaskStateShutdown, 1, 2*time.Second),
+		},
+	}
+	c.tasks[1].Status.Err = "task: non-zero exit (137)"
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/system/function/echo", nil), map[string]string{"name": "echo"})
+	w := httptest.NewRecorder()
+
+	ReplicaReader(c, nil).ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d, body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	status := FunctionReplicaStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("unable to parse response: %s", err)
+	}
+
+	if status.Name != "echo" || status.AvailableReplicas != 1 {
+		t.Errorf("want echo with 1 available replica, got: %s with %d", status.Name, status.AvailableReplicas)
+	}
+
+	if len(status.Tasks) != 3 || status.Tasks[0].ID != "b" {
+		t.Fatalf("want 3 tasks, newest first, got: %+v", status.Tasks)
+	}
+
+	if status.Tasks[0].Error != "task: non-zero exit (137)" || status.Tasks[0].ExitCode == nil || *status.Tasks[0].ExitCode != 137 {
+		t.Errorf("want error and exit code 137, got: %+v", status.Tasks[0])
+	}
+
+	if status.Tasks[2].ExitCode != nil {
+		t.Errorf("want no exit code for a running task, got: %d", *status.Tasks[2].ExitCode)
+	}
+
+	if !status.RestartsExhausted || status.MaxRestarts == nil || *status.MaxRestarts != 5 {
+		t.Errorf("want restarts exhausted with max restarts 5, got: %v, %v", status.RestartsExhausted, status.MaxRestarts)
+	}
+}
+
+func Test_RestartsExhausted(t *testing.T) {
+	cases := []struct {
+		name  string
+		tasks []swarm.Task
+		want  bool
+	}{
+		{
+			name: "failed task replaced",
+			tasks: []swarm.Task{
+				makeReplicaTask("a", 1, swarm.TaskStateFailed, swarm.TaskStateShutdown, 1, time.Minute),
+				makeReplicaTask("b", 1, swarm.TaskStatePending, swarm.TaskStateReady, 0, time.Second),
+			},
+		},
+		{
+			name: "failed task not yet restarted",
+			tasks: []swarm.Task{
+				makeReplicaTask("a", 1, swarm.TaskStateFailed, swarm.TaskStateRunning, 1, time.Second),
+			},
+		},
+		{
+			name: "failed task in a slot scaled away",
+			tasks: []swarm.Task{
+				makeReplicaTask("a", 1, swarm.TaskStateRunning, swarm.TaskStateRunning, 0, time.Minute),
+				makeReplicaTask("b", 2, swarm.TaskStateFailed, swarm.TaskStateShutdown, 1, time.Second),
+			},
+		},
+		{
+			name: "failed task left without a replacement",
+			tasks: []swarm.Task{
+				makeReplicaTask("a", 1, swarm.TaskStateFailed, swarm.TaskStateShutdown, 1, time.Second),
+			},
+			want: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := restartsExhausted(c.tasks, 1); got != c.want {
+				t.Errorf("want: %v, got: %v", c.want, got)
+			}
+		})
+	}
+}
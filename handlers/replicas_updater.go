@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -20,15 +21,16 @@ type ScaleServiceRequest struct {
 }
 
 // ReplicaUpdater updates a function
-func ReplicaUpdater(c *client.Client) http.HandlerFunc {
-	serviceQuery := NewSwarmServiceQuery(c)
+func ReplicaUpdater(c *client.Client, settings ProviderSettings) http.HandlerFunc {
+	serviceQuery := NewSwarmServiceQuery(c, settings.MaxReplicas)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		vars := mux.Vars(r)
 		functionName := vars["name"]
+		namespace := getRequestNamespace(r)
 
-		log.Printf("ReplicaUpdater - updating function: %s\n", functionName)
+		log.Printf("ReplicaUpdater - updating function: %s, namespace: %s\n", functionName, namespace)
 
 		req := ScaleServiceRequest{}
 
@@ -42,19 +44,33 @@ func ReplicaUpdater(c *client.Client) http.HandlerFunc {
 
 				log.Println(msg, marshalErr)
 
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte(msg))
+				writeError(w, ErrorCodeInvalidRequest, functionName, fmt.Errorf("%s %w", msg, marshalErr))
 				return
 			}
 		}
 
+		serviceName := namespacedName(functionName, namespace)
+
+		// the name may contain the namespace separator, so the service must be checked to be
+		// a function of the namespace the request was made for
+		service, _, err := c.ServiceInspectWithRaw(context.Background(), serviceName, types.ServiceInspectOptions{})
+		if err != nil {
+			log.Printf("Error inspecting service %s: %s\n", serviceName, err)
+			writeDockerError(w, functionName, err)
+			return
+		}
+
+		if !isFunctionService(service) || namespaceFromLabels(service.Spec.Labels) != normalizeNamespace(namespace) {
+			writeError(w, ErrorCodeNotFound, functionName, fmt.Errorf("no such service found: %s", functionName))
+			return
+		}
+
 		log.Printf("Scaling %s to %d replicas", functionName, req.Replicas)
 
-		scaleErr := scaleService(functionName, req.Replicas, serviceQuery)
+		scaleErr := scaleService(serviceName, req.Replicas, serviceQuery)
 		if scaleErr != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(scaleErr.Error()))
 			log.Println(scaleErr.Error())
+			writeDockerError(w, functionName, scaleErr)
 			return
 		}
 
@@ -90,16 +106,19 @@ type ServiceQuery interface {
 	SetReplicas(service string, count uint64) error
 }
 
-// NewSwarmServiceQuery create new Docker Swarm implementation
-func NewSwarmServiceQuery(c *client.Client) ServiceQuery {
+// NewSwarmServiceQuery create new Docker Swarm implementation, maxReplicas is the maximum of
+// functions which do not set MaxScaleLabel
+func NewSwarmServiceQuery(c *client.Client, maxReplicas int) ServiceQuery {
 	return SwarmServiceQuery{
-		c: c,
+		c:           c,
+		maxReplicas: maxReplicas,
 	}
 }
 
 // SwarmServiceQuery implementation for Docker Swarm
 type SwarmServiceQuery struct {
-	c *client.Client
+	c           *client.Client
+	maxReplicas int
 }
 
 // GetReplicas replica count for function
@@ -107,7 +126,7 @@ func (s SwarmServiceQuery) GetReplicas(serviceName string) (uint64, uint64, uint
 	var err error
 	var currentReplicas uint64
 
-	maxReplicas := uint64(DefaultMaxReplicas)
+	maxReplicas := uint64(s.maxReplicas)
 	minReplicas := uint64(1)
 
 	opts := types.ServiceInspectOptions{
@@ -118,30 +137,40 @@ func (s SwarmServiceQuery) GetReplicas(serviceName string) (uint64, uint64, uint
 
 	if err == nil {
 		currentReplicas = *service.Spec.Mode.Replicated.Replicas
+		minReplicas, maxReplicas = getScaleBounds(service.Spec.Annotations.Labels, s.maxReplicas)
+	}
 
-		minScale := service.Spec.Annotations.Labels[MinScaleLabel]
-		maxScale := service.Spec.Annotations.Labels[MaxScaleLabel]
+	return currentReplicas, maxReplicas, minReplicas, err
+}
 
-		if len(maxScale) > 0 {
-			labelValue, err := strconv.Atoi(maxScale)
-			if err != nil {
-				log.Printf("Bad replica count: %s, should be uint", maxScale)
-			} else {
-				maxReplicas = uint64(labelValue)
-			}
+// getScaleBounds reads the min and max replica counts from the labels of a function,
+// falling back to 1 and defaultMax.
+func getScaleBounds(labels map[string]string, defaultMax int) (minReplicas uint64, maxReplicas uint64) {
+	minReplicas = uint64(1)
+	maxReplicas = uint64(defaultMax)
+
+	minScale := labels[MinScaleLabel]
+	maxScale := labels[MaxScaleLabel]
+
+	if len(maxScale) > 0 {
+		labelValue, err := strconv.Atoi(maxScale)
+		if err != nil {
+			log.Printf("Bad replica count: %s, should be uint", maxScale)
+		} else {
+			maxReplicas = uint64(labelValue)
 		}
+	}
 
-		if len(minScale) > 0 {
-			labelValue, err := strconv.Atoi(maxScale)
-			if err != nil {
-				log.Printf("Bad replica count: %s, should be uint", minScale)
-			} else {
-				minReplicas = uint64(labelValue)
-			}
+	if len(minScale) > 0 {
+		labelValue, err := strconv.Atoi(minScale)
+		if err != nil {
+			log.Printf("Bad replica count: %s, should be uint", minScale)
+		} else {
+			minReplicas = uint64(labelValue)
 		}
 	}
 
-	return currentReplicas, maxReplicas, minReplicas, err
+	return minReplicas, maxReplicas
 }
 
 // SetReplicas update the replica count
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// Annotations which control when and how often the tasks of a function are restarted
+const (
+	// RestartConditionAnnotation is when a task is restarted: any, on-failure or none
+	RestartConditionAnnotation = "com.openfaas.restart.condition"
+	// RestartDelayAnnotation is the time waited before a task is restarted, i.e. 5s
+	RestartDelayAnnotation = "com.openfaas.restart.delay"
+	// RestartMaxAttemptsAnnotation is the number of times a task is restarted before it is
+	// left failed, 0 restarts it without a limit
+	RestartMaxAttemptsAnnotation = "com.openfaas.restart.max-attempts"
+	// RestartWindowAnnotation is the time over which restart attempts are counted, 0 counts
+	// every attempt
+	RestartWindowAnnotation = "com.openfaas.restart.window"
+)
+
+// RestartPolicyDefaults is the restart policy of functions which do not set it with
+// annotations
+type RestartPolicyDefaults struct {
+	// Condition is when a task is restarted: any, on-failure or none
+	Condition string
+	// MaxAttempts is the number of times a task is restarted, 0 for no limit
+	MaxAttempts uint64
+	// Delay is the time waited before a task is restarted
+	Delay time.Duration
+	// Window is the time over which restart attempts are counted, 0 for all attempts
+	Window time.Duration
+}
+
+// IsRestartCondition returns true for the restart conditions supported by Swarm
+func IsRestartCondition(condition string) bool {
+	switch swarm.RestartPolicyCondition(condition) {
+	case swarm.RestartPolicyConditionAny, swarm.RestartPolicyConditionOnFailure, swarm.RestartPolicyConditionNone:
+		return true
+	}
+
+	return false
+}
+
+// buildRestartPolicy returns the restart policy for a function from its annotations, using
+// the defaults for any which are not set. Invalid annotations are returned as a
+// *ValidationError.
+func buildRestartPolicy(annotations map[string]string, defaults RestartPolicyDefaults) (*swarm.RestartPolicy, error) {
+	validationErr := &ValidationError{}
+
+	condition := swarm.RestartPolicyCondition(defaults.Condition)
+	if len(condition) == 0 {
+		condition = swarm.RestartPolicyConditionAny
+	}
+
+	maxAttempts := defaults.MaxAttempts
+	delay := defaults.Delay
+	window := defaults.Window
+
+	if value, ok := annotations[RestartConditionAnnotation]; ok {
+		if IsRestartCondition(value) {
+			condition = swarm.RestartPolicyCondition(value)
+		} else {
+			validationErr.add("annotations."+RestartConditionAnnotation, "%q must be %s, %s or %s", value,
+				swarm.RestartPolicyConditionAny, swarm.RestartPolicyConditionOnFailure, swarm.RestartPolicyConditionNone)
+		}
+	}
+
+	if value, ok := annotations[RestartDelayAnnotation]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			validationErr.add("annotations."+RestartDelayAnnotation, "%q must be a duration, i.e. 5s", value)
+		}
+		delay = parsed
+	}
+
+	if value, ok := annotations[RestartMaxAttemptsAnnotation]; ok {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			validationErr.add("annotations."+RestartMaxAttemptsAnnotation, "%q must be a whole number of attempts", value)
+		}
+		maxAttempts = parsed
+	}
+
+	if value, ok := annotations[RestartWindowAnnotation]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			validationErr.add("annotations."+RestartWindowAnnotation, "%q must be a duration, i.e. 2m", value)
+		}
+		window = parsed
+	}
+
+	if len(validationErr.Errors) > 0 {
+		return nil, validationErr
+	}
+
+	return &swarm.RestartPolicy{
+		Condition:   condition,
+		Delay:       &delay,
+		MaxAttempts: &maxAttempts,
+		Window:      &window,
+	}, nil
+}
+
+// restartPolicyAnnotations returns the annotations describing a restart policy, so that
+// the policy in effect is shown for every function
+func restartPolicyAnnotations(policy *swarm.RestartPolicy) map[string]string {
+	if policy == nil {
+		return nil
+	}
+
+	annotations := map[string]string{
+		RestartConditionAnnotation: string(policy.Condition),
+	}
+
+	if policy.Delay != nil {
+		annotations[RestartDelayAnnotation] = policy.Delay.String()
+	}
+
+	if policy.MaxAttempts != nil {
+		annotations[RestartMaxAttemptsAnnotation] = strconv.FormatUint(*policy.MaxAttempts, 10)
+	}
+
+	if policy.Window != nil {
+		annotations[RestartWindowAnnotation] = policy.Window.String()
+	}
+
+	return annotations
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+var testRestartDefaults = RestartPolicyDefaults{
+	Condition:   "any",
+	MaxAttempts: 5,
+	Delay:       5 * time.Second,
+}
+
+func Test_BuildRestartPolicy_Defaults(t *testing.T) {
+	policy, err := buildRestartPolicy(nil, testRestartDefaults)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	want := map[string]string{
+		RestartConditionAnnotation:   "any",
+		RestartDelayAnnotation:       "5s",
+		RestartMaxAttemptsAnnotation: "5",
+		RestartWindowAnnotation:      "0s",
+	}
+
+	if got := restartPolicyAnnotations(policy); !reflect.DeepEqual(got, want) {
+		t.Errorf("want policy: %v, got: %v", want, got)
+	}
+}
+
+func Test_BuildRestartPolicy_Annotations(t *testing.T) {
+	policy, err := buildRestartPolicy(map[string]string{
+		RestartConditionAnnotation:   "on-failure",
+		RestartDelayAnnotation:       "500ms",
+		RestartMaxAttemptsAnnotation: "3",
+		RestartWindowAnnotation:      "2m",
+	}, testRestartDefaults)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	if policy.Condition != swarm.RestartPolicyConditionOnFailure {
+		t.Errorf("want condition: on-failure, got: %s", policy.Condition)
+	}
+
+	if *policy.Delay != 500*time.Millisecond || *policy.MaxAttempts != 3 || *policy.Window != 2*time.Minute {
+		t.Errorf("want delay 500ms, 3 attempts and window 2m, got: %s, %d, %s", *policy.Delay, *policy.MaxAttempts, *policy.Window)
+	}
+}
+
+func Test_BuildRestartPolicy_Invalid(t *testing.T) {
+	_, err := buildRestartPolicy(map[string]string{
+		RestartConditionAnnotation:   "always",
+		RestartDelayAnnotation:       "soon",
+		RestartMaxAttemptsAnnotation: "-1",
+		RestartWindowAnnotation:      "-2m",
+	}, testRestartDefaults)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("want *ValidationError, got: %v", err)
+	}
+
+	var fields []string
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+
+	want := []string{
+		"annotations." + RestartConditionAnnotation,
+		"annotations." + RestartDelayAnnotation,
+		"annotations." + RestartMaxAttemptsAnnotation,
+		"annotations." + RestartWindowAnnotation,
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("want field errors: %v, got: %v", want, fields)
+	}
+}
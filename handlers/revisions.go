@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/gorilla/mux"
+	typesv1 "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas-swarm/authentication"
+)
+
+const (
+	// revisionFunctionLabel marks the Swarm config objects that hold the revisions of a
+	// function, the value is the name of its service
+	revisionFunctionLabel = "com.openfaas.revision.function"
+	// revisionLabel is the revision number held by a config
+	revisionLabel = "com.openfaas.revision"
+)
+
+// Revision actions
+const (
+	RevisionDeploy   = "deploy"
+	RevisionUpdate   = "update"
+	RevisionRollback = "rollback"
+)
+
+// Revision records the spec of a function after it was deployed, updated or rolled back
+type Revision struct {
+	Revision  uint64    `json:"revision"`
+	Function  string    `json:"function"`
+	Namespace string    `json:"namespace"`
+	Timestamp time.Time `json:"timestamp"`
+	// Caller is the basic auth user of the request, or its remote address
+	Caller string `json:"caller"`
+	// Action is one of deploy, update or rollback
+	Action string `json:"action"`
+	// RestoredRevision is the revision a rollback restored, when it was to a revision
+	RestoredRevision uint64       `json:"restoredRevision,omitempty"`
+	Spec             FunctionSpec `json:"spec"`
+}
+
+// RevisionHistory keeps the most recent revisions of each function in Swarm config
+// objects, which are immutable so each revision is a new config. History is kept after
+// a function is removed, so that a function deployed again continues its numbering.
+type RevisionHistory struct {
+	client   ConfigLister
+	settings ProviderSettings
+	limit    int
+	mu       sync.Mutex
+	now      func() time.Time
+}
+
+// NewRevisionHistory creates a RevisionHistory keeping up to limit revisions per function,
+// its configs are marked with the owner label of settings
+func NewRevisionHistory(c ConfigLister, settings ProviderSettings, limit int) *RevisionHistory {
+	return &RevisionHistory{
+		client:   c,
+		settings: settings,
+		limit:    limit,
+		now:      time.Now,
+	}
+}
+
+// Record saves the spec of a service as the next revision of its function. Errors are
+// logged rather than returned, as the change to the function has already been made.
+func (h *RevisionHistory) Record(r *http.Request, action string, restored uint64, spec swarm.ServiceSpec) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	configs, err := h.list(spec.Name)
+	if err != nil {
+		log.Printf("Error listing revisions of %s: %s\n", spec.Name, err)
+		return
+	}
+
+	next := uint64(1)
+	if len(configs) > 0 {
+		next = configRevision(configs[len(configs)-1]) + 1
+	}
+
+	revision := Revision{
+		Revision:         next,
+		Function:         functionName(spec),
+		Namespace:        namespaceFromLabels(spec.Labels),
+		Timestamp:        h.now().UTC(),
+		Caller:           requestCaller(r),
+		Action:           action,
+		RestoredRevision: restored,
+		Spec:             functionSpec(spec),
+	}
+
+	data, err := json.Marshal(revision)
+	if err != nil {
+		log.Printf("Error recording revision of %s: %s\n", spec.Name, err)
+		return
+	}
+
+	_, err = h.client.ConfigCreate(context.Background(), swarm.ConfigSpec{
+		Annotations: swarm.Annotations{
+			Name: fmt.Sprintf("openfaas-revision-%d", h.now().UnixNano()),
+			Labels: map[string]string{
+				revisionFunctionLabel: spec.Name,
+				revisionLabel:         strconv.FormatUint(next, 10),
+				h.settings.OwnerLabel: h.settings.OwnerLabelValue,
+			},
+		},
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Error recording revision of %s: %s\n", spec.Name, err)
+		return
+	}
+
+	log.Printf("Recorded revision %d of %s\n", next, spec.Name)
+
+	// the new config is not in configs, so one fewer is kept from them
+	for h.limit > 0 && len(configs) >= h.limit {
+		if err := h.client.ConfigRemove(context.Background(), configs[0].ID); err != nil {
+			log.Printf("Error removing revision config %s: %s\n", configs[0].Spec.Name, err)
+		}
+		configs = configs[1:]
+	}
+}
+
+// Revisions returns the revisions of a function service, oldest first
+func (h *RevisionHistory) Revisions(service string) ([]Revision, error) {
+	configs, err := h.list(service)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []Revision{}
+	for _, config := range configs {
+		revision := Revision{}
+		if err := json.Unmarshal(config.Spec.Data, &revision); err != nil {
+			log.Printf("Error parsing revision config %s: %s\n", config.Spec.Name, err)
+			continue
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// list returns the configs holding the revisions of a service, oldest first
+func (h *RevisionHistory) list(service string) ([]swarm.Config, error) {
+	args := filters.NewArgs()
+	args.Add("label", fmt.Sprintf("%s=%s", revisionFunctionLabel, service))
+
+	configs, err := h.client.ConfigList(context.Background(), types.ConfigListOptions{Filters: args})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(configs, func(i, j int) bool {
+		return configRevision(configs[i]) < configRevision(configs[j])
+	})
+
+	return configs, nil
+}
+
+func configRevision(config swarm.Config) uint64 {
+	revision, _ := strconv.ParseUint(config.Spec.Labels[revisionLabel], 10, 64)
+	return revision
+}
+
+// requestCaller identifies who made a request, for the revision history, by its
+// authenticated principal, its basic auth user, then the common name of a verified client
+// certificate, then its remote address
+func requestCaller(r *http.Request) string {
+	if principal := authentication.PrincipalFrom(r.Context()); principal != nil {
+		return principal.Name
+	}
+
+	if user, _, ok := r.BasicAuth(); ok && len(user) > 0 {
+		return user
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		if name := r.TLS.VerifiedChains[0][0].Subject.CommonName; len(name) > 0 {
+			return name
+		}
+	}
+
+	return r.RemoteAddr
+}
+
+// RevisionsHandler lists the revisions of a function
+func RevisionsHandler(history *RevisionHistory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+		service := namespacedName(functionName, getRequestNamespace(r))
+
+		revisions, err := history.Revisions(service)
+		if err != nil {
+			log.Printf("Error listing revisions of %s: %s\n", service, err)
+			writeDockerError(w, functionName, err)
+			return
+		}
+		revisions = revisionsInNamespace(revisions, getRequestNamespace(r))
+
+		body, err := json.Marshal(revisions)
+		if err != nil {
+			writeError(w, ErrorCodeInternal, functionName, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+// RevisionRollbackHandler updates a function to the spec recorded in one of its revisions.
+// Registry auth is not recorded, so the auth of the current spec is used to pull the image.
+func RevisionRollbackHandler(c *client.Client, history *RevisionHistory, settings ProviderSettings, restartPolicy RestartPolicyDefaults) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		functionName := vars["name"]
+		namespace := getRequestNamespace(r)
+
+		number, err := strconv.ParseUint(vars["revision"], 10, 64)
+		if err != nil {
+			writeError(w, ErrorCodeInvalidRequest, functionName, fmt.Errorf("invalid revision: %q", vars["revision"]))
+			return
+		}
+
+		dryRun, err := isDryRun(r)
+		if err != nil {
+			writeError(w, ErrorCodeInvalidRequest, functionName, err)
+			return
+		}
+
+		revisions, err := history.Revisions(namespacedName(functionName, namespace))
+		if err != nil {
+			log.Printf("Error listing revisions of %s: %s\n", functionName, err)
+			writeDockerError(w, functionName, err)
+			return
+		}
+		revisions = revisionsInNamespace(revisions, namespace)
+
+		var revision *Revision
+		for i := range revisions {
+			if revisions[i].Revision == number {
+				revision = &revisions[i]
+			}
+		}
+
+		if revision == nil {
+			writeError(w, ErrorCodeNotFound, functionName, fmt.Errorf("function %s has no revision %d", functionName, number))
+			return
+		}
+
+		request := revisionDeployment(*revision)
+
+		log.Printf("Rolling back %s to revision %d, image: %s\n", functionName, number, request.Image)
+
+		spec, warnings, err := updateFunction(c, &request, dryRun, settings, restartPolicy)
+		if err != nil {
+			log.Printf("Error rolling back %s: %s\n", functionName, err)
+			writeError(w, dockerErrorCode(err, ErrorCodeInvalidSpec), functionName, err)
+			return
+		}
+
+		if dryRun {
+			writeDryRun(w, spec, warnings)
+			return
+		}
+
+		history.Record(r, RevisionRollback, number, spec)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// revisionsInNamespace returns the revisions of functions in the namespace, as a name
+// containing the namespace separator can name the service of another namespace
+func revisionsInNamespace(revisions []Revision, namespace string) []Revision {
+	filtered := []Revision{}
+	for _, revision := range revisions {
+		if revision.Namespace == normalizeNamespace(namespace) {
+			filtered = append(filtered, revision)
+		}
+	}
+
+	return filtered
+}
+
+// revisionDeployment returns the function deployment which restores a revision
+func revisionDeployment(revision Revision) typesv1.FunctionDeployment {
+	spec := revision.Spec
+
+	request := typesv1.FunctionDeployment{
+		Service:                revision.Function,
+		Namespace:              revision.Namespace,
+		Image:                  spec.Image,
+		Network:                spec.Network,
+		EnvVars:                map[string]string{},
+		Constraints:            spec.Constraints,
+		Secrets:                spec.Secrets,
+		Limits:                 spec.Limits,
+		Requests:               spec.Requests,
+		ReadOnlyRootFilesystem: spec.ReadOnlyRootFilesystem,
+	}
+
+	for key, value := range spec.EnvVars {
+		if key == "fprocess" {
+			request.EnvProcess = value
+			continue
+		}
+
+		request.EnvVars[key] = value
+	}
+
+	if spec.Labels != nil {
+		labels := map[string]string{}
+		for key, value := range spec.Labels {
+			labels[key] = value
+		}
+
+		// set again from the request by buildLabels
+		for _, key := range reservedLabels {
+			delete(labels, key)
+		}
+		request.Labels = &labels
+	}
+
+	if spec.Annotations != nil {
+		annotations := map[string]string{}
+		for key, value := range spec.Annotations {
+			annotations[key] = value
+		}
+		request.Annotations = &annotations
+	}
+
+	return request
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func Test_RevisionHistory_Record(t *testing.T) {
+	client := &fakeConfigLister{}
+	history := NewRevisionHistory(client, testSettings, 2)
+
+	clock := time.Date(2020, 12, 15, 0, 0, 0, 0, time.UTC)
+	history.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	r := httptest.NewRequest("PUT", "/system/functions", nil)
+	r.SetBasicAuth("admin", "secret")
+
+	for _, image := range []string{"functions/echo:0.1", "functions/echo:0.2", "functions/echo:0.3"} {
+		history.Record(r, RevisionUpdate, 0, makeRollbackSpec(image, []string{"fprocess=cat"}, nil))
+	}
+
+	revisions, err := history.Revisions("echo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(revisions) != 2 {
+		t.Fatalf("want 2 revisions kept, got: %d", len(revisions))
+	}
+
+	for i, want := range []struct {
+		revision uint64
+		image    string
+	}{{2, "functions/echo:0.2"}, {3, "functions/echo:0.3"}} {
+		if revisions[i].Revision != want.revision || revisions[i].Spec.Image != want.image {
+			t.Errorf("want revision %d with image %s, got: %d, %s", want.revision, want.image, revisions[i].Revision, revisions[i].Spec.Image)
+		}
+	}
+
+	if revisions[1].Caller != "admin" {
+		t.Errorf("want caller: admin, got: %s", revisions[1].Caller)
+	}
+
+	if revisions[1].Function != "echo" || revisions[1].Namespace != DefaultNamespace {
+		t.Errorf("want function echo in %s, got: %s in %s", DefaultNamespace, revisions[1].Function, revisions[1].Namespace)
+	}
+}
+
+func Test_RevisionHistory_RecordNil(t *testing.T) {
+	var history *RevisionHistory
+	history.Record(httptest.NewRequest("POST", "/system/functions", nil), RevisionDeploy, 0, swarm.ServiceSpec{})
+}
+
+func Test_RevisionDeployment(t *testing.T) {
+	spec := makeRollbackSpec("functions/echo:0.1", []string{"fprocess=cat", "write_debug=true"}, map[string]string{
+		"com.openfaas.function":              "echo",
+		"function":                           "true",
+		namespaceLabel:                       "team-a",
+		"team":                               "a",
+		annotationLabelPrefix + "topic":      "orders",
+		annotationLabelPrefix + "maintainer": "ops",
+	})
+
+	revision := Revision{
+		Revision:  1,
+		Function:  "echo",
+		Namespace: "team-a",
+		Spec:      functionSpec(spec),
+	}
+
+	request := revisionDeployment(revision)
+
+	if request.Service != "echo" || request.Namespace != "team-a" || request.Image != "functions/echo:0.1" {
+		t.Errorf("want echo in team-a with image functions/echo:0.1, got: %s in %s with %s", request.Service, request.Namespace, request.Image)
+	}
+
+	if request.EnvProcess != "cat" {
+		t.Errorf("want fprocess: cat, got: %s", request.EnvProcess)
+	}
+
+	if !reflect.DeepEqual(request.EnvVars, map[string]string{"write_debug": "true"}) {
+		t.Errorf("want env vars without fprocess, got: %v", request.EnvVars)
+	}
+
+	if !reflect.DeepEqual(*request.Labels, map[string]string{"team": "a"}) {
+		t.Errorf("want labels without those set by the provider, got: %v", *request.Labels)
+	}
+
+	if !reflect.DeepEqual(*request.Annotations, map[string]string{"topic": "orders", "maintainer": "ops"}) {
+		t.Errorf("want annotations, got: %v", *request.Annotations)
+	}
+
+	if !reflect.DeepEqual(request.Secrets, []string{"api-key"}) {
+		t.Errorf("want secrets: [api-key], got: %v", request.Secrets)
+	}
+}
+
+func Test_RequestCaller_ClientCertificate(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/system/functions", nil)
+	r.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "gateway"}}}},
+	}
+
+	if caller := requestCaller(r); caller != "gateway" {
+		t.Errorf("want caller from the client certificate: gateway, got: %s", caller)
+	}
+
+	r.SetBasicAuth("admin", "secret")
+	if caller := requestCaller(r); caller != "admin" {
+		t.Errorf("want caller from basic auth: admin, got: %s", caller)
+	}
+}
+
+func Test_RevisionsInNamespace(t *testing.T) {
+	revisions := []Revision{
+		{Revision: 1, Function: "api", Namespace: "prod"},
+		{Revision: 2, Function: "api", Namespace: DefaultNamespace},
+	}
+
+	filtered := revisionsInNamespace(revisions, "")
+	if len(filtered) != 1 || filtered[0].Revision != 2 {
+		t.Errorf("want only revision 2 in the default namespace, got: %v", filtered)
+	}
+}
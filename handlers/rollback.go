@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/mux"
+	typesv1 "github.com/openfaas/faas-provider/types"
+)
+
+// ServiceInspectUpdater inspects and updates Swarm services
+type ServiceInspectUpdater interface {
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error)
+}
+
+// FunctionSpec is the part of a function's Swarm service spec set by a deployment
+type FunctionSpec struct {
+	Image       string                     `json:"image"`
+	EnvVars     map[string]string          `json:"envVars,omitempty"`
+	Labels      map[string]string          `json:"labels,omitempty"`
+	Annotations map[string]string          `json:"annotations,omitempty"`
+	Secrets     []string                   `json:"secrets,omitempty"`
+	Constraints []string                   `json:"constraints,omitempty"`
+	Limits      *typesv1.FunctionResources `json:"limits,omitempty"`
+	Requests    *typesv1.FunctionResources `json:"requests,omitempty"`
+	Network     string                     `json:"network,omitempty"`
+
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+}
+
+// SpecChange is a field which differs between two function specs
+type SpecChange struct {
+	// Field is the path of the field, i.e. "image" or "envVars.write_debug"
+	Field    string `json:"field"`
+	Current  string `json:"current"`
+	Previous string `json:"previous"`
+}
+
+// RollbackStatus describes the current and previous spec of a function
+type RollbackStatus struct {
+	Function string        `json:"function"`
+	Current  FunctionSpec  `json:"current"`
+	Previous FunctionSpec  `json:"previous"`
+	Changes  []SpecChange  `json:"changes"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Restored *FunctionSpec `json:"restored,omitempty"`
+}
+
+// RollbackHandler rolls a function back to the spec it had before its last update with
+// POST, using the rollback built into Swarm. GET shows the changes a rollback would make.
+// The restored spec is recorded in history when it is not nil.
+func RollbackHandler(c ServiceInspectUpdater, history *RevisionHistory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		functionName := mux.Vars(r)["name"]
+		namespace := getRequestNamespace(r)
+
+		service, _, err := c.ServiceInspectWithRaw(ctx, namespacedName(functionName, namespace), types.ServiceInspectOptions{})
+		if err != nil {
+			log.Printf("Error inspecting service %s: %s\n", functionName, err)
+			writeDockerError(w, functionName, err)
+			return
+		}
+
+		if !isFunctionService(service) || namespaceFromLabels(service.Spec.Labels) != normalizeNamespace(namespace) {
+			writeError(w, ErrorCodeNotFound, functionName, fmt.Errorf("no such service found: %s", functionName))
+			return
+		}
+
+		if service.PreviousSpec == nil {
+			writeError(w, ErrorCodeNotFound, functionName, fmt.Errorf("function %s has no previous spec to roll back to", functionName))
+			return
+		}
+
+		// scaling a function updates its service, so Swarm would only restore the replicas
+		if onlyScaled(service.Spec, *service.PreviousSpec) {
+			writeError(w, ErrorCodeConflict, functionName,
+				fmt.Errorf("function %s was only scaled since its previous spec, scale it instead of rolling back", functionName))
+			return
+		}
+
+		current := functionSpec(service.Spec)
+		previous := functionSpec(*service.PreviousSpec)
+
+		status := RollbackStatus{
+			Function: functionName,
+			Current:  current,
+			Previous: previous,
+			Changes:  diffFunctionSpecs(current, previous),
+		}
+
+		if r.Method == http.MethodGet {
+			writeRollbackStatus(w, http.StatusOK, status)
+			return
+		}
+
+		log.Printf("Rolling back %s to image: %s\n", functionName, previous.Image)
+
+		response, err := c.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, types.ServiceUpdateOptions{
+			RegistryAuthFrom: types.RegistryAuthFromPreviousSpec,
+			Rollback:         "previous",
+		})
+		if err != nil {
+			log.Printf("Error rolling back %s: %s\n", functionName, err)
+			writeDockerError(w, functionName, err)
+			return
+		}
+
+		status.Warnings = response.Warnings
+		status.Restored = &previous
+
+		history.Record(r, RevisionRollback, 0, *service.PreviousSpec)
+
+		writeRollbackStatus(w, http.StatusAccepted, status)
+	}
+}
+
+// onlyScaled returns true when the specs differ in no more than their replicas
+func onlyScaled(current, previous swarm.ServiceSpec) bool {
+	if current.Mode.Replicated != nil && previous.Mode.Replicated != nil {
+		replicated := *previous.Mode.Replicated
+		replicated.Replicas = current.Mode.Replicated.Replicas
+		previous.Mode.Replicated = &replicated
+	}
+
+	return reflect.DeepEqual(current, previous)
+}
+
+func writeRollbackStatus(w http.ResponseWriter, statusCode int, status RollbackStatus) {
+	body, err := json.Marshal(status)
+	if err != nil {
+		writeError(w, ErrorCodeInternal, status.Function, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// functionSpec reads the fields set by a deployment from a Swarm service spec
+func functionSpec(spec swarm.ServiceSpec) FunctionSpec {
+	containerSpec := spec.TaskTemplate.ContainerSpec
+	labels, annotations := buildLabelsAndAnnotations(spec.Labels)
+
+	f := FunctionSpec{
+		Labels:      labels,
+		Annotations: annotations,
+	}
+
+	if containerSpec != nil {
+		f.Image = containerSpec.Image
+		f.ReadOnlyRootFilesystem = containerSpec.ReadOnly
+
+		for _, env := range containerSpec.Env {
+			if f.EnvVars == nil {
+				f.EnvVars = map[string]string{}
+			}
+
+			parts := strings.SplitN(env, "=", 2)
+			if len(parts) == 2 {
+				f.EnvVars[parts[0]] = parts[1]
+			} else {
+				f.EnvVars[parts[0]] = ""
+			}
+		}
+
+		for _, secret := range containerSpec.Secrets {
+			if secret.File != nil {
+				f.Secrets = append(f.Secrets, path.Base(secret.File.Name))
+			} else {
+				f.Secrets = append(f.Secrets, secret.SecretName)
+			}
+		}
+		sort.Strings(f.Secrets)
+	}
+
+	if len(spec.TaskTemplate.Networks) > 0 {
+		f.Network = spec.TaskTemplate.Networks[0].Target
+	}
+
+	if spec.TaskTemplate.Placement != nil {
+		f.Constraints = spec.TaskTemplate.Placement.Constraints
+	}
+
+	if resources := spec.TaskTemplate.Resources; resources != nil {
+		f.Limits = functionResources(resources.Limits)
+		f.Requests = functionResources(resources.Reservations)
+	}
+
+	return f
+}
+
+func functionResources(resources *swarm.Resources) *typesv1.FunctionResources {
+	if resources == nil || (resources.MemoryBytes == 0 && resources.NanoCPUs == 0) {
+		return nil
+	}
+
+	f := &typesv1.FunctionResources{}
+	if resources.MemoryBytes > 0 {
+		f.Memory = fmt.Sprintf("%d", resources.MemoryBytes)
+	}
+
+	if resources.NanoCPUs > 0 {
+		f.CPU = fmt.Sprintf("%d", resources.NanoCPUs)
+	}
+
+	return f
+}
+
+// diffFunctionSpecs lists the fields which differ between two function specs
+func diffFunctionSpecs(current, previous FunctionSpec) []SpecChange {
+	changes := []SpecChange{}
+
+	add := func(field, currentValue, previousValue string) {
+		if currentValue != previousValue {
+			changes = append(changes, SpecChange{Field: field, Current: currentValue, Previous: previousValue})
+		}
+	}
+
+	add("image", current.Image, previous.Image)
+
+	diffMaps := func(field string, current, previous map[string]string) {
+		keys := sortedKeys(current)
+		for _, key := range sortedKeys(previous) {
+			if _, ok := current[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			add(field+"."+key, current[key], previous[key])
+		}
+	}
+
+	diffMaps("envVars", current.EnvVars, previous.EnvVars)
+	diffMaps("labels", current.Labels, previous.Labels)
+	diffMaps("annotations", current.Annotations, previous.Annotations)
+
+	if !reflect.DeepEqual(current.Secrets, previous.Secrets) {
+		add("secrets", strings.Join(current.Secrets, ","), strings.Join(previous.Secrets, ","))
+	}
+
+	if !reflect.DeepEqual(current.Constraints, previous.Constraints) {
+		add("constraints", strings.Join(current.Constraints, ","), strings.Join(previous.Constraints, ","))
+	}
+
+	resourceValues := func(resources *typesv1.FunctionResources) (memory string, cpu string) {
+		if resources == nil {
+			return "", ""
+		}
+
+		return resources.Memory, resources.CPU
+	}
+
+	currentMemory, currentCPU := resourceValues(current.Limits)
+	previousMemory, previousCPU := resourceValues(previous.Limits)
+	add("limits.memory", currentMemory, previousMemory)
+	add("limits.cpu", currentCPU, previousCPU)
+
+	currentMemory, currentCPU = resourceValues(current.Requests)
+	previousMemory, previousCPU = resourceValues(previous.Requests)
+	add("requests.memory", currentMemory, previousMemory)
+	add("requests.cpu", currentCPU, previousCPU)
+
+	return changes
+}
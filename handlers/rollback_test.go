@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/gorilla/mux"
+)
+
+type fakeServiceInspectUpdater struct {
+	service    swarm.Service
+	inspectErr error
+
+	updated       bool
+	updateOptions types.ServiceUpdateOptions
+}
+
+func (f *fakeServiceInspectUpdater) ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	return f.service, nil, f.inspectErr
+}
+
+func (f *fakeServiceInspectUpdater) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error) {
+	f.updated = true
+	f.updateOptions = options
+	return types.ServiceUpdateResponse{}, nil
+}
+
+func makeRollbackSpec(image string, env []string, labels map[string]string) swarm.ServiceSpec {
+	return swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: "echo", Labels: labels},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image:  image,
+				Env:    env,
+				Labels: map[string]string{"function": "true"},
+				Secrets: []*swarm.SecretReference{
+					{SecretName: "api-key", File: &swarm.SecretReferenceFileTarget{Name: "/var/openfaas/secrets/api-key"}},
+				},
+			},
+		},
+	}
+}
+
+func makeRollbackRequest(method string) *http.Request {
+	r := httptest.NewRequest(method, "/system/function/echo/rollback", nil)
+	return mux.SetURLVars(r, map[string]string{"name": "echo"})
+}
+
+func Test_RollbackHandler_Diff(t *testing.T) {
+	previous := makeRollbackSpec("functions/echo:0.1", []string{"fprocess=cat"}, map[string]string{"team": "a"})
+
+	c := &fakeServiceInspectUpdater{
+		service: swarm.Service{
+			ID:           "echo-id",
+			Spec:         makeRollbackSpec("functions/echo:0.2", []string{"fprocess=cat", "write_debug=true"}, map[string]string{"team": "b"}),
+			PreviousSpec: &previous,
+		},
+	}
+
+	w := httptest.NewRecorder()
+	RollbackHandler(c, nil).ServeHTTP(w, makeRollbackRequest(http.MethodGet))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d, body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if c.updated {
+		t.Errorf("want no update for GET")
+	}
+
+	status := RollbackStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("unable to parse response: %s", err)
+	}
+
+	want := []SpecChange{
+		{Field: "image", Current: "functions/echo:0.2", Previous: "functions/echo:0.1"},
+		{Field: "envVars.write_debug", Current: "true", Previous: ""},
+		{Field: "labels.team", Current: "b", Previous: "a"},
+	}
+
+	if !reflect.DeepEqual(status.Changes, want) {
+		t.Errorf("want changes: %+v, got: %+v", want, status.Changes)
+	}
+
+	if !reflect.DeepEqual(status.Previous.Secrets, []string{"api-key"}) {
+		t.Errorf("want previous secrets: [api-key], got: %v", status.Previous.Secrets)
+	}
+}
+
+func Test_RollbackHandler_Rollback(t *testing.T) {
+	previous := makeRollbackSpec("functions/echo:0.1", nil, nil)
+
+	c := &fakeServiceInspectUpdater{
+		service: swarm.Service{
+			ID:           "echo-id",
+			Spec:         makeRollbackSpec("functions/echo:0.2", nil, nil),
+			PreviousSpec: &previous,
+		},
+	}
+
+	w := httptest.NewRecorder()
+	RollbackHandler(c, nil).ServeHTTP(w, makeRollbackRequest(http.MethodPost))
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status: %d, got: %d, body: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	if c.updateOptions.Rollback != "previous" {
+		t.Errorf("want rollback option: previous, got: %q", c.updateOptions.Rollback)
+	}
+
+	status := RollbackStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("unable to parse response: %s", err)
+	}
+
+	if status.Restored == nil || status.Restored.Image != "functions/echo:0.1" {
+		t.Errorf("want restored image: functions/echo:0.1, got: %+v", status.Restored)
+	}
+}
+
+func Test_RollbackHandler_Errors(t *testing.T) {
+	cases := []struct {
+		name     string
+		client   *fakeServiceInspectUpdater
+		wantCode int
+	}{
+		{
+			name:     "function not found",
+			client:   &fakeServiceInspectUpdater{inspectErr: errdefs.NotFound(context.Canceled)},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name: "no previous spec",
+			client: &fakeServiceInspectUpdater{
+				service: swarm.Service{Spec: makeRollbackSpec("functions/echo:0.1", nil, nil)},
+			},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name: "only scaled",
+			client: &fakeServiceInspectUpdater{
+				service: func() swarm.Service {
+					current := makeRollbackSpec("functions/echo:0.1", nil, nil)
+					previous := makeRollbackSpec("functions/echo:0.1", nil, nil)
+					currentReplicas, previousReplicas := uint64(3), uint64(1)
+					current.Mode.Replicated = &swarm.ReplicatedService{Replicas: &currentReplicas}
+					previous.Mode.Replicated = &swarm.ReplicatedService{Replicas: &previousReplicas}
+
+					return swarm.Service{Spec: current, PreviousSpec: &previous}
+				}(),
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name: "function in another namespace",
+			client: &fakeServiceInspectUpdater{
+				service: swarm.Service{Spec: makeRollbackSpec("functions/echo:0.1", nil, map[string]string{namespaceLabel: "team-a"})},
+			},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RollbackHandler(c.client, nil).ServeHTTP(w, makeRollbackRequest(http.MethodPost))
+
+			if w.Code != c.wantCode {
+				t.Errorf("want status: %d, got: %d", c.wantCode, w.Code)
+			}
+
+			if c.client.updated {
+				t.Errorf("want no update")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultScaleFromZeroPollInterval is how often the running tasks are checked while a
+// request is held during scale from zero
+const defaultScaleFromZeroPollInterval = 250 * time.Millisecond
+
+// ZeroScaler holds requests for functions that have no available replicas, scales the
+// function to its minimum replica count and forwards the request once a task is running.
+type ZeroScaler struct {
+	tasks TaskLister
+	query ServiceQuery
+
+	// timeout is the maximum time a request is held while waiting for a running task
+	timeout      time.Duration
+	pollInterval time.Duration
+
+	// locks serialises scale up for each service, so that concurrent requests do not
+	// race to update the same service
+	locks sync.Map
+}
+
+// NewZeroScaler creates a ZeroScaler which waits up to timeout for a function to become ready
+func NewZeroScaler(tasks TaskLister, query ServiceQuery, timeout time.Duration) *ZeroScaler {
+	return &ZeroScaler{
+		tasks:        tasks,
+		query:        query,
+		timeout:      timeout,
+		pollInterval: defaultScaleFromZeroPollInterval,
+	}
+}
+
+// DecorateProxy wraps the function proxy so that functions scaled to zero are scaled up
+// before the request is forwarded.
+func (z *ZeroScaler) DecorateProxy(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if len(name) == 0 {
+			next(w, r)
+			return
+		}
+
+		service := namespacedName(splitFunctionName(name))
+
+		if err := z.ensureAvailable(r.Context(), service); err != nil {
+			log.Printf("Scale from zero: %s\n", err)
+			writeError(w, ErrorCodeTimeout, name, fmt.Errorf("function %s is not ready: %w", name, err))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// ensureAvailable returns once the service has at least one running task. Errors from the
+// Docker API are logged and the request is let through so that the proxy can report them.
+func (z *ZeroScaler) ensureAvailable(ctx context.Context, service string) error {
+	available, err := getAvailableReplicas(z.tasks, service)
+	if err != nil {
+		log.Printf("Scale from zero: %s\n", err)
+		return nil
+	}
+
+	if available > 0 {
+		return nil
+	}
+
+	if err := z.scaleUp(service); err != nil {
+		log.Printf("Scale from zero: unable to scale %s: %s\n", service, err)
+		return nil
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, z.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(z.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s waiting for a running task of %s", time.Since(start).Round(time.Millisecond), service)
+		case <-ticker.C:
+			available, err := getAvailableReplicas(z.tasks, service)
+			if err != nil {
+				log.Printf("Scale from zero: %s\n", err)
+				continue
+			}
+
+			if available > 0 {
+				log.Printf("Scale from zero: %s ready in %s\n", service, time.Since(start).Round(time.Millisecond))
+				return nil
+			}
+		}
+	}
+}
+
+// scaleUp sets the replicas of a service with zero desired replicas to its minimum
+// replica count, it is a no-op when the service already has desired replicas.
+func (z *ZeroScaler) scaleUp(service string) error {
+	lock, _ := z.locks.LoadOrStore(service, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	current, _, minReplicas, err := z.query.GetReplicas(service)
+	if err != nil {
+		return err
+	}
+
+	if current > 0 {
+		return nil
+	}
+
+	if minReplicas == 0 {
+		minReplicas = 1
+	}
+
+	log.Printf("Scale from zero: scaling %s to %d replicas\n", service, minReplicas)
+
+	return z.query.SetReplicas(service, minReplicas)
+}
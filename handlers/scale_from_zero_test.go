@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/mux"
+)
+
+// fakeTaskLister reports a running task for every desired replica of the service
+// in the fakeServiceQuery when ready is true
+type fakeTaskLister struct {
+	query *fakeServiceQuery
+	ready bool
+}
+
+func (l fakeTaskLister) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	tasks := []swarm.Task{}
+	if !l.ready {
+		return tasks, nil
+	}
+
+	service := options.Filters.Get("service")[0]
+	for i := uint64(0); i < l.query.replicas[service]; i++ {
+		tasks = append(tasks, swarm.Task{Status: swarm.TaskStatus{State: swarm.TaskStateRunning}})
+	}
+
+	return tasks, nil
+}
+
+func Test_ZeroScaler_DecorateProxy(t *testing.T) {
+	scenarios := []struct {
+		name         string
+		function     string
+		replicas     uint64
+		ready        bool
+		wantCode     int
+		wantReplicas uint64
+	}{
+		{"forwards requests for available functions", "echo", 2, true, http.StatusOK, 2},
+		{"scales from zero to min replicas and forwards", "echo", 0, true, http.StatusOK, 3},
+		{"scales functions in a namespace", "echo.team-a", 0, true, http.StatusOK, 3},
+		{"times out when no task becomes ready", "echo", 0, false, http.StatusGatewayTimeout, 3},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			service := namespacedName(splitFunctionName(s.function))
+			query := &fakeServiceQuery{replicas: map[string]uint64{service: s.replicas}, min: 3}
+
+			scaler := NewZeroScaler(fakeTaskLister{query: query, ready: s.ready}, query, 50*time.Millisecond)
+			scaler.pollInterval = time.Millisecond
+
+			forwarded := false
+			handler := scaler.DecorateProxy(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/function/"+s.function, nil)
+			r = mux.SetURLVars(r, map[string]string{"name": s.function})
+			handler(w, r)
+
+			if w.Code != s.wantCode {
+				t.Errorf("want status code: %d, got: %d", s.wantCode, w.Code)
+			}
+
+			if forwarded != (s.wantCode == http.StatusOK) {
+				t.Errorf("want forwarded: %v, got: %v", s.wantCode == http.StatusOK, forwarded)
+			}
+
+			if got := query.replicas[service]; got != s.wantReplicas {
+				t.Errorf("want replicas: %d, got: %d", s.wantReplicas, got)
+			}
+		})
+	}
+}
@@ -7,6 +7,12 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/docker/cli/opts"
 	"github.com/docker/docker/api/types/filters"
@@ -17,13 +23,67 @@ import (
 	"github.com/docker/docker/client"
 )
 
-var (
-	ownerLabel      = "com.openfaas.owner"
-	ownerLabelValue = "openfaas"
+const (
+	// secretNameLabel is the name a rotated secret is requested and mounted by, as its Swarm
+	// secret is named after its version
+	secretNameLabel = "com.openfaas.secret.name"
+	// secretVersionLabel is the version of a rotated secret, a secret without it is version 1
+	secretVersionLabel = "com.openfaas.secret.version"
 )
 
-//MakeSecretsHandler returns handler for managing secrets
-func MakeSecretsHandler(c client.SecretAPIClient) http.HandlerFunc {
+// secretNamePattern matches the names a secret can be created with, "_" is excluded as it
+// separates the namespace from the name of a Swarm secret, and "." as it separates the
+// version of a rotated secret
+var secretNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]*$`)
+
+// SecretsClient is the subset of the Docker client needed to manage secrets and to update
+// the functions which use them. This interface is satisfied by *client.Client and *Inventory
+type SecretsClient interface {
+	client.SecretAPIClient
+	ServiceLister
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error)
+}
+
+// SecretStatus is the metadata of a secret returned by the secrets list. Swarm never
+// returns the data of a secret, so there is no value.
+type SecretStatus struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	ID        string            `json:"id"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Version is incremented each time the secret is rotated
+	Version int `json:"version"`
+	// Functions are the names of the functions which mount the secret
+	Functions []string `json:"functions"`
+}
+
+// SecretInUseError is returned when a secret which functions use is deleted without force
+type SecretInUseError struct {
+	Secret    string
+	Functions []string
+}
+
+func (e *SecretInUseError) Error() string {
+	return fmt.Sprintf("secret %s is used by functions: %s, remove it from them or delete with force=true",
+		e.Secret, strings.Join(e.Functions, ", "))
+}
+
+// SecretRotation is the result of rotating a secret
+type SecretRotation struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Version is the version of the secret which was created
+	Version int `json:"version"`
+	// Functions are the functions which were updated to mount the new version
+	Functions []string `json:"functions"`
+}
+
+//MakeSecretsHandler returns handler for managing secrets, which are marked with the owner
+// label of settings
+func MakeSecretsHandler(c SecretsClient, settings ProviderSettings) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Body != nil {
 			defer r.Body.Close()
@@ -42,25 +102,32 @@ func MakeSecretsHandler(c client.SecretAPIClient) http.HandlerFunc {
 			responseErr    error
 		)
 
+		namespace := getRequestNamespace(r)
+
 		switch r.Method {
 		case http.MethodGet:
-			responseStatus, responseBody, responseErr = getSecrets(c, body)
+			responseStatus, responseBody, responseErr = getSecrets(c, settings, namespace, r.URL.Query().Get("prefix"))
 			break
 		case http.MethodPost:
-			responseStatus, responseBody, responseErr = createNewSecret(c, body)
+			responseStatus, responseBody, responseErr = createNewSecret(c, settings, body, namespace)
 			break
 		case http.MethodPut:
-			responseStatus = http.StatusMethodNotAllowed
-			responseErr = fmt.Errorf("faas-swarm is unable to update secrets, delete and re-create or use a new name")
+			responseStatus, responseBody, responseErr = rotateSecret(c, settings, body, namespace)
 			break
 		case http.MethodDelete:
-			responseStatus, responseBody, responseErr = deleteSecret(c, body)
+			force, err := isForced(r)
+			if err != nil {
+				responseStatus, responseErr = http.StatusBadRequest, err
+				break
+			}
+
+			responseStatus, responseBody, responseErr = deleteSecret(c, settings, body, namespace, force)
 			break
 		}
 
 		if responseErr != nil {
 			log.Println(responseErr)
-			w.WriteHeader(responseStatus)
+			writeError(w, errorCode(responseStatus), "", responseErr)
 			return
 		}
 
@@ -77,7 +144,7 @@ func MakeSecretsHandler(c client.SecretAPIClient) http.HandlerFunc {
 	}
 }
 
-func getSecretsWithLabel(c client.SecretAPIClient, labelName string, labelValue string) ([]swarm.Secret, error) {
+func getSecretsWithLabel(c client.SecretAPIClient, labelName string, labelValue string, namespace string) ([]swarm.Secret, error) {
 	secrets, secretListErr := c.SecretList(context.Background(), types.SecretListOptions{})
 	if secretListErr != nil {
 		return nil, secretListErr
@@ -86,7 +153,7 @@ func getSecretsWithLabel(c client.SecretAPIClient, labelName string, labelValue
 	var filteredSecrets []swarm.Secret
 
 	for _, secret := range secrets {
-		if secret.Spec.Labels[labelName] == labelValue {
+		if secret.Spec.Labels[labelName] == labelValue && namespaceFromLabels(secret.Spec.Labels) == namespace {
 			filteredSecrets = append(filteredSecrets, secret)
 		}
 	}
@@ -94,47 +161,153 @@ func getSecretsWithLabel(c client.SecretAPIClient, labelName string, labelValue
 	return filteredSecrets, nil
 }
 
-func getSecretWithName(c client.SecretAPIClient, name string) (secret *swarm.Secret, status int, err error) {
+func getSecretWithName(c client.SecretAPIClient, settings ProviderSettings, name string, namespace string) (secret *swarm.Secret, status int, err error) {
 	secrets, secretListErr := c.SecretList(context.Background(), types.SecretListOptions{})
 	if secretListErr != nil {
-		return nil, http.StatusInternalServerError, secretListErr
+		return nil, dockerErrorStatus(secretListErr), secretListErr
 	}
 
+	// a rotated secret is found at its latest version
+	var found *swarm.Secret
 	for _, secret := range secrets {
-		if secret.Spec.Name == name {
-			if secret.Spec.Labels[ownerLabel] == ownerLabelValue {
-				return &secret, http.StatusOK, nil
-			}
+		if secretName(secret, namespace) != name || namespaceFromLabels(secret.Spec.Labels) != normalizeNamespace(namespace) {
+			continue
+		}
 
+		if secret.Spec.Labels[settings.OwnerLabel] != settings.OwnerLabelValue {
 			return nil, http.StatusInternalServerError, fmt.Errorf(
 				"found secret with name: %s, but it doesn't have label: %s == %s",
 				name,
-				ownerLabel,
-				ownerLabelValue,
+				settings.OwnerLabel,
+				settings.OwnerLabelValue,
 			)
 		}
+
+		if found == nil || secretVersion(secret) > secretVersion(*found) {
+			latest := secret
+			found = &latest
+		}
+	}
+
+	if found == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("unable to found secret with name: %s", name)
+	}
+
+	return found, http.StatusOK, nil
+}
+
+// secretVersions returns every version of a managed secret, oldest first. The previous
+// version is kept after a rotation, so that functions can be rolled back, and older ones
+// are only left when a rotation could not update every function which used them.
+func secretVersions(c client.SecretAPIClient, settings ProviderSettings, name string, namespace string) ([]swarm.Secret, error) {
+	secrets, err := getSecretsWithLabel(c, settings.OwnerLabel, settings.OwnerLabelValue, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []swarm.Secret{}
+	for _, secret := range secrets {
+		if secretName(secret, namespace) == name {
+			versions = append(versions, secret)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return secretVersion(versions[i]) < secretVersion(versions[j])
+	})
+
+	return versions, nil
+}
+
+// secretName returns the name a secret is requested by, without its namespace or version
+func secretName(secret swarm.Secret, namespace string) string {
+	if name := secret.Spec.Labels[secretNameLabel]; len(name) > 0 {
+		return name
+	}
+
+	return strings.TrimPrefix(secret.Spec.Name, namespacedName("", namespace))
+}
+
+// secretVersion returns the version of a secret, starting from 1
+func secretVersion(secret swarm.Secret) int {
+	version, err := strconv.Atoi(secret.Spec.Labels[secretVersionLabel])
+	if err != nil || version < 1 {
+		return 1
+	}
+
+	return version
+}
+
+// versionedSecretName returns the Swarm name of a version of a secret, i.e. "name.v2"
+func versionedSecretName(name string, namespace string, version int) string {
+	if version <= 1 {
+		return namespacedName(name, namespace)
 	}
 
-	return nil, http.StatusNotFound, fmt.Errorf("unable to found secret with name: %s", name)
+	return fmt.Sprintf("%s.v%d", namespacedName(name, namespace), version)
 }
 
-func getSecrets(c client.SecretAPIClient, _ []byte) (responseStatus int, responseBody []byte, err error) {
-	secrets, err := getSecretsWithLabel(c, ownerLabel, ownerLabelValue)
+// getSecrets lists the metadata of the secrets in a namespace whose names start with prefix
+func getSecrets(c SecretsClient, settings ProviderSettings, namespace string, prefix string) (responseStatus int, responseBody []byte, err error) {
+	secrets, err := getSecretsWithLabel(c, settings.OwnerLabel, settings.OwnerLabelValue, namespace)
 	if err != nil {
-		return http.StatusInternalServerError, nil, fmt.Errorf(
-			"cannot get secrets with label: %s == %s in secretGetHandler: %s",
-			ownerLabel,
-			ownerLabelValue,
+		return dockerErrorStatus(err), nil, fmt.Errorf(
+			"cannot get secrets with label: %s == %s in secretGetHandler: %w",
+			settings.OwnerLabel,
+			settings.OwnerLabelValue,
 			err,
 		)
 	}
 
-	results := []typesv1.Secret{}
+	services, err := secretServices(c)
+	if err != nil {
+		return dockerErrorStatus(err), nil, fmt.Errorf("cannot list the functions using secrets: %w", err)
+	}
+
+	// each secret is listed once, at its latest version, with the functions using any version
+	latest := map[string]swarm.Secret{}
+	functions := map[string][]string{}
 
 	for _, s := range secrets {
-		results = append(results, typesv1.Secret{Name: s.Spec.Name, Value: string(s.Spec.Data)})
+		name := secretName(s, namespace)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if current, ok := latest[name]; !ok || secretVersion(s) > secretVersion(current) {
+			latest[name] = s
+		}
+
+		if _, ok := functions[name]; !ok {
+			functions[name] = []string{}
+		}
+
+		for _, service := range services[s.ID] {
+			functions[name] = append(functions[name], functionName(service.Spec))
+		}
+	}
+
+	results := []SecretStatus{}
+
+	for name, s := range latest {
+		sort.Strings(functions[name])
+
+		results = append(results, SecretStatus{
+			Name:      name,
+			Namespace: namespace,
+			ID:        s.ID,
+			CreatedAt: s.CreatedAt,
+			UpdatedAt: s.UpdatedAt,
+			Labels:    s.Spec.Labels,
+			Version:   secretVersion(s),
+			Functions: functions[name],
+		})
 	}
 
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
 	resultsJSON, marshalErr := json.Marshal(results)
 	if marshalErr != nil {
 		return http.StatusInternalServerError,
@@ -146,7 +319,7 @@ func getSecrets(c client.SecretAPIClient, _ []byte) (responseStatus int, respons
 	return http.StatusOK, resultsJSON, nil
 }
 
-func createNewSecret(c client.SecretAPIClient, body []byte) (responseStatus int, responseBody []byte, err error) {
+func createNewSecret(c client.SecretAPIClient, settings ProviderSettings, body []byte, namespace string) (responseStatus int, responseBody []byte, err error) {
 	var secret typesv1.Secret
 
 	unmarshalErr := json.Unmarshal(body, &secret)
@@ -157,18 +330,36 @@ func createNewSecret(c client.SecretAPIClient, body []byte) (responseStatus int,
 		)
 	}
 
+	if len(secret.Namespace) > 0 {
+		namespace = secret.Namespace
+	}
+
+	if !secretNamePattern.MatchString(secret.Name) {
+		validationErr := &ValidationError{}
+		validationErr.add("name", "%q must start with a letter or digit and contain only letters, digits and '-'", secret.Name)
+		return http.StatusUnprocessableEntity, nil, validationErr
+	}
+
+	// once rotated, the name is free in Swarm but is still used by the later versions
+	versions, err := secretVersions(c, settings, secret.Name, namespace)
+	if err != nil {
+		return dockerErrorStatus(err), nil, fmt.Errorf("cannot list secrets in secretPostHandler: %w", err)
+	}
+
+	if len(versions) > 0 {
+		return http.StatusConflict, nil, fmt.Errorf("secret %s already exists, use PUT to rotate it", secret.Name)
+	}
+
 	_, createSecretErr := c.SecretCreate(context.Background(), swarm.SecretSpec{
 		Annotations: swarm.Annotations{
-			Name: secret.Name,
-			Labels: map[string]string{
-				ownerLabel: ownerLabelValue,
-			},
+			Name:   namespacedName(secret.Name, namespace),
+			Labels: secretLabels(settings, namespace),
 		},
 		Data: []byte(secret.Value),
 	})
 	if createSecretErr != nil {
-		return http.StatusInternalServerError, nil, fmt.Errorf(
-			"error creating secret in secretPostHandler: %s",
+		return dockerErrorStatus(createSecretErr), nil, fmt.Errorf(
+			"error creating secret in secretPostHandler: %w",
 			createSecretErr,
 		)
 	}
@@ -176,7 +367,11 @@ func createNewSecret(c client.SecretAPIClient, body []byte) (responseStatus int,
 	return http.StatusCreated, nil, nil
 }
 
-func updateSecret(c client.SecretAPIClient, body []byte) (responseStatus int, responseBody []byte, err error) {
+// rotateSecret creates the next version of a secret, as Swarm secrets can not be changed,
+// and updates the functions which use any previous version to mount it at the same target.
+// The previous version is kept for rollbacks, older versions are removed once no function
+// spec, including the spec a function is rolled back to, refers to them.
+func rotateSecret(c SecretsClient, settings ProviderSettings, body []byte, namespace string) (responseStatus int, responseBody []byte, err error) {
 	var secret typesv1.Secret
 
 	unmarshalErr := json.Unmarshal(body, &secret)
@@ -187,38 +382,155 @@ func updateSecret(c client.SecretAPIClient, body []byte) (responseStatus int, re
 		)
 	}
 
-	foundSecret, status, getSecretErr := getSecretWithName(c, secret.Name)
-	if getSecretErr != nil {
-		return status, nil, fmt.Errorf(
-			"cannot get secret with name: %s. Error: %s",
-			secret.Name,
-			getSecretErr.Error(),
-		)
+	if len(secret.Namespace) > 0 {
+		namespace = secret.Namespace
+	}
+
+	versions, err := secretVersions(c, settings, secret.Name, namespace)
+	if err != nil {
+		return dockerErrorStatus(err), nil, fmt.Errorf("cannot list secrets in secretPutHandler: %w", err)
+	}
+
+	if len(versions) == 0 {
+		return http.StatusNotFound, nil, fmt.Errorf("unable to found secret with name: %s", secret.Name)
 	}
 
-	updateSecretErr := c.SecretUpdate(context.Background(), foundSecret.ID, foundSecret.Version, swarm.SecretSpec{
+	version := secretVersion(versions[len(versions)-1]) + 1
+	versionName := versionedSecretName(secret.Name, namespace, version)
+
+	labels := secretLabels(settings, namespace)
+	labels[secretNameLabel] = secret.Name
+	labels[secretVersionLabel] = strconv.Itoa(version)
+
+	created, err := c.SecretCreate(context.Background(), swarm.SecretSpec{
 		Annotations: swarm.Annotations{
-			Name: secret.Name,
-			Labels: map[string]string{
-				ownerLabel: ownerLabelValue,
-			},
+			Name:   versionName,
+			Labels: labels,
 		},
 		Data: []byte(secret.Value),
 	})
+	if err != nil {
+		return dockerErrorStatus(err), nil, fmt.Errorf("error creating version %d of secret %s: %w", version, secret.Name, err)
+	}
+
+	log.Printf("Created version %d of secret %s\n", version, secret.Name)
+
+	services, err := secretServices(c)
+	if err != nil {
+		return dockerErrorStatus(err), nil, fmt.Errorf("cannot list the functions using secret %s: %w", secret.Name, err)
+	}
+
+	previous := map[string]bool{}
+	for _, v := range versions {
+		previous[v.ID] = true
+	}
+
+	rotation := SecretRotation{
+		Name:      secret.Name,
+		Namespace: namespace,
+		Version:   version,
+		Functions: []string{},
+	}
+
+	updated := map[string]bool{}
+	failed := []string{}
+	var updateErr error
+
+	for _, v := range versions {
+		for _, service := range services[v.ID] {
+			if updated[service.ID] {
+				continue
+			}
+			updated[service.ID] = true
+
+			name := functionName(service.Spec)
+			err := updateServiceSecrets(c, service.ID, func(refs []*swarm.SecretReference) []*swarm.SecretReference {
+				for _, ref := range refs {
+					if previous[ref.SecretID] {
+						ref.SecretID = created.ID
+						ref.SecretName = versionName
+					}
+				}
+
+				return refs
+			})
+			if err != nil {
+				log.Printf("Error updating %s to version %d of secret %s: %s\n", name, version, secret.Name, err)
+				failed = append(failed, name)
+				updateErr = err
+				continue
+			}
+
+			rotation.Functions = append(rotation.Functions, name)
+		}
+	}
 
-	if updateSecretErr != nil {
-		return http.StatusInternalServerError, nil, fmt.Errorf(
-			"couldn't update secret (name: %s, ID: %s) because of error: %s",
+	if updateErr != nil {
+		sort.Strings(failed)
+		return dockerErrorStatus(updateErr), nil, fmt.Errorf(
+			"created version %d of secret %s, but %s still use the previous version, retry to update them: %w",
+			version,
 			secret.Name,
-			foundSecret.ID,
-			updateSecretErr.Error(),
+			strings.Join(failed, ", "),
+			updateErr,
 		)
 	}
 
-	return http.StatusOK, nil, nil
+	referenced, err := referencedSecrets(c)
+	if err != nil {
+		log.Printf("Error listing the functions using secret %s, previous versions are kept: %s\n", secret.Name, err)
+	}
+
+	// the latest previous version is mounted by the spec the updated functions roll back to
+	for _, v := range versions[:len(versions)-1] {
+		if referenced == nil || referenced[v.ID] {
+			continue
+		}
+
+		if err := c.SecretRemove(context.Background(), v.ID); err != nil {
+			log.Printf("Error removing version %d of secret %s: %s\n", secretVersion(v), secret.Name, err)
+		}
+	}
+
+	sort.Strings(rotation.Functions)
+
+	res, err := json.Marshal(rotation)
+	if err != nil {
+		return http.StatusInternalServerError, nil, fmt.Errorf("error marshalling secret rotation to json: %s", err)
+	}
+
+	return http.StatusOK, res, nil
+}
+
+// updateServiceSecrets changes the secrets a service mounts with update, which rolls its tasks
+func updateServiceSecrets(c SecretsClient, serviceID string, update func([]*swarm.SecretReference) []*swarm.SecretReference) error {
+	service, _, err := c.ServiceInspectWithRaw(context.Background(), serviceID, types.ServiceInspectOptions{})
+	if err != nil {
+		return err
+	}
+
+	containerSpec := service.Spec.TaskTemplate.ContainerSpec
+	containerSpec.Secrets = update(containerSpec.Secrets)
+
+	updateOpts := types.ServiceUpdateOptions{}
+	updateOpts.RegistryAuthFrom = types.RegistryAuthFromSpec
+
+	response, err := c.ServiceUpdate(context.Background(), service.ID, service.Version, service.Spec, updateOpts)
+	if err != nil {
+		return err
+	}
+
+	if response.Warnings != nil {
+		log.Println(response.Warnings)
+	}
+
+	return nil
 }
 
-func deleteSecret(c client.SecretAPIClient, body []byte) (responseStatus int, responseBody []byte, err error) {
+// deleteSecret removes every version of a secret. When functions use the secret a
+// *SecretInUseError is returned, unless force is set, then the secret is first removed
+// from those functions.
+func deleteSecret(c SecretsClient, settings ProviderSettings, body []byte, namespace string, force bool) (responseStatus int, responseBody []byte, err error) {
 	var secret typesv1.Secret
 
 	unmarshalErr := json.Unmarshal(body, &secret)
@@ -229,38 +541,183 @@ func deleteSecret(c client.SecretAPIClient, body []byte) (responseStatus int, re
 		)
 	}
 
-	foundSecret, status, getSecretErr := getSecretWithName(c, secret.Name)
+	if len(secret.Namespace) > 0 {
+		namespace = secret.Namespace
+	}
+
+	_, status, getSecretErr := getSecretWithName(c, settings, secret.Name, namespace)
 	if getSecretErr != nil {
 		return status, nil, fmt.Errorf(
-			"cannot get secret with name: %s, which you want to remove. Error: %s",
+			"cannot get secret with name: %s, which you want to remove. Error: %w",
 			secret.Name,
 			getSecretErr,
 		)
 	}
 
-	removeSecretErr := c.SecretRemove(context.Background(), foundSecret.ID)
-	if removeSecretErr != nil {
-		return http.StatusInternalServerError, nil, fmt.Errorf(
-			"error trying to remove secret (name: `%s`, ID: `%s`): %s",
-			secret.Name,
-			foundSecret.ID,
-			removeSecretErr,
-		)
+	versions, err := secretVersions(c, settings, secret.Name, namespace)
+	if err != nil {
+		return dockerErrorStatus(err), nil, fmt.Errorf("cannot list secrets in secretDeleteHandler: %w", err)
+	}
+
+	services, err := secretServices(c)
+	if err != nil {
+		return dockerErrorStatus(err), nil, fmt.Errorf("cannot list the functions using secret %s: %w", secret.Name, err)
+	}
+
+	ids := map[string]bool{}
+	for _, v := range versions {
+		ids[v.ID] = true
+	}
+
+	users := map[string]swarm.Service{}
+	for _, v := range versions {
+		for _, service := range services[v.ID] {
+			users[service.ID] = service
+		}
+	}
+
+	if len(users) > 0 && !force {
+		inUse := &SecretInUseError{Secret: secret.Name}
+		for _, service := range users {
+			inUse.Functions = append(inUse.Functions, functionName(service.Spec))
+		}
+		sort.Strings(inUse.Functions)
+
+		return http.StatusConflict, nil, inUse
+	}
+
+	for _, service := range users {
+		err := updateServiceSecrets(c, service.ID, func(refs []*swarm.SecretReference) []*swarm.SecretReference {
+			kept := []*swarm.SecretReference{}
+			for _, ref := range refs {
+				if !ids[ref.SecretID] {
+					kept = append(kept, ref)
+				}
+			}
+
+			return kept
+		})
+		if err != nil {
+			return dockerErrorStatus(err), nil, fmt.Errorf(
+				"error removing secret %s from function %s: %w",
+				secret.Name,
+				functionName(service.Spec),
+				err,
+			)
+		}
+
+		log.Printf("Removed secret %s from function %s\n", secret.Name, functionName(service.Spec))
+	}
+
+	for _, v := range versions {
+		removeSecretErr := c.SecretRemove(context.Background(), v.ID)
+		if removeSecretErr != nil {
+			return dockerErrorStatus(removeSecretErr), nil, fmt.Errorf(
+				"error trying to remove secret (name: `%s`, ID: `%s`): %w",
+				secret.Name,
+				v.ID,
+				removeSecretErr,
+			)
+		}
 	}
 
 	return http.StatusOK, nil, nil
 }
 
-func makeSecretsArray(c *client.Client, secretNames []string) ([]*swarm.SecretReference, error) {
+// isForced returns true when the force query parameter is set
+func isForced(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("force")
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for force: %q", value)
+	}
+
+	return force, nil
+}
+
+// secretServices returns the function services which mount each secret, by secret ID
+func secretServices(c ServiceLister) (map[string][]swarm.Service, error) {
+	services, err := c.ServiceList(context.Background(), types.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	bySecret := map[string][]swarm.Service{}
+	for _, service := range services {
+		if !isFunctionService(service) {
+			continue
+		}
+
+		for _, secret := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+			bySecret[secret.SecretID] = append(bySecret[secret.SecretID], service)
+		}
+	}
+
+	return bySecret, nil
+}
+
+// referencedSecrets returns the IDs of the secrets which function services mount, or which
+// they mount once rolled back to their previous spec
+func referencedSecrets(c ServiceLister) (map[string]bool, error) {
+	services, err := c.ServiceList(context.Background(), types.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, service := range services {
+		if !isFunctionService(service) {
+			continue
+		}
+
+		specs := []*swarm.ServiceSpec{&service.Spec, service.PreviousSpec}
+		for _, spec := range specs {
+			if spec == nil || spec.TaskTemplate.ContainerSpec == nil {
+				continue
+			}
+
+			for _, secret := range spec.TaskTemplate.ContainerSpec.Secrets {
+				referenced[secret.SecretID] = true
+			}
+		}
+	}
+
+	return referenced, nil
+}
+
+// dockerErrorStatus returns the HTTP status for an error returned by the Docker API
+func dockerErrorStatus(err error) int {
+	return errorStatus[dockerErrorCode(err, ErrorCodeInternal)]
+}
+
+// secretLabels returns the labels applied to secrets managed by faas-swarm
+func secretLabels(settings ProviderSettings, namespace string) map[string]string {
+	labels := settings.ownerLabels()
+
+	if !isDefaultNamespace(namespace) {
+		labels[namespaceLabel] = namespace
+	}
+
+	return labels
+}
+
+// makeSecretsArray returns the references which mount the secrets into secretsPath
+func makeSecretsArray(c *client.Client, secretNames []string, namespace string, secretsPath string) ([]*swarm.SecretReference, error) {
 	values := []*swarm.SecretReference{}
 
 	if len(secretNames) == 0 {
 		return values, nil
 	}
 
+	// secrets are mounted using the name the user asked for, but are sourced from
+	// the Swarm secret of the function's namespace
 	secretOpts := new(opts.SecretOpt)
 	for _, secret := range secretNames {
-		secretSpec := fmt.Sprintf("source=%s,target=/var/openfaas/secrets/%s", secret, secret)
+		secretSpec := fmt.Sprintf("source=%s,target=%s", namespacedName(secret, namespace), path.Join(secretsPath, secret))
 		if err := secretOpts.Set(secretSpec); err != nil {
 			return nil, err
 		}
@@ -283,11 +740,24 @@ func makeSecretsArray(c *client.Client, secretNames []string) ([]*swarm.SecretRe
 		return nil, err
 	}
 
-	// create map of matching secrets for easy lookup
-	foundSecrets := make(map[string]string)
+	// create map of matching secrets for easy lookup, a rotated secret is found by the
+	// name it was requested by, at its latest version. Secrets of other namespaces are
+	// never mounted, whatever their Swarm name.
+	foundSecrets := make(map[string]swarm.Secret)
 	foundSecretNames := []string{}
 	for _, secret := range secrets {
-		foundSecrets[secret.Spec.Annotations.Name] = secret.ID
+		if namespaceFromLabels(secret.Spec.Labels) != normalizeNamespace(namespace) {
+			continue
+		}
+
+		name := secret.Spec.Annotations.Name
+		if label := secret.Spec.Labels[secretNameLabel]; len(label) > 0 {
+			name = namespacedName(label, namespace)
+		}
+
+		if found, ok := foundSecrets[name]; !ok || secretVersion(secret) > secretVersion(found) {
+			foundSecrets[name] = secret
+		}
 		foundSecretNames = append(foundSecretNames, secret.Spec.Annotations.Name)
 	}
 
@@ -300,14 +770,15 @@ func makeSecretsArray(c *client.Client, secretNames []string) ([]*swarm.SecretRe
 			return nil, fmt.Errorf("duplicate secret target for %s not allowed", secretName)
 		}
 
-		id, ok := foundSecrets[secretName]
+		found, ok := foundSecrets[secretName]
 		if !ok {
 			return nil, fmt.Errorf("secret not found: %s; possible choices:\n%v", secretName, foundSecretNames)
 		}
 
 		options := new(swarm.SecretReference)
 		*options = *opts
-		options.SecretID = id
+		options.SecretID = found.ID
+		options.SecretName = found.Spec.Name
 
 		requestedSecrets[secretName] = true
 		values = append(values, options)
@@ -7,14 +7,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/swarm"
-	typesv1 "github.com/openfaas/faas-provider/types"
 )
 
+var testSettings = DefaultProviderSettings()
+
 func genFakeSecret(name string, data string, includeOwnerLabel bool) swarm.Secret {
 	secret := swarm.Secret{
 		ID: name,
@@ -28,7 +32,7 @@ func genFakeSecret(name string, data string, includeOwnerLabel bool) swarm.Secre
 
 	if includeOwnerLabel {
 		secret.Spec.Annotations.Labels = map[string]string{
-			ownerLabel: ownerLabelValue,
+			testSettings.OwnerLabel: testSettings.OwnerLabelValue,
 		}
 	}
 
@@ -51,7 +55,8 @@ func getInitialSecrets(includeNonOwnedSecrets bool) map[string]swarm.Secret {
 }
 
 type fakeDockerSecretAPIClient struct {
-	secrets map[string]swarm.Secret
+	secrets  map[string]swarm.Secret
+	services []swarm.Service
 }
 
 func newFakeDockerSecretAPIClient() fakeDockerSecretAPIClient {
@@ -62,6 +67,70 @@ func newFakeDockerSecretAPIClient() fakeDockerSecretAPIClient {
 
 func (c *fakeDockerSecretAPIClient) Reset() {
 	c.secrets = getInitialSecrets(true)
+	c.services = nil
+}
+
+func (c *fakeDockerSecretAPIClient) ServiceList(_ context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	return c.services, nil
+}
+
+func (c *fakeDockerSecretAPIClient) ServiceInspectWithRaw(_ context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	for _, service := range c.services {
+		if service.ID == serviceID {
+			// copied, so that changes are only seen once the service is updated
+			copied := service
+			spec := *service.Spec.TaskTemplate.ContainerSpec
+			spec.Secrets = nil
+			for _, secret := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+				ref := *secret
+				spec.Secrets = append(spec.Secrets, &ref)
+			}
+			copied.Spec.TaskTemplate.ContainerSpec = &spec
+
+			return copied, nil, nil
+		}
+	}
+
+	return swarm.Service{}, nil, fmt.Errorf("service %s not found", serviceID)
+}
+
+func (c *fakeDockerSecretAPIClient) ServiceUpdate(_ context.Context, serviceID string, version swarm.Version, spec swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error) {
+	for i, service := range c.services {
+		if service.ID == serviceID {
+			previous := c.services[i].Spec
+			c.services[i].PreviousSpec = &previous
+			c.services[i].Spec = spec
+			return types.ServiceUpdateResponse{}, nil
+		}
+	}
+
+	return types.ServiceUpdateResponse{}, fmt.Errorf("service %s not found", serviceID)
+}
+
+// genFakeSecretService returns a function service which mounts the secrets
+func genFakeSecretService(name string, secrets ...string) swarm.Service {
+	service := swarm.Service{
+		ID: name,
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: name},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{
+					Labels: map[string]string{"function": "true"},
+				},
+			},
+		},
+	}
+
+	for _, secret := range secrets {
+		service.Spec.TaskTemplate.ContainerSpec.Secrets = append(service.Spec.TaskTemplate.ContainerSpec.Secrets,
+			&swarm.SecretReference{
+				SecretID:   secret,
+				SecretName: secret,
+				File:       &swarm.SecretReferenceFileTarget{Name: path.Join(testSettings.SecretsPath, secret)},
+			})
+	}
+
+	return service
 }
 
 func (c *fakeDockerSecretAPIClient) SecretList(
@@ -87,10 +156,8 @@ func (c *fakeDockerSecretAPIClient) SecretCreate(
 		ID: id,
 		Spec: swarm.SecretSpec{
 			Annotations: swarm.Annotations{
-				Name: secretDesc.Name,
-				Labels: map[string]string{
-					ownerLabel: ownerLabelValue,
-				},
+				Name:   secretDesc.Name,
+				Labels: secretDesc.Labels,
 			},
 			Data: secretDesc.Data,
 		},
@@ -129,7 +196,7 @@ func (c *fakeDockerSecretAPIClient) SecretUpdate(
 
 func Test_SecretsHandler(t *testing.T) {
 	dockerClient := newFakeDockerSecretAPIClient()
-	secretsHandler := MakeSecretsHandler(&dockerClient)
+	secretsHandler := MakeSecretsHandler(&dockerClient, testSettings)
 
 	secretName := "testsecret"
 
@@ -158,7 +225,35 @@ func Test_SecretsHandler(t *testing.T) {
 		}
 	})
 
-	t.Run("update managed secrets", func(t *testing.T) {
+	t.Run("create secret with invalid name", func(t *testing.T) {
+		defer dockerClient.Reset()
+
+		for _, name := range []string{"team-a_db", "db.v2", "-db"} {
+			payload := fmt.Sprintf(`{"name": "%s", "value": "value"}`, name)
+			req := httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader(payload))
+			w := httptest.NewRecorder()
+
+			secretsHandler(w, req)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("expected status code '%d' for %s, got '%d'", http.StatusUnprocessableEntity, name, w.Code)
+			}
+
+			if _, exists := dockerClient.secrets[name]; exists {
+				t.Errorf("expected secret %s not to be created", name)
+			}
+		}
+	})
+
+	t.Run("rotate managed secrets", func(t *testing.T) {
+		defer dockerClient.Reset()
+
+		dockerClient.services = []swarm.Service{
+			genFakeSecretService("shop", "foo", "foobar"),
+			genFakeSecretService("billing", "foo"),
+			genFakeSecretService("other", "foobar"),
+		}
+
 		newSecretValue := "newtestsecretvalue"
 		payload := fmt.Sprintf(`{"name": "%s", "value": "%s"}`, "foo", newSecretValue)
 		req := httptest.NewRequest("PUT", "http://example.com/foo", strings.NewReader(payload))
@@ -166,9 +261,96 @@ func Test_SecretsHandler(t *testing.T) {
 
 		secretsHandler(w, req)
 
-		resp := w.Result()
-		if resp.StatusCode != http.StatusMethodNotAllowed {
-			t.Errorf("expected status code '%d', got '%d'", http.StatusMethodNotAllowed, resp.StatusCode)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code '%d', got '%d': %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		rotation := SecretRotation{}
+		if err := json.NewDecoder(w.Body).Decode(&rotation); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []string{"billing", "shop"}; rotation.Version != 2 || !reflect.DeepEqual(rotation.Functions, want) {
+			t.Errorf("expected version 2 used by %v, got: %+v", want, rotation)
+		}
+
+		if _, exists := dockerClient.secrets["foo"]; !exists {
+			t.Errorf("expected the previous version of foo to be kept for rollbacks")
+		}
+
+		rotated, exists := dockerClient.secrets["foo.v2"]
+		if !exists {
+			t.Fatalf("expected secret foo.v2 to be created")
+		}
+
+		if string(rotated.Spec.Data) != newSecretValue || rotated.Spec.Labels[secretNameLabel] != "foo" {
+			t.Errorf("expected foo.v2 to hold the new value and be named foo, got: %+v", rotated.Spec)
+		}
+
+		for _, service := range dockerClient.services {
+			for _, ref := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+				if ref.SecretID == "foo" {
+					t.Errorf("expected %s to be updated to foo.v2", service.ID)
+				}
+
+				if ref.SecretID == rotated.ID && (ref.SecretName != "foo.v2" || ref.File.Name != path.Join(testSettings.SecretsPath, "foo")) {
+					t.Errorf("expected %s to mount foo.v2 at the same target, got: %+v %+v", service.ID, ref, ref.File)
+				}
+			}
+		}
+
+		req = httptest.NewRequest("GET", "http://example.com/foo?prefix=foo", nil)
+		w = httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		secretList := []SecretStatus{}
+		if err := json.NewDecoder(w.Body).Decode(&secretList); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(secretList) != 2 || secretList[0].Name != "foo" || secretList[0].Version != 2 || secretList[0].ID != rotated.ID {
+			t.Errorf("expected foo to be listed once at version 2, got: %+v", secretList)
+		}
+
+		payload = fmt.Sprintf(`{"name": "%s", "value": "%s"}`, "foo", "value")
+		req = httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader(payload))
+		w = httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected creating rotated secret foo to return '%d', got '%d'", http.StatusConflict, w.Code)
+		}
+
+		payload = fmt.Sprintf(`{"name": "%s", "value": "%s"}`, "foo", "third")
+		req = httptest.NewRequest("PUT", "http://example.com/foo", strings.NewReader(payload))
+		w = httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code '%d', got '%d': %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		if _, exists := dockerClient.secrets["foo"]; exists {
+			t.Errorf("expected version 1 of foo to be removed once no spec refers to it")
+		}
+
+		if _, exists := dockerClient.secrets["foo.v2"]; !exists {
+			t.Errorf("expected the previous version foo.v2 to be kept for rollbacks")
+		}
+	})
+
+	t.Run("rotate missing secret", func(t *testing.T) {
+		payload := `{"name": "missing", "value": "value"}`
+		req := httptest.NewRequest("PUT", "http://example.com/foo", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status code '%d', got '%d'", http.StatusNotFound, w.Code)
 		}
 	})
 
@@ -185,32 +367,116 @@ func Test_SecretsHandler(t *testing.T) {
 
 		decoder := json.NewDecoder(resp.Body)
 
-		secretList := []typesv1.Secret{}
+		secretList := []SecretStatus{}
 		err := decoder.Decode(&secretList)
 		if err != nil {
 			t.Error(err)
 		}
 
+		if len(secretList) != len(want) {
+			t.Errorf("expected %d secrets, got: %v", len(want), secretList)
+		}
+
 		for key, secret := range want {
 			var exists bool
-			var data string
-
-			for _, secret := range secretList {
-				if secret.Name == key {
-					exists = true
-					data = string(secret.Value)
 
+			for _, listed := range secretList {
+				if listed.Name == key {
+					exists = listed.ID == secret.ID
 					break
 				}
 			}
 
 			if !exists {
-				t.Errorf("expected secret: `%s` to be listed", key)
+				t.Errorf("expected secret: `%s` to be listed with ID: `%s`", key, secret.ID)
 			}
+		}
+	})
 
-			if string(secret.Spec.Data) != data {
-				t.Errorf("expected secret: `%s` to have value: `%s`, got: `%s`", key, string(secret.Spec.Data), data)
-			}
+	t.Run("list secrets with the functions using them", func(t *testing.T) {
+		defer dockerClient.Reset()
+
+		created := time.Date(2020, 12, 15, 10, 0, 0, 0, time.UTC)
+		secret := dockerClient.secrets["foobar"]
+		secret.CreatedAt = created
+		secret.UpdatedAt = created
+		dockerClient.secrets["foobar"] = secret
+
+		dockerClient.services = []swarm.Service{
+			genFakeSecretService("shop", "foobar", "foo"),
+			genFakeSecretService("billing", "foobar"),
+			genFakeSecretService("other"),
+		}
+
+		req := httptest.NewRequest("GET", "http://example.com/foo?prefix=foo", nil)
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code '%d', got '%d'", http.StatusOK, w.Code)
+		}
+
+		if strings.Contains(w.Body.String(), `"value"`) {
+			t.Errorf("expected no secret values, got: %s", w.Body.String())
+		}
+
+		secretList := []SecretStatus{}
+		if err := json.NewDecoder(w.Body).Decode(&secretList); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(secretList) != 2 || secretList[0].Name != "foo" || secretList[1].Name != "foobar" {
+			t.Fatalf("expected secrets foo and foobar, got: %v", secretList)
+		}
+
+		if want := []string{"shop"}; !reflect.DeepEqual(secretList[0].Functions, want) {
+			t.Errorf("expected foo to be used by %v, got: %v", want, secretList[0].Functions)
+		}
+
+		foobar := secretList[1]
+		if want := []string{"billing", "shop"}; !reflect.DeepEqual(foobar.Functions, want) {
+			t.Errorf("expected foobar to be used by %v, got: %v", want, foobar.Functions)
+		}
+
+		if !foobar.CreatedAt.Equal(created) || !foobar.UpdatedAt.Equal(created) {
+			t.Errorf("expected foobar to be created and updated at %s, got: %s and %s", created, foobar.CreatedAt, foobar.UpdatedAt)
+		}
+
+		if foobar.Labels[testSettings.OwnerLabel] != testSettings.OwnerLabelValue {
+			t.Errorf("expected foobar to have label %s=%s, got: %v", testSettings.OwnerLabel, testSettings.OwnerLabelValue, foobar.Labels)
+		}
+	})
+
+	t.Run("create and list secrets in a namespace", func(t *testing.T) {
+		defer dockerClient.Reset()
+
+		payload := fmt.Sprintf(`{"name": "%s", "value": "%s", "namespace": "team-a"}`, secretName, "value")
+		req := httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code '%d', got '%d'", http.StatusCreated, w.Code)
+		}
+
+		if _, secretExist := dockerClient.secrets["team-a_"+secretName]; !secretExist {
+			t.Fatalf("secret `%s` was not created in namespace team-a", secretName)
+		}
+
+		req = httptest.NewRequest("GET", "http://example.com/foo?namespace=team-a", nil)
+		w = httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		secretList := []SecretStatus{}
+		if err := json.NewDecoder(w.Body).Decode(&secretList); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(secretList) != 1 || secretList[0].Name != secretName || secretList[0].Namespace != "team-a" {
+			t.Errorf("expected only secret `%s` in namespace team-a, got: %v", secretName, secretList)
 		}
 	})
 
@@ -233,4 +499,79 @@ func Test_SecretsHandler(t *testing.T) {
 			t.Errorf("expected secret with name: `%s` to be removed", secretName)
 		}
 	})
+	t.Run("delete secret used by functions returns conflict", func(t *testing.T) {
+		defer dockerClient.Reset()
+
+		dockerClient.services = []swarm.Service{
+			genFakeSecretService("shop", "foobar", "foo"),
+			genFakeSecretService("billing", "foobar"),
+		}
+
+		req := httptest.NewRequest("DELETE", "http://example.com/foo", strings.NewReader(`{"name": "foobar"}`))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Fatalf("expected status code '%d', got '%d'", http.StatusConflict, w.Code)
+		}
+
+		res := ErrorResponse{}
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []string{"billing", "shop"}; res.Code != ErrorCodeConflict || !reflect.DeepEqual(res.Functions, want) {
+			t.Errorf("expected conflict listing functions %v, got: %+v", want, res)
+		}
+
+		if _, secretExist := dockerClient.secrets["foobar"]; !secretExist {
+			t.Errorf("expected secret foobar not to be removed")
+		}
+	})
+
+	t.Run("force delete secret used by functions", func(t *testing.T) {
+		defer dockerClient.Reset()
+
+		dockerClient.services = []swarm.Service{
+			genFakeSecretService("shop", "foobar", "foo"),
+			genFakeSecretService("billing", "foobar"),
+		}
+
+		req := httptest.NewRequest("DELETE", "http://example.com/foo?force=true", strings.NewReader(`{"name": "foobar"}`))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code '%d', got '%d': %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		if _, secretExist := dockerClient.secrets["foobar"]; secretExist {
+			t.Errorf("expected secret foobar to be removed")
+		}
+
+		for _, service := range dockerClient.services {
+			for _, ref := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+				if ref.SecretID == "foobar" {
+					t.Errorf("expected foobar to be removed from %s", service.ID)
+				}
+			}
+		}
+
+		if refs := dockerClient.services[0].Spec.TaskTemplate.ContainerSpec.Secrets; len(refs) != 1 || refs[0].SecretID != "foo" {
+			t.Errorf("expected shop to keep secret foo, got: %v", refs)
+		}
+	})
+
+	t.Run("delete with invalid force", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "http://example.com/foo?force=maybe", strings.NewReader(`{"name": "foobar"}`))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code '%d', got '%d'", http.StatusBadRequest, w.Code)
+		}
+	})
 }
@@ -0,0 +1,35 @@
+package handlers
+
+// ProviderSettings are the provider wide defaults applied when functions are deployed,
+// looked up and scaled
+type ProviderSettings struct {
+	// NetworkLabel marks the overlay network of the default namespace, i.e. openfaas=true
+	NetworkLabel string
+	// Constraints are the placement constraints of functions which do not set any
+	Constraints []string
+	// SecretsPath is the directory secrets are mounted into inside function containers
+	SecretsPath string
+	// OwnerLabel and OwnerLabelValue mark the secrets and configs managed by the provider
+	OwnerLabel      string
+	OwnerLabelValue string
+	// MaxReplicas is the maximum replicas of functions which do not set MaxScaleLabel
+	MaxReplicas int
+}
+
+// DefaultProviderSettings returns the settings used when the provider configuration does
+// not change them
+func DefaultProviderSettings() ProviderSettings {
+	return ProviderSettings{
+		NetworkLabel:    "openfaas=true",
+		Constraints:     []string{"node.platform.os == linux"},
+		SecretsPath:     "/var/openfaas/secrets/",
+		OwnerLabel:      "com.openfaas.owner",
+		OwnerLabelValue: "openfaas",
+		MaxReplicas:     DefaultMaxReplicas,
+	}
+}
+
+// ownerLabels returns the label which marks a secret or config as managed by the provider
+func (s ProviderSettings) ownerLabels() map[string]string {
+	return map[string]string{s.OwnerLabel: s.OwnerLabelValue}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultWaitTimeout is how long deploy and update requests with ?wait=true block for
+	// when no timeout is given
+	defaultWaitTimeout = time.Minute
+	// waitPollInterval is how often the status of a service is read while waiting
+	waitPollInterval = time.Second
+	// maxTaskStatuses is the number of tasks reported in a DeploymentStatus
+	maxTaskStatuses = 10
+)
+
+// Deployment states reported in a DeploymentStatus
+const (
+	// DeploymentConverged means the desired number of up to date tasks are running
+	DeploymentConverged = "converged"
+	// DeploymentProgressing means tasks are still being started or updated
+	DeploymentProgressing = "progressing"
+	// DeploymentRollingBack means Swarm is rolling back a failed update
+	DeploymentRollingBack = "rolling_back"
+	// DeploymentRolledBack means a failed update was rolled back
+	DeploymentRolledBack = "rolled_back"
+	// DeploymentFailed means an update or rollback was paused after tasks failed
+	DeploymentFailed = "failed"
+)
+
+// ServiceStatusReader is the subset of the Docker client.ServiceAPIClient needed to read
+// the status of a service. This interface is satisfied by *client.Client
+type ServiceStatusReader interface {
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error)
+	TaskLister
+}
+
+// DeploymentStatus reports whether a function has converged on its current spec
+type DeploymentStatus struct {
+	Function  string `json:"function"`
+	Namespace string `json:"namespace"`
+	// State is one of converged, progressing, rolling_back, rolled_back or failed
+	State string `json:"state"`
+	// Message explains why the function has not converged, when it is known
+	Message         string        `json:"message,omitempty"`
+	UpdateStatus    *UpdateStatus `json:"updateStatus,omitempty"`
+	DesiredReplicas uint64        `json:"desiredReplicas"`
+	RunningReplicas uint64        `json:"runningReplicas"`
+	// Tasks are the most recent tasks of the function, newest first
+	Tasks []TaskStatus `json:"tasks"`
+}
+
+// UpdateStatus is the status of the last update of a Swarm service
+type UpdateStatus struct {
+	State       string     `json:"state"`
+	Message     string     `json:"message,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// TaskStatus is the status of a task of a function
+type TaskStatus struct {
+	ID           string `json:"id"`
+	NodeID       string `json:"nodeId,omitempty"`
+	Slot         int    `json:"slot,omitempty"`
+	State        string `json:"state"`
+	DesiredState string `json:"desiredState"`
+	Message      string `json:"message,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// ExitCode is the exit code of the task's container once it has stopped
+	ExitCode  *int      `json:"exitCode,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DeploymentError is returned when a function fails to converge, or does not converge in
+// time, with the status it was last seen in
+type DeploymentError struct {
+	Code   string
+	Status DeploymentStatus
+}
+
+func (e *DeploymentError) Error() string {
+	if e.Code == ErrorCodeTimeout {
+		return fmt.Sprintf("function %s did not converge in time, %d of %d replicas running",
+			e.Status.Function, e.Status.RunningReplicas, e.Status.DesiredReplicas)
+	}
+
+	return fmt.Sprintf("function %s %s: %s", e.Status.Function, e.Status.State, e.Status.Message)
+}
+
+// StatusHandler reports the deployment status of a function
+func StatusHandler(c ServiceStatusReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName := mux.Vars(r)["name"]
+		namespace := getRequestNamespace(r)
+
+		status, err := readDeploymentStatus(r.Context(), c, functionName, namespace)
+		if err != nil {
+			log.Printf("Error reading status of %s: %s\n", functionName, err)
+			writeDockerError(w, functionName, err)
+			return
+		}
+
+		writeDeploymentStatus(w, status)
+	}
+}
+
+func writeDeploymentStatus(w http.ResponseWriter, status DeploymentStatus) {
+	body, err := json.Marshal(status)
+	if err != nil {
+		writeError(w, ErrorCodeInternal, status.Function, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// waitOptions returns whether the request has ?wait=true and how long to wait for, from
+// ?timeout= or defaultWaitTimeout
+func waitOptions(r *http.Request) (bool, time.Duration, error) {
+	query := r.URL.Query()
+
+	wait := false
+	if value := query.Get("wait"); len(value) > 0 {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid value for wait: %q", value)
+		}
+		wait = parsed
+	}
+
+	timeout := defaultWaitTimeout
+	if value := query.Get("timeout"); len(value) > 0 {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return false, 0, fmt.Errorf("invalid value for timeout: %q, use a duration, i.e. 30s", value)
+		}
+		timeout = parsed
+	}
+
+	return wait, timeout, nil
+}
+
+// writeWaitResult waits for a function to converge, then writes its status. A function
+// which fails or does not converge in time is written as an error with its status.
+func writeWaitResult(w http.ResponseWriter, r *http.Request, c ServiceStatusReader, function string, namespace string, timeout time.Duration) {
+	status, err := waitForDeployment(r.Context(), c, function, namespace, timeout, waitPollInterval)
+	if err != nil {
+		log.Printf("Error waiting for %s: %s\n", function, err)
+
+		code := dockerErrorCode(err, ErrorCodeInternal)
+
+		var deploymentErr *DeploymentError
+		if errors.As(err, &deploymentErr) {
+			code = deploymentErr.Code
+		}
+
+		writeError(w, code, function, err)
+		return
+	}
+
+	writeDeploymentStatus(w, status)
+}
+
+// waitForDeployment polls the status of a function until it converges, fails, or the
+// timeout passes. A failure or timeout is returned as a *DeploymentError.
+func waitForDeployment(ctx context.Context, c ServiceStatusReader, function string, namespace string, timeout time.Duration, interval time.Duration) (DeploymentStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	status := DeploymentStatus{Function: function, Namespace: namespace}
+
+	for {
+		current, err := readDeploymentStatus(ctx, c, function, namespace)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			return current, err
+		case err == nil:
+			status = current
+		}
+
+		switch status.State {
+		case DeploymentConverged:
+			return status, nil
+		case DeploymentFailed, DeploymentRolledBack:
+			return status, &DeploymentError{Code: ErrorCodeDeploymentFailed, Status: status}
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, &DeploymentError{Code: ErrorCodeTimeout, Status: status}
+		case <-ticker.C:
+		}
+	}
+}
+
+// readDeploymentStatus reads the update status and tasks of a function's service
+func readDeploymentStatus(ctx context.Context, c ServiceStatusReader, function string, namespace string) (DeploymentStatus, error) {
+	status := DeploymentStatus{Function: function, Namespace: namespace, Tasks: []TaskStatus{}}
+	serviceName := namespacedName(function, namespace)
+
+	service, _, err := c.ServiceInspectWithRaw(ctx, serviceName, types.ServiceInspectOptions{})
+	if err != nil {
+		return status, err
+	}
+
+	if !isFunctionService(service) || namespaceFromLabels(service.Spec.Labels) != normalizeNamespace(namespace) {
+		return status, errdefs.NotFound(fmt.Errorf("no such service found: %s", function))
+	}
+
+	if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
+		status.DesiredReplicas = *service.Spec.Mode.Replicated.Replicas
+	}
+
+	running, err := getAvailableReplicas(c, serviceName)
+	if err != nil {
+		return status, err
+	}
+	status.RunningReplicas = running
+
+	taskFilter := filters.NewArgs()
+	taskFilter.Add("service", serviceName)
+
+	tasks, err := c.TaskList(ctx, types.TaskListOptions{Filters: taskFilter})
+	if err != nil {
+		return status, err
+	}
+
+	for _, task := range recentTasks(tasks) {
+		status.Tasks = append(status.Tasks, taskStatus(task))
+
+		// the newest error of a task which should be running explains why it is not
+		if len(status.Message) == 0 && task.DesiredState == swarm.TaskStateRunning && len(task.Status.Err) > 0 {
+			status.Message = task.Status.Err
+		}
+	}
+
+	if update := service.UpdateStatus; update != nil {
+		status.UpdateStatus = &UpdateStatus{
+			State:       string(update.State),
+			Message:     update.Message,
+			StartedAt:   update.StartedAt,
+			CompletedAt: update.CompletedAt,
+		}
+	}
+
+	status.State = deploymentState(service.UpdateStatus, status.RunningReplicas, status.DesiredReplicas)
+
+	if status.State == DeploymentConverged {
+		status.Message = ""
+	} else if service.UpdateStatus != nil && len(service.UpdateStatus.Message) > 0 && status.State != DeploymentProgressing {
+		status.Message = service.UpdateStatus.Message
+	}
+
+	return status, nil
+}
+
+// recentTasks returns up to maxTaskStatuses of the tasks, newest first
+func recentTasks(tasks []swarm.Task) []swarm.Task {
+	recent := append([]swarm.Task{}, tasks...)
+
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].Status.Timestamp.After(recent[j].Status.Timestamp)
+	})
+
+	if len(recent) > maxTaskStatuses {
+		recent = recent[:maxTaskStatuses]
+	}
+
+	return recent
+}
+
+func taskStatus(task swarm.Task) TaskStatus {
+	status := TaskStatus{
+		ID:           task.ID,
+		NodeID:       task.NodeID,
+		Slot:         task.Slot,
+		State:        string(task.Status.State),
+		DesiredState: string(task.DesiredState),
+		Message:      task.Status.Message,
+		Error:        task.Status.Err,
+		Timestamp:    task.Status.Timestamp,
+	}
+
+	if task.Status.ContainerStatus != nil && isTaskStopped(task.Status.State) {
+		exitCode := task.Status.ContainerStatus.ExitCode
+		status.ExitCode = &exitCode
+	}
+
+	return status
+}
+
+// isTaskStopped returns true for the states of a task whose container has exited
+func isTaskStopped(state swarm.TaskState) bool {
+	switch state {
+	case swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateShutdown:
+		return true
+	}
+
+	return false
+}
+
+// deploymentState derives the state of a deployment from the update status of its
+// service and its running tasks
+func deploymentState(update *swarm.UpdateStatus, running uint64, desired uint64) string {
+	if update != nil {
+		switch update.State {
+		case swarm.UpdateStatePaused, swarm.UpdateStateRollbackPaused:
+			return DeploymentFailed
+		case swarm.UpdateStateRollbackStarted:
+			return DeploymentRollingBack
+		case swarm.UpdateStateRollbackCompleted:
+			return DeploymentRolledBack
+		case swarm.UpdateStateUpdating:
+			return DeploymentProgressing
+		}
+	}
+
+	if running >= desired {
+		return DeploymentConverged
+	}
+
+	return DeploymentProgressing
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+type fakeServiceStatusReader struct {
+	service swarm.Service
+	tasks   []swarm.Task
+
+	// inspected counts calls to ServiceInspectWithRaw, after which next replaces the
+	// service when it is set
+	inspected int
+	next      func(inspected int, service *swarm.Service, tasks *[]swarm.Task)
+}
+
+func (f *fakeServiceStatusReader) ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	f.inspected++
+	if f.next != nil {
+		f.next(f.inspected, &f.service, &f.tasks)
+	}
+
+	return f.service, nil, nil
+}
+
+func (f *fakeServiceStatusReader) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	return f.tasks, nil
+}
+
+func makeStatusService(replicas uint64, update *swarm.UpdateStatus) swarm.Service {
+	service := swarm.Service{
+		Spec:         makeRollbackSpec("functions/echo:0.1", nil, nil),
+		UpdateStatus: update,
+	}
+	service.Spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+
+	return service
+}
+
+func makeStatusTask(id string, state swarm.TaskState, err string, age time.Duration) swarm.Task {
+	return swarm.Task{
+		ID:           id,
+		NodeID:       "node-1",
+		DesiredState: swarm.TaskStateRunning,
+		Status: swarm.TaskStatus{
+			State:     state,
+			Err:       err,
+			Timestamp: time.Now().Add(-age),
+		},
+	}
+}
+
+func Test_ReadDeploymentStatus(t *testing.T) {
+	cases := []struct {
+		name        string
+		update      *swarm.UpdateStatus
+		tasks       []swarm.Task
+		wantState   string
+		wantMessage string
+	}{
+		{
+			name:      "all replicas running",
+			tasks:     []swarm.Task{makeStatusTask("a", swarm.TaskStateRunning, "", 0), makeStatusTask("b", swarm.TaskStateRunning, "", 0)},
+			wantState: DeploymentConverged,
+		},
+		{
+			name:        "task with no suitable node",
+			tasks:       []swarm.Task{makeStatusTask("a", swarm.TaskStateRunning, "", time.Minute), makeStatusTask("b", swarm.TaskStatePending, "no suitable node", 0)},
+			wantState:   DeploymentProgressing,
+			wantMessage: "no suitable node",
+		},
+		{
+			name:        "update paused",
+			update:      &swarm.UpdateStatus{State: swarm.UpdateStatePaused, Message: "update paused due to failure or early termination of task b"},
+			tasks:       []swarm.Task{makeStatusTask("b", swarm.TaskStateRejected, "No such image: functions/echo:0.2", 0)},
+			wantState:   DeploymentFailed,
+			wantMessage: "update paused due to failure or early termination of task b",
+		},
+		{
+			name:      "rolled back",
+			update:    &swarm.UpdateStatus{State: swarm.UpdateStateRollbackCompleted, Message: "rollback completed"},
+			tasks:     []swarm.Task{makeStatusTask("a", swarm.TaskStateRunning, "", 0), makeStatusTask("b", swarm.TaskStateRunning, "", 0)},
+			wantState: DeploymentRolledBack,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reader := &fakeServiceStatusReader{service: makeStatusService(2, c.update), tasks: c.tasks}
+
+			status, err := readDeploymentStatus(context.Background(), reader, "echo", DefaultNamespace)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if status.State != c.wantState {
+				t.Errorf("want state: %s, got: %s", c.wantState, status.State)
+			}
+
+			if len(c.wantMessage) > 0 && status.Message != c.wantMessage {
+				t.Errorf("want message: %q, got: %q", c.wantMessage, status.Message)
+			}
+
+			if status.DesiredReplicas != 2 || len(status.Tasks) != len(c.tasks) {
+				t.Errorf("want 2 desired replicas and %d tasks, got: %d, %d", len(c.tasks), status.DesiredReplicas, len(status.Tasks))
+			}
+		})
+	}
+}
+
+func Test_WaitForDeployment(t *testing.T) {
+	reader := &fakeServiceStatusReader{
+		service: makeStatusService(1, nil),
+		next: func(inspected int, service *swarm.Service, tasks *[]swarm.Task) {
+			if inspected == 3 {
+				*tasks = []swarm.Task{makeStatusTask("a", swarm.TaskStateRunning, "", 0)}
+			}
+		},
+	}
+
+	status, err := waitForDeployment(context.Background(), reader, "echo", DefaultNamespace, time.Second, time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if status.State != DeploymentConverged || reader.inspected != 3 {
+		t.Errorf("want converged after 3 reads, got: %s after %d", status.State, reader.inspected)
+	}
+}
+
+func Test_WaitForDeployment_Failed(t *testing.T) {
+	reader := &fakeServiceStatusReader{
+		service: makeStatusService(1, &swarm.UpdateStatus{State: swarm.UpdateStatePaused, Message: "update paused"}),
+	}
+
+	_, err := waitForDeployment(context.Background(), reader, "echo", DefaultNamespace, time.Second, time.Millisecond)
+
+	var deploymentErr *DeploymentError
+	if !errors.As(err, &deploymentErr) || deploymentErr.Code != ErrorCodeDeploymentFailed {
+		t.Fatalf("want %s error, got: %v", ErrorCodeDeploymentFailed, err)
+	}
+}
+
+func Test_WaitForDeployment_Timeout(t *testing.T) {
+	reader := &fakeServiceStatusReader{service: makeStatusService(1, nil)}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/system/functions?wait=true&timeout=10ms", nil)
+
+	_, timeout, err := waitOptions(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	writeWaitResult(w, r, reader, "echo", DefaultNamespace, timeout)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("want status: %d, got: %d, body: %s", http.StatusGatewayTimeout, w.Code, w.Body.String())
+	}
+}
@@ -13,16 +13,16 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 
 	typesv1 "github.com/openfaas/faas-provider/types"
 )
 
-// UpdateHandler updates an existng function
-func UpdateHandler(c *client.Client, maxRestarts uint64, restartDelay time.Duration) http.HandlerFunc {
+// UpdateHandler updates an existng function, the new spec of the function is recorded in
+// history when it is not nil
+func UpdateHandler(c *client.Client, settings ProviderSettings, restartPolicy RestartPolicyDefaults, history *RevisionHistory) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
-
 		defer r.Body.Close()
 		body, _ := ioutil.ReadAll(r.Body)
 
@@ -30,92 +30,117 @@ func UpdateHandler(c *client.Client, maxRestarts uint64, restartDelay time.Durat
 		err := json.Unmarshal(body, &request)
 		if err != nil {
 			log.Println("Error parsing request:", err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
+			writeError(w, ErrorCodeInvalidRequest, "", fmt.Errorf("unable to parse request: %w", err))
 			return
 		}
 
-		serviceInspectopts := types.ServiceInspectOptions{
-			InsertDefaults: true,
+		if len(request.Namespace) == 0 {
+			request.Namespace = getRequestNamespace(r)
 		}
 
-		service, _, err := c.ServiceInspectWithRaw(ctx, request.Service, serviceInspectopts)
+		dryRun, err := isDryRun(r)
 		if err != nil {
-			log.Println("Error inspecting service", err)
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(err.Error()))
+			writeError(w, ErrorCodeInvalidRequest, request.Service, err)
 			return
 		}
 
-		secrets, err := makeSecretsArray(c, request.Secrets)
+		wait, waitTimeout, err := waitOptions(r)
 		if err != nil {
-			log.Println(err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Deployment error: " + err.Error()))
+			writeError(w, ErrorCodeInvalidRequest, request.Service, err)
 			return
 		}
 
-		if len(request.Network) == 0 {
-			networkValue, networkErr := lookupNetwork(c)
-			if networkErr != nil {
-				log.Println("Error querying networks", networkErr)
-			} else {
-				request.Network = networkValue
-			}
+		spec, warnings, err := updateFunction(c, &request, dryRun, settings, restartPolicy)
+		if err != nil {
+			log.Println("Error updating service:", err)
+			writeError(w, dockerErrorCode(err, ErrorCodeInvalidSpec), request.Service, err)
+			return
 		}
 
-		if err := updateSpec(&request, &service.Spec, maxRestarts, restartDelay, secrets); err != nil {
-			log.Println("Error updating service spec:", err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Update spc error: " + err.Error()))
+		if dryRun {
+			writeDryRun(w, spec, warnings)
 			return
 		}
 
-		updateOpts := types.ServiceUpdateOptions{}
-		updateOpts.RegistryAuthFrom = types.RegistryAuthFromSpec
-
-		if len(request.RegistryAuth) > 0 {
-			auth, err := BuildEncodedAuthConfig(request.RegistryAuth, request.Image)
-			if err != nil {
-				log.Println("Error building registry auth configuration:", err)
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("Invalid registry auth"))
-				return
-			}
-			updateOpts.EncodedRegistryAuth = auth
+		history.Record(r, RevisionUpdate, 0, spec)
+
+		if wait {
+			writeWaitResult(w, r, c, request.Service, request.Namespace, waitTimeout)
+			return
 		}
 
-		service.Spec.UpdateConfig.Order = "start-first"
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
 
-		response, err := c.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, updateOpts)
+// updateFunction applies a function deployment to the function's existing service, and
+// returns the spec submitted to Swarm along with any warnings. When dryRun is set the spec
+// is returned without being submitted. Invalid deployments are returned as a
+// *ValidationError, other errors are from the Docker API.
+func updateFunction(c *client.Client, request *typesv1.FunctionDeployment, dryRun bool, settings ProviderSettings, restartPolicy RestartPolicyDefaults) (swarm.ServiceSpec, []string, error) {
+	ctx := context.Background()
 
-		if err != nil {
-			log.Println("Error updating service:", err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Update error: " + err.Error()))
-			return
-		}
+	serviceInspectopts := types.ServiceInspectOptions{
+		InsertDefaults: true,
+	}
 
-		if response.Warnings != nil {
-			log.Println(response.Warnings)
-		}
+	service, _, err := c.ServiceInspectWithRaw(ctx, namespacedName(request.Service, request.Namespace), serviceInspectopts)
+	if err != nil {
+		return swarm.ServiceSpec{}, nil, fmt.Errorf("error inspecting service: %w", err)
+	}
 
-		w.WriteHeader(http.StatusAccepted)
+	if namespaceFromLabels(service.Spec.Labels) != normalizeNamespace(request.Namespace) {
+		log.Printf("Service %s is not in namespace %s\n", service.Spec.Name, request.Namespace)
+		return swarm.ServiceSpec{}, nil, errdefs.NotFound(fmt.Errorf("no such service found: %s", request.Service))
+	}
+
+	prepared, err := prepareDeployment(c, request, false, settings)
+	if err != nil {
+		return swarm.ServiceSpec{}, nil, err
 	}
+
+	if err := updateSpec(request, &service.Spec, settings, restartPolicy, prepared.secrets); err != nil {
+		return swarm.ServiceSpec{}, nil, fmt.Errorf("error updating service spec: %w", err)
+	}
+
+	updateOpts := types.ServiceUpdateOptions{}
+	updateOpts.RegistryAuthFrom = types.RegistryAuthFromSpec
+
+	if len(prepared.registryAuth) > 0 {
+		updateOpts.EncodedRegistryAuth = prepared.registryAuth
+	}
+
+	if dryRun {
+		return service.Spec, prepared.warnings, nil
+	}
+
+	response, err := c.ServiceUpdate(ctx, service.ID, service.Version, service.Spec, updateOpts)
+	if err != nil {
+		return swarm.ServiceSpec{}, nil, err
+	}
+
+	if response.Warnings != nil {
+		log.Println(response.Warnings)
+	}
+
+	return service.Spec, prepared.warnings, nil
 }
 
-func updateSpec(request *typesv1.FunctionDeployment, spec *swarm.ServiceSpec, maxRestarts uint64, restartDelay time.Duration, secrets []*swarm.SecretReference) error {
+func updateSpec(request *typesv1.FunctionDeployment, spec *swarm.ServiceSpec, settings ProviderSettings, restartPolicy RestartPolicyDefaults, secrets []*swarm.SecretReference) error {
 
 	constraints := []string{}
 	if request.Constraints != nil && len(request.Constraints) > 0 {
 		constraints = request.Constraints
 	} else {
-		constraints = linuxOnlyConstraints
+		constraints = settings.Constraints
+	}
+
+	restart, err := buildRestartPolicy(requestAnnotations(request.Annotations), restartPolicy)
+	if err != nil {
+		return err
 	}
 
-	spec.TaskTemplate.RestartPolicy.MaxAttempts = &maxRestarts
-	spec.TaskTemplate.RestartPolicy.Condition = swarm.RestartPolicyConditionAny
-	spec.TaskTemplate.RestartPolicy.Delay = &restartDelay
+	spec.TaskTemplate.RestartPolicy = restart
 	spec.TaskTemplate.ContainerSpec.Image = request.Image
 
 	labels, err := buildLabels(request)
@@ -152,16 +177,15 @@ func updateSpec(request *typesv1.FunctionDeployment, spec *swarm.ServiceSpec, ma
 		Constraints: constraints,
 	}
 
-	spec.Annotations.Name = request.Service
+	spec.Annotations.Name = namespacedName(request.Service, request.Namespace)
 
-	spec.RollbackConfig = &swarm.UpdateConfig{
-		FailureAction: "pause",
+	updateConfig, rollbackConfig, err := buildUpdateConfig(requestAnnotations(request.Annotations))
+	if err != nil {
+		return err
 	}
 
-	spec.UpdateConfig = &swarm.UpdateConfig{
-		Parallelism:   1,
-		FailureAction: "rollback",
-	}
+	spec.UpdateConfig = updateConfig
+	spec.RollbackConfig = rollbackConfig
 
 	env := buildEnv(request.EnvProcess, request.EnvVars)
 
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// Annotations which control how the tasks of a function are replaced when it is updated
+const (
+	// UpdateParallelismAnnotation is the number of tasks updated at a time, 0 updates all at once
+	UpdateParallelismAnnotation = "com.openfaas.update.parallelism"
+	// UpdateDelayAnnotation is the time waited between updating each batch of tasks, i.e. 10s
+	UpdateDelayAnnotation = "com.openfaas.update.delay"
+	// UpdateMonitorAnnotation is how long each task is monitored for failure after it is updated
+	UpdateMonitorAnnotation = "com.openfaas.update.monitor"
+	// UpdateMaxFailureRatioAnnotation is the fraction of tasks that may fail during an update
+	// before the failure action is taken, from 0 to 1
+	UpdateMaxFailureRatioAnnotation = "com.openfaas.update.max-failure-ratio"
+	// UpdateOrderAnnotation is either start-first, to start the new task before stopping the
+	// old one, or stop-first
+	UpdateOrderAnnotation = "com.openfaas.update.order"
+	// UpdateFailureActionAnnotation is the action taken when an update fails: rollback, pause
+	// or continue
+	UpdateFailureActionAnnotation = "com.openfaas.update.failure-action"
+)
+
+const (
+	defaultUpdateParallelism   = uint64(1)
+	defaultUpdateOrder         = swarm.UpdateOrderStartFirst
+	defaultUpdateFailureAction = swarm.UpdateFailureActionRollback
+)
+
+// buildUpdateConfig returns the update and rollback configs for a function from its
+// annotations. Rollbacks replace tasks in the same way as updates, and pause if they fail.
+// Invalid annotations are returned as a *ValidationError.
+func buildUpdateConfig(annotations map[string]string) (update *swarm.UpdateConfig, rollback *swarm.UpdateConfig, err error) {
+	validationErr := &ValidationError{}
+
+	update = &swarm.UpdateConfig{
+		Parallelism:   defaultUpdateParallelism,
+		Order:         defaultUpdateOrder,
+		FailureAction: defaultUpdateFailureAction,
+	}
+
+	if value, ok := annotations[UpdateParallelismAnnotation]; ok {
+		parallelism, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			validationErr.add("annotations."+UpdateParallelismAnnotation, "%q must be a whole number of tasks", value)
+		}
+		update.Parallelism = parallelism
+	}
+
+	if value, ok := annotations[UpdateDelayAnnotation]; ok {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			validationErr.add("annotations."+UpdateDelayAnnotation, "%q must be a duration, i.e. 10s", value)
+		}
+		update.Delay = delay
+	}
+
+	if value, ok := annotations[UpdateMonitorAnnotation]; ok {
+		monitor, err := time.ParseDuration(value)
+		if err != nil || monitor < 0 {
+			validationErr.add("annotations."+UpdateMonitorAnnotation, "%q must be a duration, i.e. 30s", value)
+		}
+		update.Monitor = monitor
+	}
+
+	if value, ok := annotations[UpdateMaxFailureRatioAnnotation]; ok {
+		ratio, err := strconv.ParseFloat(value, 32)
+		if err != nil || ratio < 0 || ratio > 1 {
+			validationErr.add("annotations."+UpdateMaxFailureRatioAnnotation, "%q must be a number from 0 to 1", value)
+		}
+		update.MaxFailureRatio = float32(ratio)
+	}
+
+	if value, ok := annotations[UpdateOrderAnnotation]; ok {
+		switch value {
+		case swarm.UpdateOrderStartFirst, swarm.UpdateOrderStopFirst:
+			update.Order = value
+		default:
+			validationErr.add("annotations."+UpdateOrderAnnotation, "%q must be %s or %s",
+				value, swarm.UpdateOrderStartFirst, swarm.UpdateOrderStopFirst)
+		}
+	}
+
+	if value, ok := annotations[UpdateFailureActionAnnotation]; ok {
+		switch value {
+		case swarm.UpdateFailureActionRollback, swarm.UpdateFailureActionPause, swarm.UpdateFailureActionContinue:
+			update.FailureAction = value
+		default:
+			validationErr.add("annotations."+UpdateFailureActionAnnotation, "%q must be %s, %s or %s",
+				value, swarm.UpdateFailureActionRollback, swarm.UpdateFailureActionPause, swarm.UpdateFailureActionContinue)
+		}
+	}
+
+	if len(validationErr.Errors) > 0 {
+		return nil, nil, validationErr
+	}
+
+	rollback = &swarm.UpdateConfig{
+		Parallelism:     update.Parallelism,
+		Delay:           update.Delay,
+		Monitor:         update.Monitor,
+		MaxFailureRatio: update.MaxFailureRatio,
+		Order:           update.Order,
+		FailureAction:   swarm.UpdateFailureActionPause,
+	}
+
+	return update, rollback, nil
+}
+
+// updateConfigAnnotations returns the annotations describing an update config, so that
+// the strategy in effect is shown for every function
+func updateConfigAnnotations(config *swarm.UpdateConfig) map[string]string {
+	if config == nil {
+		return nil
+	}
+
+	return map[string]string{
+		UpdateParallelismAnnotation:     strconv.FormatUint(config.Parallelism, 10),
+		UpdateDelayAnnotation:           config.Delay.String(),
+		UpdateMonitorAnnotation:         config.Monitor.String(),
+		UpdateMaxFailureRatioAnnotation: strconv.FormatFloat(float64(config.MaxFailureRatio), 'f', -1, 32),
+		UpdateOrderAnnotation:           config.Order,
+		UpdateFailureActionAnnotation:   config.FailureAction,
+	}
+}
+
+// requestAnnotations returns the annotations of a function deployment, which may be nil
+func requestAnnotations(annotations *map[string]string) map[string]string {
+	if annotations == nil {
+		return nil
+	}
+
+	return *annotations
+}
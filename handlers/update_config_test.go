@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func Test_BuildUpdateConfig_Defaults(t *testing.T) {
+	update, rollback, err := buildUpdateConfig(nil)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	want := &swarm.UpdateConfig{
+		Parallelism:   1,
+		Order:         swarm.UpdateOrderStartFirst,
+		FailureAction: swarm.UpdateFailureActionRollback,
+	}
+	if !reflect.DeepEqual(update, want) {
+		t.Errorf("want update config: %+v, got: %+v", want, update)
+	}
+
+	if rollback.FailureAction != swarm.UpdateFailureActionPause {
+		t.Errorf("want rollback failure action: %s, got: %s", swarm.UpdateFailureActionPause, rollback.FailureAction)
+	}
+}
+
+func Test_BuildUpdateConfig_Annotations(t *testing.T) {
+	annotations := map[string]string{
+		UpdateParallelismAnnotation:     "2",
+		UpdateDelayAnnotation:           "10s",
+		UpdateMonitorAnnotation:         "30s",
+		UpdateMaxFailureRatioAnnotation: "0.25",
+		UpdateOrderAnnotation:           "stop-first",
+		UpdateFailureActionAnnotation:   "continue",
+	}
+
+	update, rollback, err := buildUpdateConfig(annotations)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	want := &swarm.UpdateConfig{
+		Parallelism:     2,
+		Delay:           10 * time.Second,
+		Monitor:         30 * time.Second,
+		MaxFailureRatio: 0.25,
+		Order:           swarm.UpdateOrderStopFirst,
+		FailureAction:   swarm.UpdateFailureActionContinue,
+	}
+	if !reflect.DeepEqual(update, want) {
+		t.Errorf("want update config: %+v, got: %+v", want, update)
+	}
+
+	wantRollback := *want
+	wantRollback.FailureAction = swarm.UpdateFailureActionPause
+	if !reflect.DeepEqual(rollback, &wantRollback) {
+		t.Errorf("want rollback config: %+v, got: %+v", wantRollback, rollback)
+	}
+
+	if got := updateConfigAnnotations(update); !reflect.DeepEqual(got, map[string]string{
+		UpdateParallelismAnnotation:     "2",
+		UpdateDelayAnnotation:           "10s",
+		UpdateMonitorAnnotation:         "30s",
+		UpdateMaxFailureRatioAnnotation: "0.25",
+		UpdateOrderAnnotation:           "stop-first",
+		UpdateFailureActionAnnotation:   "continue",
+	}) {
+		t.Errorf("want annotations to round trip, got: %v", got)
+	}
+}
+
+func Test_BuildUpdateConfig_Invalid(t *testing.T) {
+	annotations := map[string]string{
+		UpdateParallelismAnnotation:     "-1",
+		UpdateDelayAnnotation:           "soon",
+		UpdateMonitorAnnotation:         "-5s",
+		UpdateMaxFailureRatioAnnotation: "1.5",
+		UpdateOrderAnnotation:           "random",
+		UpdateFailureActionAnnotation:   "retry",
+	}
+
+	_, _, err := buildUpdateConfig(annotations)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("want *ValidationError, got: %v", err)
+	}
+
+	var fields []string
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+
+	want := []string{
+		"annotations." + UpdateParallelismAnnotation,
+		"annotations." + UpdateDelayAnnotation,
+		"annotations." + UpdateMonitorAnnotation,
+		"annotations." + UpdateMaxFailureRatioAnnotation,
+		"annotations." + UpdateOrderAnnotation,
+		"annotations." + UpdateFailureActionAnnotation,
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("want field errors: %v, got: %v", want, fields)
+	}
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	typesv1 "github.com/openfaas/faas-provider/types"
+)
+
+// maxServiceNameLength is the longest name Swarm accepts for a service
+const maxServiceNameLength = 63
+
+// functionNamePattern matches the names a function can be deployed with, "." and "@" are
+// excluded as they separate the namespace and endpoint in the function proxy, and "_" as it
+// separates the namespace from the name of a service
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]*$`)
+
+// existingFunctionNamePattern matches the names of functions deployed before "." and "_"
+// were excluded, as bootstrap.NameExpression does, so that they can still be updated
+var existingFunctionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// constraintPattern matches a Swarm placement constraint, i.e. "node.role == manager"
+var constraintPattern = regexp.MustCompile(`^\s*([a-zA-Z0-9_.-]+)\s*(==|!=)\s*(\S.*?)\s*$`)
+
+// constraintKeys are the placement constraint keys Swarm matches nodes on, keys with a
+// trailing "." are prefixes
+var constraintKeys = []string{
+	"node.id",
+	"node.hostname",
+	"node.role",
+	"node.platform.os",
+	"node.platform.arch",
+	"node.labels.",
+	"engine.labels.",
+}
+
+// reservedLabels are set by the provider on every function, and are rejected in requests as
+// the name and namespace of a function are read back from them
+var reservedLabels = []string{"com.openfaas.function", "function", namespaceLabel}
+
+// FieldError describes a field of a function deployment that failed validation
+type FieldError struct {
+	// Field is the JSON path of the field, i.e. "limits.memory" or "constraints[0]"
+	Field string `json:"field"`
+	// Message describes why the value is invalid
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a function deployment fails validation
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message)
+	}
+
+	return "invalid function deployment: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// DryRunResponse is returned by the deploy and update handlers for ?dryRun=true, with the
+// Swarm service spec that would have been submitted
+type DryRunResponse struct {
+	Spec     swarm.ServiceSpec `json:"spec"`
+	Warnings []string          `json:"warnings"`
+}
+
+// writeDryRun writes the spec that would have been submitted to Swarm
+func writeDryRun(w http.ResponseWriter, spec swarm.ServiceSpec, warnings []string) {
+	body, err := json.Marshal(DryRunResponse{Spec: spec, Warnings: warnings})
+	if err != nil {
+		writeError(w, ErrorCodeInternal, spec.Annotations.Name, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// preparedDeployment holds what is resolved from Docker to build the spec of a function
+type preparedDeployment struct {
+	secrets      []*swarm.SecretReference
+	registryAuth string
+	warnings     []string
+}
+
+// isDryRun returns true when the request has ?dryRun=true
+func isDryRun(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("dryRun")
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for dryRun: %q", value)
+	}
+
+	return dryRun, nil
+}
+
+// prepareDeployment validates the function deployment and resolves its secrets, registry
+// auth and network. create is set when the function is deployed rather than updated.
+// Invalid input is returned as a *ValidationError, errors from the Docker API are returned
+// as they are.
+func prepareDeployment(c *client.Client, request *typesv1.FunctionDeployment, create bool, settings ProviderSettings) (preparedDeployment, error) {
+	prepared := preparedDeployment{}
+
+	validationErr, warnings := validateDeployment(request, create)
+	prepared.warnings = warnings
+
+	if len(request.RegistryAuth) > 0 {
+		auth, err := BuildEncodedAuthConfig(request.RegistryAuth, request.Image)
+		if err != nil {
+			validationErr.add("registryAuth", "invalid registry auth: %s", err)
+		}
+		prepared.registryAuth = auth
+	}
+
+	secrets, err := makeSecretsArray(c, request.Secrets, request.Namespace, settings.SecretsPath)
+	if err != nil {
+		if len(dockerErrorClass(err)) > 0 {
+			return prepared, err
+		}
+
+		validationErr.add("secrets", "%s", err)
+	}
+	prepared.secrets = secrets
+
+	if len(request.Network) == 0 {
+		network, err := lookupNamespaceNetwork(c, request.Namespace, settings.NetworkLabel)
+		switch {
+		case err == nil:
+			request.Network = network
+		case len(dockerErrorClass(err)) > 0 && !isDefaultNamespace(request.Namespace):
+			return prepared, err
+		case !isDefaultNamespace(request.Namespace):
+			validationErr.add("namespace", "%s", err)
+		}
+	}
+
+	if len(validationErr.Errors) > 0 {
+		return prepared, validationErr
+	}
+
+	return prepared, nil
+}
+
+// validateDeployment checks the fields of a function deployment that do not need the
+// Docker API, returning any field errors along with warnings about accepted values. New
+// functions are held to the stricter functionNamePattern when create is set.
+func validateDeployment(request *typesv1.FunctionDeployment, create bool) (*ValidationError, []string) {
+	validationErr := &ValidationError{}
+	warnings := []string{}
+
+	switch {
+	case len(request.Service) == 0:
+		validationErr.add("service", "is required")
+	case create && !functionNamePattern.MatchString(request.Service):
+		validationErr.add("service", "%q must start with a letter or digit and contain only letters, digits and '-'", request.Service)
+	case !existingFunctionNamePattern.MatchString(request.Service):
+		validationErr.add("service", "%q must start with a letter or digit and contain only letters, digits, '-', '_' and '.'", request.Service)
+	case len(namespacedName(request.Service, request.Namespace)) > maxServiceNameLength:
+		validationErr.add("service", "%q is longer than %d characters including the namespace", request.Service, maxServiceNameLength)
+	}
+
+	if len(request.Image) == 0 {
+		validationErr.add("image", "is required")
+	} else if named, err := reference.ParseNormalizedNamed(request.Image); err != nil {
+		validationErr.add("image", "%q is not a valid image reference: %s", request.Image, err)
+	} else if reference.IsNameOnly(named) {
+		warnings = append(warnings, fmt.Sprintf("image %q has no tag, latest will be used", request.Image))
+	}
+
+	limitMemory := validateMemory(validationErr, "limits.memory", request.Limits)
+	requestMemory := validateMemory(validationErr, "requests.memory", request.Requests)
+	limitCPU := validateCPU(validationErr, "limits.cpu", request.Limits)
+	requestCPU := validateCPU(validationErr, "requests.cpu", request.Requests)
+
+	if limitMemory > 0 && requestMemory > limitMemory {
+		warnings = append(warnings, "requests.memory is greater than limits.memory")
+	}
+
+	if limitCPU > 0 && requestCPU > limitCPU {
+		warnings = append(warnings, "requests.cpu is greater than limits.cpu")
+	}
+
+	for i, constraint := range request.Constraints {
+		field := fmt.Sprintf("constraints[%d]", i)
+
+		match := constraintPattern.FindStringSubmatch(constraint)
+		if match == nil {
+			validationErr.add(field, "%q must be in the form <key>==<value> or <key>!=<value>", constraint)
+			continue
+		}
+
+		if !isConstraintKey(match[1]) {
+			warnings = append(warnings, fmt.Sprintf("%s: unknown key %q, no node may match", field, match[1]))
+		}
+	}
+
+	for _, key := range sortedKeys(request.EnvVars) {
+		if len(key) == 0 || strings.ContainsAny(key, "= ") {
+			validationErr.add("envVars", "%q is not a valid environment variable name", key)
+		}
+	}
+
+	if request.Labels != nil {
+		validateLabels(validationErr, *request.Labels)
+	}
+
+	if _, err := buildLabels(request); err != nil {
+		validationErr.add("annotations", "%s", err)
+	}
+
+	var updateConfigErr *ValidationError
+	if _, _, err := buildUpdateConfig(requestAnnotations(request.Annotations)); errors.As(err, &updateConfigErr) {
+		validationErr.Errors = append(validationErr.Errors, updateConfigErr.Errors...)
+	}
+
+	var restartPolicyErr *ValidationError
+	if _, err := buildRestartPolicy(requestAnnotations(request.Annotations), RestartPolicyDefaults{}); errors.As(err, &restartPolicyErr) {
+		validationErr.Errors = append(validationErr.Errors, restartPolicyErr.Errors...)
+	}
+
+	return validationErr, warnings
+}
+
+// validateLabels rejects the reserved labels and checks the values of the labels the
+// provider acts on
+func validateLabels(validationErr *ValidationError, labels map[string]string) {
+	for _, key := range reservedLabels {
+		if _, ok := labels[key]; ok {
+			validationErr.add("labels."+key, "is set by the provider and can not be used")
+		}
+	}
+
+	var minScale, maxScale int
+	var minSet, maxSet bool
+
+	for _, key := range sortedKeys(labels) {
+		value := labels[key]
+		field := "labels." + key
+
+		switch key {
+		case MinScaleLabel, MaxScaleLabel:
+			replicas, err := strconv.Atoi(value)
+			if err != nil || replicas < 0 {
+				validationErr.add(field, "%q must be a whole number of replicas", value)
+				continue
+			}
+
+			if key == MinScaleLabel {
+				minScale, minSet = replicas, true
+			} else {
+				maxScale, maxSet = replicas, true
+			}
+
+		case ScaleTargetLabel:
+			if target, err := strconv.ParseFloat(value, 64); err != nil || target <= 0 {
+				validationErr.add(field, "%q must be a number greater than zero", value)
+			}
+
+		case ScaleTypeLabel:
+			if value != scaleTypeRPS && value != scaleTypeCapacity {
+				validationErr.add(field, "%q must be %s or %s", value, scaleTypeRPS, scaleTypeCapacity)
+			}
+
+		case ScaleToZeroLabel:
+			if _, err := strconv.ParseBool(value); err != nil {
+				validationErr.add(field, "%q must be true or false", value)
+			}
+
+		case ScaleToZeroDurationLabel:
+			if _, err := time.ParseDuration(value); err != nil {
+				validationErr.add(field, "%q must be a duration, i.e. 30m", value)
+			}
+
+		case LoadBalancerLabel:
+			if !IsLoadBalancerStrategy(value) {
+				validationErr.add(field, "%q must be %s, %s or %s", value, RoundRobin, LeastConnections, PowerOfTwoChoices)
+			}
+		}
+	}
+
+	if minSet && maxSet && minScale > maxScale {
+		validationErr.add("labels."+MinScaleLabel, "%d is greater than %s %d", minScale, MaxScaleLabel, maxScale)
+	}
+}
+
+// validateMemory returns the memory in bytes of the resources, recording a field error
+// when it cannot be parsed
+func validateMemory(validationErr *ValidationError, field string, resources *typesv1.FunctionResources) int64 {
+	if resources == nil || len(resources.Memory) == 0 {
+		return 0
+	}
+
+	memoryBytes, err := parseMemory(resources.Memory)
+	if err != nil || memoryBytes <= 0 {
+		validationErr.add(field, "%q must be a size in bytes, i.e. 128m", resources.Memory)
+		return 0
+	}
+
+	return memoryBytes
+}
+
+// validateCPU returns the nano CPUs of the resources, recording a field error when it
+// cannot be parsed
+func validateCPU(validationErr *ValidationError, field string, resources *typesv1.FunctionResources) int64 {
+	if resources == nil || len(resources.CPU) == 0 {
+		return 0
+	}
+
+	nanoCPUs, err := parseCPU(resources.CPU)
+	if err != nil || nanoCPUs <= 0 {
+		validationErr.add(field, "%q must be a whole number of nano CPUs, i.e. 500000000", resources.CPU)
+		return 0
+	}
+
+	return nanoCPUs
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func isConstraintKey(key string) bool {
+	for _, known := range constraintKeys {
+		if key == known || (strings.HasSuffix(known, ".") && strings.HasPrefix(key, known) && len(key) > len(known)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	typesv1 "github.com/openfaas/faas-provider/types"
+)
+
+func Test_ValidateDeployment(t *testing.T) {
+	valid := func() typesv1.FunctionDeployment {
+		return typesv1.FunctionDeployment{
+			Service:   "echo",
+			Image:     "functions/alpine:latest",
+			Namespace: DefaultNamespace,
+		}
+	}
+
+	scenarios := []struct {
+		name       string
+		update     func(*typesv1.FunctionDeployment)
+		wantFields []string
+	}{
+		{"valid request", func(r *typesv1.FunctionDeployment) {}, nil},
+		{"missing service", func(r *typesv1.FunctionDeployment) { r.Service = "" }, []string{"service"}},
+		{"service with namespace separator", func(r *typesv1.FunctionDeployment) { r.Service = "echo.team-a" }, []string{"service"}},
+		{"service with service name separator", func(r *typesv1.FunctionDeployment) { r.Service = "team-a_echo" }, []string{"service"}},
+		{"missing image", func(r *typesv1.FunctionDeployment) { r.Image = "" }, []string{"image"}},
+		{"invalid image", func(r *typesv1.FunctionDeployment) { r.Image = "Functions/Alpine:latest" }, []string{"image"}},
+		{"invalid memory and cpu", func(r *typesv1.FunctionDeployment) {
+			r.Limits = &typesv1.FunctionResources{Memory: "lots", CPU: "0.5"}
+		}, []string{"limits.memory", "limits.cpu"}},
+		{"invalid constraint", func(r *typesv1.FunctionDeployment) {
+			r.Constraints = []string{"node.role == manager", "node.role=manager"}
+		}, []string{"constraints[1]"}},
+		{"invalid env var", func(r *typesv1.FunctionDeployment) {
+			r.EnvVars = map[string]string{"A=B": "c"}
+		}, []string{"envVars"}},
+		{"invalid scale labels", func(r *typesv1.FunctionDeployment) {
+			r.Labels = &map[string]string{MinScaleLabel: "five", ScaleTypeLabel: "cpu"}
+		}, []string{"labels." + MinScaleLabel, "labels." + ScaleTypeLabel}},
+		{"min scale greater than max", func(r *typesv1.FunctionDeployment) {
+			r.Labels = &map[string]string{MinScaleLabel: "5", MaxScaleLabel: "2"}
+		}, []string{"labels." + MinScaleLabel}},
+		{"reserved labels", func(r *typesv1.FunctionDeployment) {
+			r.Labels = &map[string]string{"com.openfaas.function": "other", namespaceLabel: "prod"}
+		}, []string{"labels.com.openfaas.function", "labels." + namespaceLabel}},
+		{"annotation clashes with label", func(r *typesv1.FunctionDeployment) {
+			r.Labels = &map[string]string{annotationLabelPrefix + "topic": "a"}
+			r.Annotations = &map[string]string{"topic": "b"}
+		}, []string{"annotations"}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			request := valid()
+			s.update(&request)
+
+			validationErr, _ := validateDeployment(&request, true)
+
+			var fields []string
+			for _, fieldErr := range validationErr.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+
+			if !reflect.DeepEqual(fields, s.wantFields) {
+				t.Errorf("want field errors: %v, got: %v", s.wantFields, validationErr.Errors)
+			}
+		})
+	}
+}
+
+func Test_ValidateDeployment_ExistingNames(t *testing.T) {
+	scenarios := []struct {
+		service string
+		create  bool
+		valid   bool
+	}{
+		{"my_func", true, false},
+		{"my_func", false, true},
+		{"echo.v1", false, true},
+		{"_echo", false, false},
+		{"echo@v1", false, false},
+	}
+
+	for _, s := range scenarios {
+		request := typesv1.FunctionDeployment{Service: s.service, Image: "functions/alpine:latest"}
+
+		validationErr, _ := validateDeployment(&request, s.create)
+		if valid := len(validationErr.Errors) == 0; valid != s.valid {
+			t.Errorf("want %q valid: %v when create is %v, got: %v", s.service, s.valid, s.create, validationErr.Errors)
+		}
+	}
+}
+
+func Test_ValidateDeployment_Warnings(t *testing.T) {
+	request := typesv1.FunctionDeployment{
+		Service:     "echo",
+		Image:       "functions/alpine",
+		Constraints: []string{"node.zone == eu"},
+		Limits:      &typesv1.FunctionResources{Memory: "64m"},
+		Requests:    &typesv1.FunctionResources{Memory: "128m"},
+	}
+
+	validationErr, warnings := validateDeployment(&request, true)
+	if len(validationErr.Errors) > 0 {
+		t.Fatalf("want no field errors, got: %v", validationErr.Errors)
+	}
+
+	want := []string{
+		`image "functions/alpine" has no tag, latest will be used`,
+		"requests.memory is greater than limits.memory",
+		`constraints[0]: unknown key "node.zone", no node may match`,
+	}
+
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("want warnings: %v, got: %v", want, warnings)
+	}
+}
+
+func Test_IsDryRun(t *testing.T) {
+	scenarios := []struct {
+		query   string
+		want    bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"?dryRun=true", true, false},
+		{"?dryRun=false", false, false},
+		{"?dryRun=maybe", false, true},
+	}
+
+	for _, s := range scenarios {
+		r := httptest.NewRequest("POST", "/system/functions"+s.query, nil)
+
+		got, err := isDryRun(r)
+		if got != s.want || (err != nil) != s.wantErr {
+			t.Errorf("isDryRun(%q) want: %v, error: %v, got: %v, %v", s.query, s.want, s.wantErr, got, err)
+		}
+	}
+}
@@ -5,25 +5,40 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
-	"time"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
 
+	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas-provider/logs"
 	"github.com/openfaas/faas-provider/proxy"
 
 	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
 
 	bootstrap "github.com/openfaas/faas-provider"
 	bootTypes "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas-swarm/authentication"
+	"github.com/openfaas/faas-swarm/authorization"
+	"github.com/openfaas/faas-swarm/certificates"
 	"github.com/openfaas/faas-swarm/handlers"
+	"github.com/openfaas/faas-swarm/metrics"
 	"github.com/openfaas/faas-swarm/types"
 	"github.com/openfaas/faas-swarm/version"
 )
 
 func main() {
 
+	metricsOptions := metrics.BuildMetricsOptions()
+	metricsOptions.Register(prometheus.DefaultRegisterer)
+
 	var err error
-	dockerClient, err := client.NewEnvClient()
+	dockerClient, err := newDockerClient(metricsOptions)
 	if err != nil {
 		log.Fatalf("Error with Docker client: %s.", err.Error())
 	}
@@ -34,12 +49,6 @@ func main() {
 	}
 
 	log.Printf("Docker API version: %s, %s\n", dockerVersion.APIVersion, dockerVersion.Version)
-	// How many times to reschedule a function.
-	maxRestarts := uint64(5)
-
-	// Delay between container restarts
-	restartDelay := time.Second * 5
-
 	readConfig := types.ReadConfig{}
 	osEnv := bootTypes.OsEnv{}
 	cfg, err := readConfig.Read(osEnv)
@@ -50,21 +59,130 @@ func main() {
 	log.Printf("HTTP Read Timeout: %s\n", cfg.FaaSConfig.GetReadTimeout())
 	log.Printf("HTTP Write Timeout: %s\n", cfg.FaaSConfig.WriteTimeout)
 
-	funcProxyHandler := handlers.NewFunctionLookup(dockerClient, cfg.DNSRoundRobin)
+	effectiveConfig := cfg.Effective()
+	configKeys := make([]string, 0, len(effectiveConfig))
+	for key := range effectiveConfig {
+		configKeys = append(configKeys, key)
+	}
+	sort.Strings(configKeys)
+	for _, key := range configKeys {
+		log.Printf("Config %s: %q\n", key, effectiveConfig[key])
+	}
+
+	ownerLabel, ownerLabelValue := cfg.OwnerLabelPair()
+	settings := handlers.ProviderSettings{
+		NetworkLabel:    cfg.NetworkLabel,
+		Constraints:     cfg.DefaultConstraints,
+		SecretsPath:     cfg.FunctionSecretsPath,
+		OwnerLabel:      ownerLabel,
+		OwnerLabelValue: ownerLabelValue,
+		MaxReplicas:     cfg.MaxReplicas,
+	}
+
+	inventory := handlers.NewInventory(dockerClient, handlers.InventoryConfig{
+		ResyncInterval: cfg.InventoryResyncInterval,
+		TaskTTL:        cfg.InventoryTaskTTL,
+	})
+	// background loops run until the provider has drained, then stop so that invocation
+	// counts are saved once more
+	ctx, stop := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	runBackground := func(run func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(ctx)
+		}()
+	}
+
+	runBackground(inventory.Run)
+
+	funcProxyHandler := handlers.NewFunctionLookup(inventory, cfg.DNSRoundRobin).
+		WithBalancer(handlers.NewBalancer(inventory, dockerClient, settings, cfg.LoadBalancer)).
+		WithPort(cfg.WatchdogPort)
+	invocations := handlers.NewInvocationTracker()
+	serviceQuery := handlers.NewSwarmServiceQuery(dockerClient, settings.MaxReplicas)
+
+	functionProxy := proxy.NewHandlerFunc(cfg.FaaSConfig, metrics.InstrumentResolver(funcProxyHandler, metricsOptions))
+	functionProxy = funcProxyHandler.DecorateProxy(functionProxy)
+	if cfg.EnableScaleFromZero {
+		log.Printf("Scale from zero timeout: %s\n", cfg.ScaleFromZeroTimeout)
+		// tasks are polled from Docker rather than the inventory, so a running task is seen
+		// as soon as it starts
+		functionProxy = handlers.NewZeroScaler(dockerClient, serviceQuery, cfg.ScaleFromZeroTimeout).DecorateProxy(functionProxy)
+	}
+	functionProxy = invocations.DecorateProxy(metrics.InstrumentProxy(functionProxy, metricsOptions, funcProxyHandler.Exists), funcProxyHandler.Exists)
+	runBackground(func(ctx context.Context) {
+		handlers.PruneInvocations(ctx, invocations, inventory, cfg.InventoryResyncInterval)
+	})
+
+	switch cfg.InvocationStore {
+	case "file":
+		log.Printf("Persisting invocation counts to file: %s\n", cfg.InvocationStorePath)
+		store := handlers.FileInvocationStore{Path: cfg.InvocationStorePath}
+		runBackground(func(ctx context.Context) {
+			handlers.PersistInvocations(ctx, invocations, store, cfg.InvocationStoreInterval)
+		})
+	case "config":
+		log.Printf("Persisting invocation counts to Swarm config: %s\n", cfg.InvocationStoreConfigName)
+		store := handlers.SwarmConfigInvocationStore{Client: dockerClient, Name: cfg.InvocationStoreConfigName, Settings: settings}
+		runBackground(func(ctx context.Context) {
+			handlers.PersistInvocations(ctx, invocations, store, cfg.InvocationStoreInterval)
+		})
+	}
+
+	if cfg.EnableScaleToZero {
+		idler := handlers.NewIdler(inventory, serviceQuery, invocations, handlers.IdlerConfig{
+			InactivityDuration: cfg.InactivityDuration,
+			ReconcileInterval:  cfg.IdlerReconcileInterval,
+			DryRun:             cfg.ScaleToZeroDryRun,
+		})
+
+		runBackground(idler.Run)
+	}
+
+	if cfg.EnableAutoscaler {
+		autoscaler := handlers.NewAutoscaler(inventory, serviceQuery, invocations, handlers.AutoscalerConfig{
+			Interval:               cfg.AutoscalerInterval,
+			ScaleUpCooldown:        cfg.ScaleUpCooldown,
+			ScaleDownStabilisation: cfg.ScaleDownStabilisation,
+			MaxReplicas:            settings.MaxReplicas,
+		})
+
+		runBackground(autoscaler.Run)
+	}
+
+	restartPolicy := handlers.RestartPolicyDefaults{
+		Condition:   cfg.RestartCondition,
+		MaxAttempts: cfg.MaxRestarts,
+		Delay:       cfg.RestartDelay,
+		Window:      cfg.RestartWindow,
+	}
+
+	log.Printf("Restart policy: %s, max restarts: %d, delay: %s, window: %s\n",
+		restartPolicy.Condition, restartPolicy.MaxAttempts, restartPolicy.Delay, restartPolicy.Window)
+
+	var revisions *handlers.RevisionHistory
+	if cfg.RevisionHistoryLimit > 0 {
+		log.Printf("Revision history limit: %d\n", cfg.RevisionHistoryLimit)
+		revisions = handlers.NewRevisionHistory(dockerClient, settings, cfg.RevisionHistoryLimit)
+	}
+
+	drainer := &handlers.Drainer{}
 
 	bootstrapHandlers := bootTypes.FaaSHandlers{
-		DeleteHandler:        handlers.DeleteHandler(dockerClient),
-		DeployHandler:        handlers.DeployHandler(dockerClient, maxRestarts, restartDelay),
-		FunctionReader:       handlers.FunctionReader(true, dockerClient),
-		FunctionProxy:        proxy.NewHandlerFunc(cfg.FaaSConfig, funcProxyHandler),
-		ReplicaReader:        handlers.ReplicaReader(dockerClient),
-		ReplicaUpdater:       handlers.ReplicaUpdater(dockerClient),
-		UpdateHandler:        handlers.UpdateHandler(dockerClient, maxRestarts, restartDelay),
-		HealthHandler:        handlers.Health(),
-		InfoHandler:          handlers.MakeInfoHandler(version.BuildVersion(), version.GitCommit),
-		SecretHandler:        handlers.MakeSecretsHandler(dockerClient),
+		DeleteHandler:        handlers.DeleteHandler(inventory),
+		DeployHandler:        handlers.DeployHandler(dockerClient, settings, restartPolicy, revisions),
+		FunctionReader:       handlers.FunctionReader(true, inventory, invocations),
+		FunctionProxy:        functionProxy,
+		ReplicaReader:        handlers.ReplicaReader(inventory, invocations),
+		ReplicaUpdater:       handlers.ReplicaUpdater(dockerClient, settings),
+		UpdateHandler:        handlers.UpdateHandler(dockerClient, settings, restartPolicy, revisions),
+		HealthHandler:        handlers.Health(drainer),
+		InfoHandler:          handlers.MakeInfoHandler(version.BuildVersion(), version.GitCommit, effectiveConfig),
+		SecretHandler:        handlers.MakeSecretsHandler(inventory, settings),
 		LogHandler:           logs.NewLogHandlerFunc(handlers.NewLogRequester(dockerClient), cfg.FaaSConfig.WriteTimeout),
-		ListNamespaceHandler: handlers.NamespaceLister(),
+		ListNamespaceHandler: handlers.NamespaceLister(dockerClient),
 	}
 
 	bootstrapConfig := bootTypes.FaaSConfig{
@@ -77,5 +195,195 @@ func main() {
 
 	log.Printf("Basic authentication: %v\n", bootstrapConfig.EnableBasicAuth)
 
-	bootstrap.Serve(&bootstrapHandlers, &bootstrapConfig)
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		log.Fatalf("Error configuring authentication: %s", err)
+	}
+
+	policy, err := readPolicy(cfg, dockerClient)
+	if err != nil {
+		log.Fatalf("Error reading RBAC policy: %s", err)
+	}
+
+	if policy != nil && len(authenticator) == 0 {
+		log.Fatalf("Error reading RBAC policy: authentication must be enabled to authorise callers")
+	}
+
+	// the system routes, including those registered by serve, share the same authentication
+	// and, when a policy is set, are authorised per route
+	systemHandler := func(next http.HandlerFunc, rule authorization.Rule) http.HandlerFunc {
+		if policy != nil {
+			next = authorization.Require(next, policy, rule)
+		}
+
+		if len(authenticator) > 0 {
+			next = authentication.Decorate(next, authenticator)
+		}
+
+		return next
+	}
+
+	bootstrap.Router().Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	bootstrap.Router().HandleFunc("/system/function/{name:["+bootstrap.NameExpression+"]+}/rollback",
+		systemHandler(handlers.RollbackHandler(dockerClient, revisions), authorization.Rule{
+			Actions: map[string]authorization.Action{
+				http.MethodGet:  authorization.ReadFunctions,
+				http.MethodPost: authorization.DeployFunctions,
+			},
+		})).Methods(http.MethodGet, http.MethodPost)
+
+	bootstrap.Router().HandleFunc("/system/function/{name:["+bootstrap.NameExpression+"]+}/status",
+		systemHandler(handlers.StatusHandler(dockerClient), allow(authorization.ReadFunctions, http.MethodGet))).Methods(http.MethodGet)
+
+	if revisions != nil {
+		bootstrap.Router().HandleFunc("/system/function/{name:["+bootstrap.NameExpression+"]+}/revisions",
+			systemHandler(handlers.RevisionsHandler(revisions), allow(authorization.ReadFunctions, http.MethodGet))).Methods(http.MethodGet)
+		bootstrap.Router().HandleFunc("/system/function/{name:["+bootstrap.NameExpression+"]+}/revisions/{revision:[0-9]+}/rollback",
+			systemHandler(handlers.RevisionRollbackHandler(dockerClient, revisions, settings, restartPolicy),
+				allow(authorization.DeployFunctions, http.MethodPost))).Methods(http.MethodPost)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	serveCtx, cancelServe := context.WithCancel(context.Background())
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, shutting down\n", sig)
+		cancelServe()
+	}()
+
+	log.Printf("Shutdown drain delay: %s, grace period: %s\n", cfg.ShutdownDrainDelay, cfg.ShutdownGracePeriod)
+	srv := server{
+		handlers:      &bootstrapHandlers,
+		config:        &bootstrapConfig,
+		readiness:     handlers.ReadinessHandler(handlers.NewReadinessChecker(dockerClient, settings, cfg.ReadinessCacheTTL), drainer),
+		systemHandler: systemHandler,
+		drainer:       drainer,
+		drainDelay:    cfg.ShutdownDrainDelay,
+		grace:         cfg.ShutdownGracePeriod,
+	}
+
+	if len(cfg.TLSCertFile) > 0 {
+		clientAuth := tls.RequireAndVerifyClientCert
+		if cfg.TLSClientAuth == "optional" {
+			clientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		reloader, err := certificates.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, clientAuth)
+		if err != nil {
+			log.Fatalf("Error reading TLS certificates: %s", err)
+		}
+
+		log.Printf("TLS: enabled, client certificates: %v, reload interval: %s\n",
+			len(cfg.TLSClientCAFile) > 0, cfg.TLSReloadInterval)
+
+		srv.tlsConfig = reloader.TLSConfig()
+		runBackground(func(ctx context.Context) {
+			reloader.Run(ctx, cfg.TLSReloadInterval)
+		})
+	}
+
+	if err := srv.serve(serveCtx); err != nil {
+		log.Fatal(err)
+	}
+
+	stop()
+	background.Wait()
+	log.Printf("Shutdown complete\n")
+}
+
+// newAuthenticator returns the authenticators enabled in the config, an empty chain leaves
+// the system routes open
+func newAuthenticator(cfg types.SwarmConfig) (authentication.Chain, error) {
+	chain := authentication.Chain{}
+
+	if cfg.FaaSConfig.EnableBasicAuth {
+		reader := auth.ReadBasicAuthFromDisk{
+			SecretMountPath: cfg.FaaSConfig.SecretMountPath,
+		}
+
+		credentials, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, authentication.BasicAuth{Credentials: credentials})
+	}
+
+	if len(cfg.BearerTokenFiles) > 0 {
+		tokens, err := authentication.ReadBearerTokens(cfg.BearerTokenFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("Bearer tokens: %d\n", len(cfg.BearerTokenFiles))
+		chain = append(chain, tokens)
+	}
+
+	if len(cfg.JWKSFile) > 0 {
+		jwt, err := authentication.ReadJWKS(cfg.JWKSFile, cfg.JWTIssuer, cfg.JWTAudience)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("JWT authentication: %s, issuer: %q, audience: %q\n", cfg.JWKSFile, cfg.JWTIssuer, cfg.JWTAudience)
+		chain = append(chain, jwt)
+	}
+
+	// last, so that credentials sent with a client certificate identify the caller, and so
+	// that callers without a certificate are rejected when tls_client_auth=optional
+	if len(cfg.TLSClientCAFile) > 0 {
+		chain = append(chain, authentication.ClientCertificate{})
+	}
+
+	return chain, nil
+}
+
+// readPolicy reads the RBAC policy from a file or Swarm config, or returns nil when neither
+// is configured
+func readPolicy(cfg types.SwarmConfig, c authorization.ConfigReader) (*authorization.Policy, error) {
+	var policy *authorization.Policy
+	var err error
+
+	switch {
+	case len(cfg.RBACPolicyFile) > 0:
+		policy, err = authorization.ReadPolicyFile(cfg.RBACPolicyFile)
+	case len(cfg.RBACPolicyConfig) > 0:
+		policy, err = authorization.ReadPolicyConfig(c, cfg.RBACPolicyConfig)
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("RBAC policy: %s\n", policy.Summary())
+	return policy, nil
+}
+
+// newDockerClient creates a Docker client from the environment, with its transport
+// instrumented so that every Docker API call is recorded in the metrics.
+func newDockerClient(metricsOptions metrics.MetricOptions) (*client.Client, error) {
+	envClient, err := client.NewEnvClient()
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := *envClient.HTTPClient()
+
+	scheme := "http"
+	if transport, ok := httpClient.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		scheme = "https"
+	}
+
+	httpClient.Transport = metrics.InstrumentDockerTransport(httpClient.Transport, metricsOptions)
+
+	return client.NewClientWithOpts(
+		client.WithHost(envClient.DaemonHost()),
+		client.WithVersion(envClient.ClientVersion()),
+		client.WithScheme(scheme),
+		client.WithHTTPClient(&httpClient),
+	)
 }
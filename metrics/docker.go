@@ -0,0 +1,84 @@
+// Copyright (c) OpenFaaS Author(s) 2020. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// apiVersionPrefix matches the version prefix of Docker API paths, i.e. /v1.40
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9]+\.[0-9]+`)
+
+// dockerActions are path segments which name an action rather than an object ID
+var dockerActions = map[string]bool{
+	"create": true,
+	"prune":  true,
+}
+
+// InstrumentDockerTransport wraps the transport of the Docker client so that every call made
+// to the Docker API is counted and timed by operation, i.e. "POST /services/{id}/update".
+func InstrumentDockerTransport(next http.RoundTripper, m MetricOptions) http.RoundTripper {
+	return &dockerTransport{next: next, metrics: m}
+}
+
+type dockerTransport struct {
+	next    http.RoundTripper
+	metrics MetricOptions
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *dockerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	operation := dockerOperation(r)
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(r)
+
+	t.metrics.DockerRequests.WithLabelValues(operation).Inc()
+	t.metrics.DockerRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
+	if class := dockerErrorClass(res, err); len(class) > 0 {
+		t.metrics.DockerRequestErrors.WithLabelValues(operation, class).Inc()
+	}
+
+	return res, err
+}
+
+// dockerOperation returns the method and path of a Docker API request with the API version
+// removed and object IDs replaced, so that the label has a bounded number of values.
+func dockerOperation(r *http.Request) string {
+	path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(parts) > 1 && !dockerActions[parts[1]] {
+		parts[1] = "{id}"
+	}
+
+	return r.Method + " /" + strings.Join(parts, "/")
+}
+
+// dockerErrorClass classifies a failed Docker API request, an empty string is returned
+// for successful requests.
+func dockerErrorClass(res *http.Response, err error) string {
+	if err != nil {
+		return "unavailable"
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return "not_found"
+	case res.StatusCode == http.StatusConflict:
+		return "conflict"
+	case res.StatusCode == http.StatusServiceUnavailable:
+		return "unavailable"
+	case res.StatusCode >= 500:
+		return "server_error"
+	case res.StatusCode >= 400:
+		return "invalid_request"
+	}
+
+	return ""
+}
@@ -0,0 +1,88 @@
+// Copyright (c) OpenFaaS Author(s) 2020. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+// Package metrics provides the Prometheus metrics exposed by faas-swarm on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "faas_swarm"
+
+// MetricOptions holds the collectors updated by the function proxy, the resolver
+// and the Docker client
+type MetricOptions struct {
+	// FunctionInvocation counts invocations through the function proxy by function and status code
+	FunctionInvocation *prometheus.CounterVec
+	// FunctionInvocationDuration observes the latency of invocations through the function proxy
+	FunctionInvocationDuration *prometheus.HistogramVec
+
+	// DockerRequests counts requests made to the Docker API by operation
+	DockerRequests *prometheus.CounterVec
+	// DockerRequestErrors counts failed Docker API requests by operation and error class
+	DockerRequestErrors *prometheus.CounterVec
+	// DockerRequestDuration observes the latency of Docker API requests
+	DockerRequestDuration *prometheus.HistogramVec
+
+	// ResolverLookups counts function lookups made by the proxy by result, "hit" or "miss"
+	ResolverLookups *prometheus.CounterVec
+}
+
+// BuildMetricsOptions builds the collectors, they must be registered before they are exposed
+func BuildMetricsOptions() MetricOptions {
+	return MetricOptions{
+		FunctionInvocation: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "function_invocation_total",
+			Help:      "Function invocations through the provider proxy",
+		}, []string{"function_name", "code"}),
+		FunctionInvocationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "function_invocation_duration_seconds",
+			Help:      "Function invocation latency through the provider proxy",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"function_name", "code"}),
+		DockerRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "docker_requests_total",
+			Help:      "Requests made to the Docker API",
+		}, []string{"operation"}),
+		DockerRequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "docker_request_errors_total",
+			Help:      "Failed requests made to the Docker API",
+		}, []string{"operation", "class"}),
+		DockerRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "docker_request_duration_seconds",
+			Help:      "Docker API request latency",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		ResolverLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "resolver_lookups_total",
+			Help:      "Function lookups made by the provider proxy",
+		}, []string{"result"}),
+	}
+}
+
+// Register registers all the collectors with the registerer
+func (m MetricOptions) Register(registerer prometheus.Registerer) {
+	registerer.MustRegister(
+		m.FunctionInvocation,
+		m.FunctionInvocationDuration,
+		m.DockerRequests,
+		m.DockerRequestErrors,
+		m.DockerRequestDuration,
+		m.ResolverLookups,
+	)
+}
+
+// Handler exposes the metrics of the default Prometheus registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,122 @@
+// Copyright (c) OpenFaaS Author(s) 2020. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_DockerOperation(t *testing.T) {
+	scenarios := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/v1.40/services", "GET /services"},
+		{http.MethodGet, "/v1.40/services/abc123", "GET /services/{id}"},
+		{http.MethodPost, "/v1.40/services/abc123/update", "POST /services/{id}/update"},
+		{http.MethodPost, "/v1.40/services/create", "POST /services/create"},
+		{http.MethodGet, "/_ping", "GET /_ping"},
+	}
+
+	for _, s := range scenarios {
+		r := httptest.NewRequest(s.method, "http://docker"+s.path, nil)
+		if got := dockerOperation(r); got != s.want {
+			t.Errorf("dockerOperation(%s %s) want: %q, got: %q", s.method, s.path, s.want, got)
+		}
+	}
+}
+
+type fakeRoundTripper struct {
+	status int
+	err    error
+}
+
+func (f fakeRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return &http.Response{StatusCode: f.status, Body: http.NoBody}, nil
+}
+
+func Test_InstrumentDockerTransport(t *testing.T) {
+	m := BuildMetricsOptions()
+
+	ok := InstrumentDockerTransport(fakeRoundTripper{status: http.StatusOK}, m)
+	notFound := InstrumentDockerTransport(fakeRoundTripper{status: http.StatusNotFound}, m)
+	unavailable := InstrumentDockerTransport(fakeRoundTripper{err: errors.New("connection refused")}, m)
+
+	r := httptest.NewRequest(http.MethodGet, "http://docker/v1.40/services/abc", nil)
+	ok.RoundTrip(r)
+	notFound.RoundTrip(r)
+	unavailable.RoundTrip(r)
+
+	if got := testutil.ToFloat64(m.DockerRequests.WithLabelValues("GET /services/{id}")); got != 3 {
+		t.Errorf("want requests: 3, got: %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.DockerRequestErrors.WithLabelValues("GET /services/{id}", "not_found")); got != 1 {
+		t.Errorf("want not_found errors: 1, got: %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.DockerRequestErrors.WithLabelValues("GET /services/{id}", "unavailable")); got != 1 {
+		t.Errorf("want unavailable errors: 1, got: %v", got)
+	}
+}
+
+func Test_InstrumentProxy(t *testing.T) {
+	m := BuildMetricsOptions()
+
+	exists := func(ctx context.Context, name string) bool { return name == "echo" }
+
+	handler := InstrumentProxy(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}, m, exists)
+
+	for _, name := range []string{"echo", "missing-1", "missing-2"} {
+		r := httptest.NewRequest(http.MethodPost, "/function/"+name, nil)
+		r = mux.SetURLVars(r, map[string]string{"name": name})
+		handler(httptest.NewRecorder(), r)
+	}
+
+	if got := testutil.ToFloat64(m.FunctionInvocation.WithLabelValues("echo", "502")); got != 1 {
+		t.Errorf("want invocations: 1, got: %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.FunctionInvocation.WithLabelValues(unknownFunction, "502")); got != 2 {
+		t.Errorf("want invocations of unknown functions: 2, got: %v", got)
+	}
+}
+
+type fakeResolver struct {
+	err error
+}
+
+func (f fakeResolver) Resolve(name string) (url.URL, error) {
+	return url.URL{Host: name}, f.err
+}
+
+func Test_InstrumentResolver(t *testing.T) {
+	m := BuildMetricsOptions()
+
+	InstrumentResolver(fakeResolver{}, m).Resolve("echo")
+	InstrumentResolver(fakeResolver{err: errors.New("could not resolve")}, m).Resolve("echo")
+
+	if got := testutil.ToFloat64(m.ResolverLookups.WithLabelValues("hit")); got != 1 {
+		t.Errorf("want hits: 1, got: %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.ResolverLookups.WithLabelValues("miss")); got != 1 {
+		t.Errorf("want misses: 1, got: %v", got)
+	}
+}
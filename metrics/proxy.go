@@ -0,0 +1,95 @@
+// Copyright (c) OpenFaaS Author(s) 2020. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/proxy"
+)
+
+// unknownFunction labels the invocations of functions which are not deployed, so that
+// requests for arbitrary names do not each create a time series
+const unknownFunction = "unknown"
+
+// InstrumentProxy records the count and latency of each function invocation made through
+// the function proxy, labelled by function name and response status code. Functions for
+// which exists returns false are labelled "unknown".
+func InstrumentProxy(next http.HandlerFunc, m MetricOptions, exists func(ctx context.Context, name string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if len(name) == 0 {
+			next(w, r)
+			return
+		}
+
+		if !exists(r.Context(), name) {
+			name = unknownFunction
+		}
+
+		start := time.Now()
+		writer := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next(writer, r)
+
+		code := strconv.Itoa(writer.status)
+		m.FunctionInvocation.WithLabelValues(name, code).Inc()
+		m.FunctionInvocationDuration.WithLabelValues(name, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// statusWriter records the status code written by the wrapped handler
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the wrapped writer so that streamed responses are not buffered
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// InstrumentResolver counts the hits and misses of the function lookups made by the proxy
+func InstrumentResolver(resolver proxy.BaseURLResolver, m MetricOptions) proxy.BaseURLResolver {
+	return &instrumentedResolver{resolver: resolver, metrics: m}
+}
+
+type instrumentedResolver struct {
+	resolver proxy.BaseURLResolver
+	metrics  MetricOptions
+}
+
+// Resolve implements proxy.BaseURLResolver
+func (r *instrumentedResolver) Resolve(functionName string) (url.URL, error) {
+	u, err := r.resolver.Resolve(functionName)
+	if err != nil {
+		r.metrics.ResolverLookups.WithLabelValues("miss").Inc()
+		return u, err
+	}
+
+	r.metrics.ResolverLookups.WithLabelValues("hit").Inc()
+	return u, nil
+}
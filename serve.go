@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	bootstrap "github.com/openfaas/faas-provider"
+	bootTypes "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas-swarm/authorization"
+	"github.com/openfaas/faas-swarm/handlers"
+)
+
+// allow returns the authorization rule of a route whose methods each perform action
+func allow(action authorization.Action, methods ...string) authorization.Rule {
+	rule := authorization.Rule{Actions: map[string]authorization.Action{}}
+	for _, method := range methods {
+		rule.Actions[method] = action
+	}
+
+	return rule
+}
+
+// allowWithBody is allow for routes whose handler reads the namespace from the JSON body
+func allowWithBody(action authorization.Action, methods ...string) authorization.Rule {
+	rule := allow(action, methods...)
+	rule.BodyNamespace = true
+
+	return rule
+}
+
+// server holds the handlers and settings of the provider's HTTP server
+type server struct {
+	handlers *bootTypes.FaaSHandlers
+	config   *bootTypes.FaaSConfig
+	// readiness serves /readyz
+	readiness http.HandlerFunc
+	// systemHandler decorates the system routes with authentication and authorisation
+	systemHandler func(http.HandlerFunc, authorization.Rule) http.HandlerFunc
+	drainer       *handlers.Drainer
+	// drainDelay is how long the health checks fail before connections are refused
+	drainDelay time.Duration
+	// grace is how long in-flight requests are given to complete when draining
+	grace time.Duration
+	// tlsConfig serves HTTPS rather than HTTP when it is set
+	tlsConfig *tls.Config
+}
+
+// serve registers the standard provider routes, as bootstrap.Serve does, and /readyz, then
+// serves them until ctx is cancelled. The provider is then drained: /healthz and /readyz
+// fail for the drain delay while requests are still served, then new connections are
+// refused and in-flight requests, including proxied invocations and log streams, are given
+// the grace period to complete before they are cancelled.
+func (srv server) serve(ctx context.Context) error {
+	faasHandlers, config, systemHandler := srv.handlers, srv.config, srv.systemHandler
+
+	r := bootstrap.Router()
+	name := "{name:[" + bootstrap.NameExpression + "]+}"
+
+	r.HandleFunc("/system/functions", systemHandler(faasHandlers.FunctionReader,
+		allow(authorization.ReadFunctions, http.MethodGet))).Methods(http.MethodGet)
+	r.HandleFunc("/system/functions", systemHandler(faasHandlers.DeployHandler,
+		allowWithBody(authorization.DeployFunctions, http.MethodPost))).Methods(http.MethodPost)
+	r.HandleFunc("/system/functions", systemHandler(faasHandlers.DeleteHandler,
+		allow(authorization.DeleteFunctions, http.MethodDelete))).Methods(http.MethodDelete)
+	r.HandleFunc("/system/functions", systemHandler(faasHandlers.UpdateHandler,
+		allowWithBody(authorization.DeployFunctions, http.MethodPut))).Methods(http.MethodPut)
+
+	r.HandleFunc("/system/function/"+name, systemHandler(faasHandlers.ReplicaReader,
+		allow(authorization.ReadFunctions, http.MethodGet))).Methods(http.MethodGet)
+	r.HandleFunc("/system/scale-function/"+name, systemHandler(faasHandlers.ReplicaUpdater,
+		allow(authorization.ScaleFunctions, http.MethodPost))).Methods(http.MethodPost)
+	r.HandleFunc("/system/info", systemHandler(faasHandlers.InfoHandler,
+		allow(authorization.ReadInfo, http.MethodGet))).Methods(http.MethodGet)
+
+	r.HandleFunc("/system/secrets", systemHandler(faasHandlers.SecretHandler, authorization.Rule{
+		Actions: map[string]authorization.Action{
+			http.MethodGet:    authorization.ReadSecrets,
+			http.MethodPost:   authorization.WriteSecrets,
+			http.MethodPut:    authorization.WriteSecrets,
+			http.MethodDelete: authorization.DeleteSecrets,
+		},
+		BodyNamespace: true,
+	})).Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
+	r.HandleFunc("/system/logs", systemHandler(faasHandlers.LogHandler,
+		allow(authorization.ReadLogs, http.MethodGet))).Methods(http.MethodGet)
+
+	r.HandleFunc("/system/namespaces", systemHandler(faasHandlers.ListNamespaceHandler,
+		allow(authorization.ReadNamespaces, http.MethodGet))).Methods(http.MethodGet)
+
+	r.HandleFunc("/function/"+name, faasHandlers.FunctionProxy)
+	r.HandleFunc("/function/"+name+"/", faasHandlers.FunctionProxy)
+	r.HandleFunc("/function/"+name+"/{params:.*}", faasHandlers.FunctionProxy)
+
+	r.HandleFunc("/healthz", faasHandlers.HealthHandler).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", srv.readiness).Methods(http.MethodGet)
+
+	tcpPort := 8080
+	if config.TCPPort != nil {
+		tcpPort = *config.TCPPort
+	}
+
+	// requests are served with a context which outlives ctx, so that they can complete
+	// while draining, and which is cancelled once the grace period has passed
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	s := &http.Server{
+		Addr:           fmt.Sprintf(":%d", tcpPort),
+		ReadTimeout:    config.ReadTimeout,
+		WriteTimeout:   config.WriteTimeout,
+		MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+		Handler:        r,
+		BaseContext:    func(net.Listener) context.Context { return requestCtx },
+		TLSConfig:      srv.tlsConfig,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		if srv.tlsConfig != nil {
+			// the certificate is served from TLSConfig, so that it can be reloaded
+			errs <- s.ListenAndServeTLS("", "")
+			return
+		}
+
+		errs <- s.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Draining, delay: %s, grace period: %s\n", srv.drainDelay, srv.grace)
+	srv.drainer.Drain()
+
+	// the failing health checks must be seen before connections are refused, or traffic
+	// is still routed to the provider
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(srv.drainDelay):
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), srv.grace)
+	defer cancel()
+
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Grace period passed, cancelling in-flight requests: %s\n", err)
+		cancelRequests()
+		s.Close()
+		return nil
+	}
+
+	log.Printf("Drained all in-flight requests\n")
+	return nil
+}
@@ -60,7 +60,7 @@ func TestReaderSuccessReturnsOK(t *testing.T) {
 		serviceListServices: []swarm.Service{},
 		serviceListError:    nil,
 	}
-	handler := handlers.FunctionReader(true, c)
+	handler := handlers.FunctionReader(true, c, nil)
 
 	w := httptest.NewRecorder()
 	r := &http.Request{}
@@ -78,7 +78,7 @@ func TestReaderSuccessReturnsJsonContent(t *testing.T) {
 		serviceListServices: []swarm.Service{},
 		serviceListError:    nil,
 	}
-	handler := handlers.FunctionReader(true, c)
+	handler := handlers.FunctionReader(true, c, nil)
 
 	w := httptest.NewRecorder()
 	r := &http.Request{}
@@ -96,7 +96,7 @@ func TestReaderSuccessReturnsCorrectBodyWithZeroFunctions(t *testing.T) {
 		serviceListServices: []swarm.Service{},
 		serviceListError:    nil,
 	}
-	handler := handlers.FunctionReader(true, c)
+	handler := handlers.FunctionReader(true, c, nil)
 
 	w := httptest.NewRecorder()
 	r := &http.Request{}
@@ -143,7 +143,7 @@ func TestReaderSuccessReturnsCorrectBodyWithOneFunction(t *testing.T) {
 		serviceListServices: services,
 		serviceListError:    nil,
 	}
-	handler := handlers.FunctionReader(true, c)
+	handler := handlers.FunctionReader(true, c, nil)
 
 	w := httptest.NewRecorder()
 	r := &http.Request{}
@@ -159,6 +159,7 @@ func TestReaderSuccessReturnsCorrectBodyWithOneFunction(t *testing.T) {
 			Labels: &map[string]string{
 				"function": "bar",
 			},
+			Namespace: handlers.DefaultNamespace,
 		},
 	}
 
@@ -176,7 +177,7 @@ func TestReaderErrorReturnsInternalServerError(t *testing.T) {
 		serviceListServices: nil,
 		serviceListError:    errors.New("error"),
 	}
-	handler := handlers.FunctionReader(true, c)
+	handler := handlers.FunctionReader(true, c, nil)
 
 	w := httptest.NewRecorder()
 	r := &http.Request{}
@@ -195,15 +196,68 @@ func TestReaderErrorReturnsCorrectBody(t *testing.T) {
 		serviceListServices: nil,
 		serviceListError:    fmt.Errorf("unable to fetch list"),
 	}
-	handler := handlers.FunctionReader(true, c)
+	handler := handlers.FunctionReader(true, c, nil)
 
 	w := httptest.NewRecorder()
 	r := &http.Request{}
 	handler.ServeHTTP(w, r)
 
-	expected := "error getting service list: unable to fetch list"
+	expected := `{"code":"internal_error","message":"error getting service list: unable to fetch list"}`
 	if w.Body.String() != expected {
 		t.Errorf("handler returned wrong body, got: '%v' want: '%v'",
 			w.Body.String(), expected)
 	}
 }
+
+type testInvocationCounter map[string]uint64
+
+func (c testInvocationCounter) Count(service string) uint64 {
+	return c[service]
+}
+
+func TestReaderReturnsInvocationCount(t *testing.T) {
+	replicas := uint64(1)
+	labels := map[string]string{
+		"function": "true",
+	}
+
+	services := []swarm.Service{
+		{
+			Spec: swarm.ServiceSpec{
+				Mode: swarm.ServiceMode{
+					Replicated: &swarm.ReplicatedService{
+						Replicas: &replicas,
+					},
+				},
+				Annotations: swarm.Annotations{
+					Name:   "bar",
+					Labels: labels,
+				},
+				TaskTemplate: swarm.TaskSpec{
+					ContainerSpec: &swarm.ContainerSpec{
+						Image:  "foo/bar:latest",
+						Labels: labels,
+					},
+				},
+			},
+		},
+	}
+	c := &testServiceApiClient{
+		serviceListServices: services,
+		serviceListError:    nil,
+	}
+	handler := handlers.FunctionReader(true, c, testInvocationCounter{"bar": 42})
+
+	w := httptest.NewRecorder()
+	r := &http.Request{}
+	handler.ServeHTTP(w, r)
+
+	functions := []typesv1.FunctionStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &functions); err != nil {
+		t.Fatalf("unexpected error unmarshalling the response: %s", err)
+	}
+
+	if len(functions) != 1 || functions[0].InvocationCount != 42 {
+		t.Errorf("want invocation count: 42, got: %v", functions)
+	}
+}
@@ -0,0 +1,87 @@
+package types
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	ftypes "github.com/openfaas/faas-provider/types"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fileEnv reads config values from the environment, falling back to the values of a
+// config file. The keys read are recorded, so that keys in the file which are not part
+// of the configuration are reported rather than ignored.
+type fileEnv struct {
+	env    ftypes.HasEnv
+	path   string
+	values map[string]string
+	read   map[string]bool
+}
+
+// Getenv returns the environment variable for key, or the config file value when it is
+// not set
+func (f *fileEnv) Getenv(key string) string {
+	f.read[key] = true
+
+	if value := f.env.Getenv(key); len(value) > 0 {
+		return value
+	}
+
+	return f.values[key]
+}
+
+// checkUnknown returns an error naming the keys of the config file which were never read
+func (f *fileEnv) checkUnknown() error {
+	unknown := []string{}
+	for key := range f.values {
+		if !f.read[key] {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown keys in config file %s: %s", f.path, strings.Join(unknown, ", "))
+}
+
+// readConfigFile reads a YAML config file of keys named after the environment variables,
+// i.e. "max_replicas: 50". Lists are read as comma separated values.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %s", err)
+	}
+
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %s", path, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			items := []string{}
+			for _, item := range v {
+				if _, ok := item.(map[interface{}]interface{}); ok {
+					return nil, fmt.Errorf("invalid value for %s in config file %s: use a list of values", key, path)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case map[interface{}]interface{}:
+			return nil, fmt.Errorf("invalid value for %s in config file %s: use a value or a list", key, path)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+
+	return values, nil
+}
@@ -3,6 +3,12 @@
 package types
 
 import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
 	ftypes "github.com/openfaas/faas-provider/types"
 )
 
@@ -10,21 +16,310 @@ import (
 type ReadConfig struct {
 }
 
-// Read fetches config from environmental variables.
+// Read fetches config from environmental variables, and from the YAML file named by
+// config_file when it is set. Environment variables take precedence over the file.
 func (ReadConfig) Read(hasEnv ftypes.HasEnv) (SwarmConfig, error) {
 	cfg := SwarmConfig{}
 
+	var file *fileEnv
+	if configFile := hasEnv.Getenv("config_file"); len(configFile) > 0 {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			return cfg, err
+		}
+
+		file = &fileEnv{env: hasEnv, path: configFile, values: values, read: map[string]bool{}}
+		hasEnv = file
+	}
+
 	faasCfg, err := ftypes.ReadConfig{}.Read(hasEnv)
 	if err != nil {
 		return cfg, err
 	}
 
 	cfg.DNSRoundRobin = ftypes.ParseBoolValue(hasEnv.Getenv("dnsrr"), false)
+	cfg.LoadBalancer = hasEnv.Getenv("load_balancer")
+	cfg.InventoryResyncInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("inventory_resync_interval"), time.Minute*5)
+	cfg.InventoryTaskTTL = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("inventory_task_ttl"), time.Second)
+
+	cfg.EnableScaleToZero = ftypes.ParseBoolValue(hasEnv.Getenv("scale_to_zero"), false)
+	cfg.ScaleToZeroDryRun = ftypes.ParseBoolValue(hasEnv.Getenv("scale_to_zero_dry_run"), false)
+	cfg.InactivityDuration = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("inactivity_duration"), time.Minute*15)
+	cfg.IdlerReconcileInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("idler_reconcile_interval"), time.Minute)
+
+	cfg.EnableScaleFromZero = ftypes.ParseBoolValue(hasEnv.Getenv("scale_from_zero"), false)
+	cfg.ScaleFromZeroTimeout = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("scale_from_zero_timeout"), time.Second*30)
+
+	cfg.EnableAutoscaler = ftypes.ParseBoolValue(hasEnv.Getenv("autoscaler"), false)
+	cfg.AutoscalerInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("autoscaler_interval"), time.Second*10)
+	cfg.ScaleUpCooldown = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("scale_up_cooldown"), time.Second*30)
+	cfg.ScaleDownStabilisation = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("scale_down_stabilisation"), time.Minute*5)
+	cfg.InvocationStore = hasEnv.Getenv("invocation_store")
+	cfg.InvocationStorePath = ftypes.ParseString(hasEnv.Getenv("invocation_store_path"), "/var/lib/faas-swarm/invocations.json")
+	cfg.InvocationStoreConfigName = ftypes.ParseString(hasEnv.Getenv("invocation_store_config"), "faas-swarm-invocations")
+	cfg.InvocationStoreInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("invocation_store_interval"), time.Minute)
+	cfg.RevisionHistoryLimit = ftypes.ParseIntValue(hasEnv.Getenv("revision_history_limit"), 10)
+
+	cfg.RestartCondition = ftypes.ParseString(hasEnv.Getenv("restart_condition"), "any")
+	maxRestarts, err := parseInt(hasEnv, "max_restarts", 5)
+	if err != nil {
+		return cfg, err
+	}
+	if maxRestarts < 0 {
+		return cfg, fmt.Errorf("invalid value for max_restarts: %d, use 0 for no limit", maxRestarts)
+	}
+	cfg.MaxRestarts = uint64(maxRestarts)
+	cfg.RestartDelay = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("restart_delay"), time.Second*5)
+	cfg.RestartWindow = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("restart_window"), 0)
+
+	cfg.ShutdownGracePeriod = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("shutdown_grace_period"), time.Second*10)
+	cfg.ShutdownDrainDelay = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("shutdown_drain_delay"), time.Second*5)
+	cfg.ReadinessCacheTTL = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("readiness_cache_ttl"), time.Second*5)
+
+	cfg.BearerTokenFiles = parseList(hasEnv.Getenv("auth_bearer_token_files"))
+	cfg.JWKSFile = hasEnv.Getenv("auth_jwks_file")
+	cfg.JWTIssuer = hasEnv.Getenv("auth_jwt_issuer")
+	cfg.JWTAudience = hasEnv.Getenv("auth_jwt_audience")
+
+	cfg.RBACPolicyFile = hasEnv.Getenv("rbac_policy_file")
+	cfg.RBACPolicyConfig = hasEnv.Getenv("rbac_policy_config")
+
+	cfg.TLSCertFile = hasEnv.Getenv("tls_cert_file")
+	cfg.TLSKeyFile = hasEnv.Getenv("tls_key_file")
+	cfg.TLSClientCAFile = hasEnv.Getenv("tls_client_ca_file")
+	cfg.TLSClientAuth = ftypes.ParseString(hasEnv.Getenv("tls_client_auth"), "require")
+	cfg.TLSReloadInterval = ftypes.ParseIntOrDurationValue(hasEnv.Getenv("tls_reload_interval"), time.Minute)
+
+	cfg.NetworkLabel = ftypes.ParseString(hasEnv.Getenv("network_label"), "openfaas=true")
+	cfg.DefaultConstraints = parseList(ftypes.ParseString(hasEnv.Getenv("default_constraints"), "node.platform.os == linux"))
+	cfg.FunctionSecretsPath = ftypes.ParseString(hasEnv.Getenv("function_secrets_path"), "/var/openfaas/secrets/")
+	cfg.OwnerLabel = ftypes.ParseString(hasEnv.Getenv("owner_label"), "com.openfaas.owner=openfaas")
+	if cfg.MaxReplicas, err = parseInt(hasEnv, "max_replicas", 20); err != nil {
+		return cfg, err
+	}
+	if cfg.WatchdogPort, err = parseInt(hasEnv, "watchdog_port", 8080); err != nil {
+		return cfg, err
+	}
+
+	if file != nil {
+		if err := file.checkUnknown(); err != nil {
+			return cfg, err
+		}
+	}
+
+	switch cfg.LoadBalancer {
+	case "", "round-robin", "least-connections", "p2c":
+	default:
+		return cfg, fmt.Errorf("invalid value for load_balancer: %s, use round-robin, least-connections or p2c", cfg.LoadBalancer)
+	}
+
+	switch cfg.InvocationStore {
+	case "", "file", "config":
+	default:
+		return cfg, fmt.Errorf("invalid value for invocation_store: %s, use file or config", cfg.InvocationStore)
+	}
+
+	switch cfg.RestartCondition {
+	case "any", "on-failure", "none":
+	default:
+		return cfg, fmt.Errorf("invalid value for restart_condition: %s, use any, on-failure or none", cfg.RestartCondition)
+	}
+
+	// each of these drives a ticker or a timeout, so must be positive
+	for _, interval := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"inventory_resync_interval", cfg.InventoryResyncInterval},
+		{"idler_reconcile_interval", cfg.IdlerReconcileInterval},
+		{"autoscaler_interval", cfg.AutoscalerInterval},
+		{"invocation_store_interval", cfg.InvocationStoreInterval},
+		{"scale_from_zero_timeout", cfg.ScaleFromZeroTimeout},
+		{"shutdown_grace_period", cfg.ShutdownGracePeriod},
+	} {
+		if interval.value <= 0 {
+			return cfg, fmt.Errorf("invalid value for %s: %s, must be greater than zero", interval.key, interval.value)
+		}
+	}
+
+	if cfg.RestartDelay < 0 {
+		return cfg, fmt.Errorf("invalid value for restart_delay: %s, use 0 to restart immediately", cfg.RestartDelay)
+	}
+
+	if cfg.RestartWindow < 0 {
+		return cfg, fmt.Errorf("invalid value for restart_window: %s, use 0 to count every restart", cfg.RestartWindow)
+	}
+
+	if cfg.ShutdownDrainDelay < 0 {
+		return cfg, fmt.Errorf("invalid value for shutdown_drain_delay: %s, use 0 to disable", cfg.ShutdownDrainDelay)
+	}
+
+	if cfg.RevisionHistoryLimit < 0 {
+		return cfg, fmt.Errorf("invalid value for revision_history_limit: %d, use 0 to disable", cfg.RevisionHistoryLimit)
+	}
+
+	if len(cfg.JWKSFile) == 0 && (len(cfg.JWTIssuer) > 0 || len(cfg.JWTAudience) > 0) {
+		return cfg, fmt.Errorf("invalid auth config: auth_jwt_issuer and auth_jwt_audience require auth_jwks_file")
+	}
+
+	if len(cfg.RBACPolicyFile) > 0 && len(cfg.RBACPolicyConfig) > 0 {
+		return cfg, fmt.Errorf("invalid RBAC config: set rbac_policy_file or rbac_policy_config, not both")
+	}
+
+	if (len(cfg.TLSCertFile) == 0) != (len(cfg.TLSKeyFile) == 0) {
+		return cfg, fmt.Errorf("invalid TLS config: set both tls_cert_file and tls_key_file")
+	}
+
+	if len(cfg.TLSCertFile) > 0 && cfg.TLSReloadInterval <= 0 {
+		return cfg, fmt.Errorf("invalid value for tls_reload_interval: %s", cfg.TLSReloadInterval)
+	}
+
+	if len(cfg.TLSClientCAFile) > 0 && len(cfg.TLSCertFile) == 0 {
+		return cfg, fmt.Errorf("invalid TLS config: tls_client_ca_file requires tls_cert_file and tls_key_file")
+	}
+
+	switch cfg.TLSClientAuth {
+	case "require", "optional":
+	default:
+		return cfg, fmt.Errorf("invalid value for tls_client_auth: %s, use require or optional", cfg.TLSClientAuth)
+	}
+
+	if key, value := splitLabel(cfg.NetworkLabel); len(key) == 0 || strings.ContainsAny(key+value, " ,") {
+		return cfg, fmt.Errorf("invalid value for network_label: %q, use key=value, i.e. openfaas=true", cfg.NetworkLabel)
+	}
+
+	for _, constraint := range cfg.DefaultConstraints {
+		if !strings.Contains(constraint, "==") && !strings.Contains(constraint, "!=") {
+			return cfg, fmt.Errorf("invalid value for default_constraints: %q, use i.e. node.platform.os == linux", constraint)
+		}
+	}
+
+	if !path.IsAbs(cfg.FunctionSecretsPath) {
+		return cfg, fmt.Errorf("invalid value for function_secrets_path: %q, use an absolute path", cfg.FunctionSecretsPath)
+	}
+
+	if key, value := splitLabel(cfg.OwnerLabel); len(key) == 0 || len(value) == 0 {
+		return cfg, fmt.Errorf("invalid value for owner_label: %q, use key=value, i.e. com.openfaas.owner=openfaas", cfg.OwnerLabel)
+	}
+
+	if cfg.MaxReplicas < 1 {
+		return cfg, fmt.Errorf("invalid value for max_replicas: %d, use 1 or more", cfg.MaxReplicas)
+	}
+
+	if cfg.WatchdogPort < 1 || cfg.WatchdogPort > 65535 {
+		return cfg, fmt.Errorf("invalid value for watchdog_port: %d", cfg.WatchdogPort)
+	}
+
 	cfg.FaaSConfig = *faasCfg
 
 	return cfg, nil
 }
 
+// Effective returns the configuration in effect, keyed by the name of the environment
+// variable or config file key which sets each value
+func (c SwarmConfig) Effective() map[string]string {
+	port := ""
+	if c.FaaSConfig.TCPPort != nil {
+		port = strconv.Itoa(*c.FaaSConfig.TCPPort)
+	}
+
+	return map[string]string{
+		"read_timeout":              c.FaaSConfig.GetReadTimeout().String(),
+		"write_timeout":             c.FaaSConfig.WriteTimeout.String(),
+		"port":                      port,
+		"basic_auth":                strconv.FormatBool(c.FaaSConfig.EnableBasicAuth),
+		"secret_mount_path":         c.FaaSConfig.SecretMountPath,
+		"max_idle_conns":            strconv.Itoa(c.FaaSConfig.MaxIdleConns),
+		"max_idle_conns_per_host":   strconv.Itoa(c.FaaSConfig.MaxIdleConnsPerHost),
+		"dnsrr":                     strconv.FormatBool(c.DNSRoundRobin),
+		"load_balancer":             c.LoadBalancer,
+		"inventory_resync_interval": c.InventoryResyncInterval.String(),
+		"inventory_task_ttl":        c.InventoryTaskTTL.String(),
+		"scale_to_zero":             strconv.FormatBool(c.EnableScaleToZero),
+		"scale_to_zero_dry_run":     strconv.FormatBool(c.ScaleToZeroDryRun),
+		"inactivity_duration":       c.InactivityDuration.String(),
+		"idler_reconcile_interval":  c.IdlerReconcileInterval.String(),
+		"scale_from_zero":           strconv.FormatBool(c.EnableScaleFromZero),
+		"scale_from_zero_timeout":   c.ScaleFromZeroTimeout.String(),
+		"autoscaler":                strconv.FormatBool(c.EnableAutoscaler),
+		"autoscaler_interval":       c.AutoscalerInterval.String(),
+		"scale_up_cooldown":         c.ScaleUpCooldown.String(),
+		"scale_down_stabilisation":  c.ScaleDownStabilisation.String(),
+		"invocation_store":          c.InvocationStore,
+		"invocation_store_path":     c.InvocationStorePath,
+		"invocation_store_config":   c.InvocationStoreConfigName,
+		"invocation_store_interval": c.InvocationStoreInterval.String(),
+		"revision_history_limit":    strconv.Itoa(c.RevisionHistoryLimit),
+		"restart_condition":         c.RestartCondition,
+		"max_restarts":              strconv.FormatUint(c.MaxRestarts, 10),
+		"restart_delay":             c.RestartDelay.String(),
+		"restart_window":            c.RestartWindow.String(),
+		"shutdown_grace_period":     c.ShutdownGracePeriod.String(),
+		"shutdown_drain_delay":      c.ShutdownDrainDelay.String(),
+		"readiness_cache_ttl":       c.ReadinessCacheTTL.String(),
+		"auth_bearer_token_files":   strings.Join(c.BearerTokenFiles, ","),
+		"auth_jwks_file":            c.JWKSFile,
+		"auth_jwt_issuer":           c.JWTIssuer,
+		"auth_jwt_audience":         c.JWTAudience,
+		"rbac_policy_file":          c.RBACPolicyFile,
+		"rbac_policy_config":        c.RBACPolicyConfig,
+		"tls_cert_file":             c.TLSCertFile,
+		"tls_key_file":              c.TLSKeyFile,
+		"tls_client_ca_file":        c.TLSClientCAFile,
+		"tls_client_auth":           c.TLSClientAuth,
+		"tls_reload_interval":       c.TLSReloadInterval.String(),
+		"network_label":             c.NetworkLabel,
+		"default_constraints":       strings.Join(c.DefaultConstraints, ","),
+		"function_secrets_path":     c.FunctionSecretsPath,
+		"owner_label":               c.OwnerLabel,
+		"max_replicas":              strconv.Itoa(c.MaxReplicas),
+		"watchdog_port":             strconv.Itoa(c.WatchdogPort),
+	}
+}
+
+// OwnerLabelPair returns the key and value of OwnerLabel
+func (c SwarmConfig) OwnerLabelPair() (string, string) {
+	return splitLabel(c.OwnerLabel)
+}
+
+// splitLabel splits a key=value label, the value is empty when there is no "="
+func splitLabel(label string) (string, string) {
+	parts := strings.SplitN(label, "=", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// parseInt reads a whole number, unlike ftypes.ParseIntValue an invalid value is an error
+// rather than replaced by the fallback
+func parseInt(hasEnv ftypes.HasEnv, key string, fallback int) (int, error) {
+	value := hasEnv.Getenv(key)
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %q, use a whole number", key, value)
+	}
+
+	return parsed, nil
+}
+
+// parseList splits a comma separated list, dropping empty items
+func parseList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
 // SwarmConfig contains the configuration for the process.
 type SwarmConfig struct {
 	// DNSRoundRobin controls how faas-swarm will lookup functions when proxying requests.
@@ -35,6 +330,108 @@ type SwarmConfig struct {
 	// 	DNSRoundRObin = false
 	// faas-swarm will attempt to resolve the function by name, validating using the Swarm API
 	DNSRoundRobin bool
+	// LoadBalancer is the default strategy used to balance requests across the running tasks
+	// of a function: round-robin, least-connections or p2c. When empty only functions with the
+	// com.openfaas.load-balancer label are balanced by the provider.
+	LoadBalancer string
+	// InventoryResyncInterval is how often the service inventory is re-read in full from
+	// Docker, between resyncs it is kept current from the Docker event stream
+	InventoryResyncInterval time.Duration
+	// InventoryTaskTTL is how long a task list is served from the service inventory
+	InventoryTaskTTL time.Duration
+	// EnableScaleToZero starts the idler, which scales functions labelled with
+	// com.openfaas.scale.zero=true to zero replicas when they have not been invoked
+	// for InactivityDuration
+	EnableScaleToZero bool
+	// ScaleToZeroDryRun logs the idler's decisions without scaling any functions
+	ScaleToZeroDryRun bool
+	// InactivityDuration is the default inactivity window before a function is scaled to
+	// zero, it can be overridden per function with com.openfaas.scale.zero-duration
+	InactivityDuration time.Duration
+	// IdlerReconcileInterval is how often the idler checks for inactive functions
+	IdlerReconcileInterval time.Duration
+	// EnableScaleFromZero makes the function proxy scale functions with no available
+	// replicas to their minimum replica count and hold the request until a task is running
+	EnableScaleFromZero bool
+	// ScaleFromZeroTimeout is the maximum time a request is held during scale from zero
+	ScaleFromZeroTimeout time.Duration
+	// EnableAutoscaler starts the autoscaler, which sets the replicas of functions labelled
+	// with com.openfaas.scale.target from the load measured at the function proxy
+	EnableAutoscaler bool
+	// AutoscalerInterval is how often the autoscaler samples load and reconciles replicas
+	AutoscalerInterval time.Duration
+	// ScaleUpCooldown is the minimum time after scaling a function before it is scaled up again
+	ScaleUpCooldown time.Duration
+	// ScaleDownStabilisation is the window of recommendations considered before scaling down
+	ScaleDownStabilisation time.Duration
+	// InvocationStore selects where invocation counts are persisted across restarts, either
+	// "file", "config" for a Swarm config object, or empty to keep them in memory only
+	InvocationStore string
+	// InvocationStorePath is the file used by the "file" invocation store
+	InvocationStorePath string
+	// InvocationStoreConfigName is the name prefix of the Swarm configs used by the "config"
+	// invocation store
+	InvocationStoreConfigName string
+	// InvocationStoreInterval is how often invocation counts are persisted
+	InvocationStoreInterval time.Duration
+	// RestartCondition is when the tasks of functions are restarted by default: any,
+	// on-failure or none
+	RestartCondition string
+	// MaxRestarts is the number of times a task is restarted by default, 0 for no limit
+	MaxRestarts uint64
+	// RestartDelay is the default time waited before a task is restarted
+	RestartDelay time.Duration
+	// RestartWindow is the default time over which restarts are counted, 0 for all restarts
+	RestartWindow time.Duration
+	// RevisionHistoryLimit is the number of revisions kept for each function in Swarm
+	// config objects, 0 disables the revision history
+	RevisionHistoryLimit int
+	// ShutdownGracePeriod is how long in-flight requests are given to complete after a
+	// SIGTERM or SIGINT, before they are cancelled
+	ShutdownGracePeriod time.Duration
+	// ShutdownDrainDelay is how long /healthz and /readyz fail before the provider stops
+	// accepting connections, so that Swarm and load balancers stop routing to it first
+	ShutdownDrainDelay time.Duration
+	// ReadinessCacheTTL is how long the result of a readiness check is served for
+	ReadinessCacheTTL time.Duration
+	// BearerTokenFiles each hold a bearer token accepted by the system endpoints, the caller
+	// is named after the file, i.e. a Swarm secret mounted in /run/secrets/
+	BearerTokenFiles []string
+	// JWKSFile holds the keys which sign the JWTs accepted by the system endpoints
+	JWKSFile string
+	// JWTIssuer and JWTAudience are required in the iss and aud claims of JWTs when set
+	JWTIssuer   string
+	JWTAudience string
+	// RBACPolicyFile is a YAML or JSON policy mapping callers to roles for the system endpoints
+	RBACPolicyFile string
+	// RBACPolicyConfig is the name of a Swarm config holding the RBAC policy
+	RBACPolicyConfig string
+	// TLSCertFile and TLSKeyFile serve the provider over HTTPS when set, i.e. from Swarm
+	// secrets mounted at /run/secrets/
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile is a bundle of CAs which sign the client certificates of callers,
+	// when set clients authenticate with a certificate (mTLS)
+	TLSClientCAFile string
+	// TLSClientAuth is "require" to reject callers without a client certificate, or
+	// "optional" to verify client certificates only when they are presented
+	TLSClientAuth string
+	// TLSReloadInterval is how often the TLS files are checked for rotated certificates
+	TLSReloadInterval time.Duration
+	// NetworkLabel is the label of the overlay network which functions in the default
+	// namespace are attached to, i.e. openfaas=true
+	NetworkLabel string
+	// DefaultConstraints are the placement constraints of functions which do not set any
+	DefaultConstraints []string
+	// FunctionSecretsPath is the directory secrets are mounted into inside function containers
+	FunctionSecretsPath string
+	// OwnerLabel is the key=value label which marks the secrets and configs managed by the
+	// provider, i.e. com.openfaas.owner=openfaas
+	OwnerLabel string
+	// MaxReplicas is the maximum replicas of functions which do not set com.openfaas.scale.max
+	MaxReplicas int
+	// WatchdogPort is the port the watchdog listens on inside function containers
+	WatchdogPort int
 	// FaasConfig contains the standard OpenFaaS provider configuration
 	FaaSConfig ftypes.FaaSConfig
 }
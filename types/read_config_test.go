@@ -0,0 +1,131 @@
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testEnv map[string]string
+
+func (e testEnv) Getenv(key string) string {
+	return e[key]
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "faas-swarm-config")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("unable to write config file: %s", err)
+	}
+
+	return path
+}
+
+func Test_Read_Defaults(t *testing.T) {
+	cfg, err := ReadConfig{}.Read(testEnv{})
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	if cfg.NetworkLabel != "openfaas=true" || cfg.FunctionSecretsPath != "/var/openfaas/secrets/" {
+		t.Errorf("want default network label and secrets path, got: %q, %q", cfg.NetworkLabel, cfg.FunctionSecretsPath)
+	}
+
+	if !reflect.DeepEqual(cfg.DefaultConstraints, []string{"node.platform.os == linux"}) {
+		t.Errorf("want linux only constraints, got: %v", cfg.DefaultConstraints)
+	}
+
+	if key, value := cfg.OwnerLabelPair(); key != "com.openfaas.owner" || value != "openfaas" {
+		t.Errorf("want owner label com.openfaas.owner=openfaas, got: %s=%s", key, value)
+	}
+
+	if cfg.MaxReplicas != 20 || cfg.WatchdogPort != 8080 {
+		t.Errorf("want 20 max replicas and watchdog port 8080, got: %d, %d", cfg.MaxReplicas, cfg.WatchdogPort)
+	}
+}
+
+func Test_Read_ConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+max_replicas: 50
+watchdog_port: 8081
+restart_delay: 10s
+dnsrr: true
+default_constraints:
+  - node.role == worker
+  - node.labels.zone != edge
+`)
+
+	cfg, err := ReadConfig{}.Read(testEnv{
+		"config_file":  path,
+		"max_replicas": "30",
+	})
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	if cfg.MaxReplicas != 30 {
+		t.Errorf("want max replicas from the environment: 30, got: %d", cfg.MaxReplicas)
+	}
+
+	if cfg.WatchdogPort != 8081 || cfg.RestartDelay != 10*time.Second || !cfg.DNSRoundRobin {
+		t.Errorf("want watchdog port, restart delay and dnsrr from the file, got: %d, %s, %v", cfg.WatchdogPort, cfg.RestartDelay, cfg.DNSRoundRobin)
+	}
+
+	want := []string{"node.role == worker", "node.labels.zone != edge"}
+	if !reflect.DeepEqual(cfg.DefaultConstraints, want) {
+		t.Errorf("want constraints: %v, got: %v", want, cfg.DefaultConstraints)
+	}
+
+	if got := cfg.Effective()["default_constraints"]; got != strings.Join(want, ",") {
+		t.Errorf("want effective constraints: %s, got: %s", strings.Join(want, ","), got)
+	}
+}
+
+func Test_Read_ConfigFile_UnknownKey(t *testing.T) {
+	path := writeConfigFile(t, "max_replica: 50\n")
+
+	_, err := ReadConfig{}.Read(testEnv{"config_file": path})
+	if err == nil || !strings.Contains(err.Error(), "max_replica") {
+		t.Errorf("want unknown key error for max_replica, got: %v", err)
+	}
+}
+
+func Test_Read_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"network_label":             "=true",
+		"default_constraints":       "linux",
+		"function_secrets_path":     "secrets",
+		"owner_label":               "com.openfaas.owner",
+		"max_replicas":              "-1",
+		"watchdog_port":             "70000",
+		"inventory_resync_interval": "0",
+		"idler_reconcile_interval":  "-5s",
+		"autoscaler_interval":       "0s",
+		"invocation_store_interval": "-1m",
+		"scale_from_zero_timeout":   "0",
+		"shutdown_grace_period":     "-5s",
+		"shutdown_drain_delay":      "-1s",
+		"max_restarts":              "-1",
+		"restart_delay":             "-5s",
+		"restart_window":            "-1m",
+	}
+
+	for key, value := range cases {
+		t.Run(key, func(t *testing.T) {
+			_, err := ReadConfig{}.Read(testEnv{key: value})
+			if err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("want error for %s=%s, got: %v", key, value, err)
+			}
+		})
+	}
+}